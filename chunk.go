@@ -0,0 +1,59 @@
+package overproto
+
+const (
+	// maxPayloadLen - наибольший PayloadLen пакета
+	maxPayloadLen = 65535
+	// maxUDPDatagram - наибольшая UDP датаграмма по IPv4 (65535 - IP и UDP заголовки)
+	maxUDPDatagram = 65507
+)
+
+// MaxChunkSize возвращает наибольший объём данных, который Send с флагами
+// flags передаёт одним пакетом: 65535 за вычетом IV и tag (FlagEncrypted)
+// и HMAC (FlagAuthenticated). Компрессия не учитывается, так как не
+// увеличивает payload
+func MaxChunkSize(flags uint8) int {
+	return maxPayloadLen - payloadOverhead(flags)
+}
+
+// Chunk делит data на части не больше MaxChunkSize(flags), каждую из которых
+// Send с теми же флагами передаёт одним пакетом
+// Части разделяют память с data. Пустой data - одна пустая часть
+func Chunk(data []byte, flags uint8) [][]byte {
+	return chunkBy(data, MaxChunkSize(flags))
+}
+
+// SendChunks передаёт data, превышающие предел одного пакета, частями Chunk:
+// пакетами с общим streamID и Seq 0, 1, 2... по порядку частей
+// По UDP части дополнительно уменьшаются, чтобы пакет помещался в одну
+// датаграмму. Получатель собирает данные, объединяя payload по возрастанию Seq
+// Возвращает общее количество отправленных байт; при ошибке - байты
+// частей, отправленных до неё
+func SendChunks(conn interface{}, streamID uint32, opcode, proto uint8, data []byte, flags uint8) (int, error) {
+	size := MaxChunkSize(flags)
+	if proto == ProtoUDP {
+		size = min(size, maxUDPDatagram-Overhead(flags))
+	}
+
+	total := 0
+	for i, chunk := range chunkBy(data, size) {
+		n, err := SendWithOptions(conn, streamID, opcode, proto, chunk, flags, SendOptions{Seq: uint32(i)})
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// chunkBy делит data на части не больше size байт
+func chunkBy(data []byte, size int) [][]byte {
+	if len(data) <= size {
+		return [][]byte{data}
+	}
+	chunks := make([][]byte, 0, (len(data)+size-1)/size)
+	for len(data) > size {
+		chunks = append(chunks, data[:size:size])
+		data = data[size:]
+	}
+	return append(chunks, data)
+}
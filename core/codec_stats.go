@@ -0,0 +1,175 @@
+package core
+
+import (
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+// latencyBuckets - число интервалов гистограммы задержек: по 4 на каждую
+// степень двойки наносекунд (погрешность оценки не более 25%)
+const latencyBuckets = 256
+
+// CodecStats - снимок затрат на сериализацию и десериализацию пакетов
+// Отражает только работу кодека (CPU), а не пропускную способность сети
+type CodecStats struct {
+	// Elapsed - время с запуска процесса или последнего ResetCodecStats
+	Elapsed time.Duration
+
+	EncodedPackets uint64 // Пакетов сериализовано
+	EncodedBytes   uint64 // Байт сериализовано (пакеты целиком)
+	DecodedPackets uint64 // Пакетов десериализовано
+	DecodedBytes   uint64 // Байт десериализовано (пакеты целиком)
+
+	EncodePacketsPerSec float64 // EncodedPackets / Elapsed
+	EncodeBytesPerSec   float64 // EncodedBytes / Elapsed
+	DecodePacketsPerSec float64 // DecodedPackets / Elapsed
+	DecodeBytesPerSec   float64 // DecodedBytes / Elapsed
+
+	// Задержки одного вызова; нулевые, пока SetCodecLatency выключен
+	EncodeP50 time.Duration
+	EncodeP99 time.Duration
+	DecodeP50 time.Duration
+	DecodeP99 time.Duration
+}
+
+// latencyHistogram - гистограмма задержек с атомарными счётчиками интервалов
+type latencyHistogram [latencyBuckets]atomic.Uint64
+
+// codecCounters - счётчики одного направления кодека
+type codecCounters struct {
+	packets atomic.Uint64
+	bytes   atomic.Uint64
+	latency latencyHistogram
+}
+
+var (
+	encodeStats codecCounters
+	decodeStats codecCounters
+	// codecLatency - измерять ли задержку вызовов
+	codecLatency atomic.Bool
+	// codecSince - начало периода статистики (UnixNano)
+	codecSince atomic.Int64
+)
+
+func init() {
+	codecSince.Store(time.Now().UnixNano())
+}
+
+// SetCodecLatency включает или выключает измерение задержки Serialize,
+// AppendPacket и Deserialize для p50/p99 в GetCodecStats
+// Счётчики пакетов и байт ведутся всегда; измерение добавляет два вызова
+// time.Now на пакет
+func SetCodecLatency(enabled bool) {
+	codecLatency.Store(enabled)
+}
+
+// GetCodecStats возвращает снимок статистики кодека
+// Учитываются Serialize, AppendPacket, SerializeTo, Deserialize и приём
+// пакетов TCP; задержка SerializeTo и приёма TCP не измеряется, так как
+// включает ввод-вывод
+func GetCodecStats() CodecStats {
+	elapsed := time.Duration(time.Now().UnixNano() - codecSince.Load())
+	stats := CodecStats{
+		Elapsed:        elapsed,
+		EncodedPackets: encodeStats.packets.Load(),
+		EncodedBytes:   encodeStats.bytes.Load(),
+		DecodedPackets: decodeStats.packets.Load(),
+		DecodedBytes:   decodeStats.bytes.Load(),
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		stats.EncodePacketsPerSec = float64(stats.EncodedPackets) / secs
+		stats.EncodeBytesPerSec = float64(stats.EncodedBytes) / secs
+		stats.DecodePacketsPerSec = float64(stats.DecodedPackets) / secs
+		stats.DecodeBytesPerSec = float64(stats.DecodedBytes) / secs
+	}
+	stats.EncodeP50, stats.EncodeP99 = encodeStats.latency.percentiles()
+	stats.DecodeP50, stats.DecodeP99 = decodeStats.latency.percentiles()
+	return stats
+}
+
+// ResetCodecStats обнуляет статистику кодека и начинает новый период
+func ResetCodecStats() {
+	for _, c := range []*codecCounters{&encodeStats, &decodeStats} {
+		c.packets.Store(0)
+		c.bytes.Store(0)
+		for i := range c.latency {
+			c.latency[i].Store(0)
+		}
+	}
+	codecSince.Store(time.Now().UnixNano())
+}
+
+// CountDecoded учитывает пакет размером size байт, принятый без Deserialize
+// (например, разобранный по мере чтения из TCP потока)
+func CountDecoded(size int) {
+	decodeStats.add(size, time.Time{})
+}
+
+// codecStart возвращает время начала вызова кодека или нулевое время,
+// если задержка не измеряется
+func codecStart() time.Time {
+	if !codecLatency.Load() {
+		return time.Time{}
+	}
+	return time.Now()
+}
+
+// add учитывает пакет размером size; start - результат codecStart
+func (c *codecCounters) add(size int, start time.Time) {
+	c.packets.Add(1)
+	c.bytes.Add(uint64(size))
+	if !start.IsZero() {
+		c.latency[latencyBucket(uint64(time.Since(start)))].Add(1)
+	}
+}
+
+// latencyBucket возвращает интервал гистограммы для задержки ns
+// Значения меньше 4 нс занимают отдельные интервалы, дальше каждая
+// степень двойки делится на 4 равных интервала
+func latencyBucket(ns uint64) int {
+	if ns < 4 {
+		return int(ns)
+	}
+	exp := bits.Len64(ns) - 1
+	sub := (ns >> (exp - 2)) & 3
+	return 4*(exp-1) + int(sub)
+}
+
+// bucketUpper возвращает верхнюю границу интервала idx в наносекундах
+func bucketUpper(idx int) uint64 {
+	if idx < 4 {
+		return uint64(idx)
+	}
+	exp := idx/4 + 1
+	sub := uint64(idx % 4)
+	width := uint64(1) << (exp - 2)
+	return (4+sub)*width + width - 1
+}
+
+// percentiles оценивает p50 и p99 по верхним границам интервалов
+func (h *latencyHistogram) percentiles() (p50, p99 time.Duration) {
+	var counts [latencyBuckets]uint64
+	var total uint64
+	for i := range h {
+		counts[i] = h[i].Load()
+		total += counts[i]
+	}
+	if total == 0 {
+		return 0, 0
+	}
+	return time.Duration(bucketUpper(rankBucket(&counts, (total+1)/2))),
+		time.Duration(bucketUpper(rankBucket(&counts, (total*99+99)/100)))
+}
+
+// rankBucket возвращает интервал, в который попадает rank-е (с 1) значение
+func rankBucket(counts *[latencyBuckets]uint64, rank uint64) int {
+	var seen uint64
+	for i, n := range counts {
+		seen += n
+		if seen >= rank {
+			return i
+		}
+	}
+	return latencyBuckets - 1
+}
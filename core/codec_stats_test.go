@@ -0,0 +1,48 @@
+package core
+
+import (
+	"testing"
+)
+
+func TestCodecStatsCountsAndLatency(t *testing.T) {
+	SetCodecLatency(true)
+	defer SetCodecLatency(false)
+	ResetCodecStats()
+	defer ResetCodecStats()
+
+	hdr := &PacketHeader{Magic: Magic, Version: Version, Opcode: OpData, PayloadLen: 100}
+	payload := make([]byte, 100)
+	const packets = 50
+	for i := 0; i < packets; i++ {
+		data, err := Serialize(hdr, payload)
+		if err != nil {
+			t.Fatalf("Serialize: %v", err)
+		}
+		if _, _, err := Deserialize(data); err != nil {
+			t.Fatalf("Deserialize: %v", err)
+		}
+	}
+
+	stats := GetCodecStats()
+	size := uint64(HeaderSize + len(payload) + 4)
+	if stats.EncodedPackets != packets || stats.EncodedBytes != packets*size {
+		t.Errorf("encoded %d packets / %d bytes, want %d / %d", stats.EncodedPackets, stats.EncodedBytes, packets, packets*size)
+	}
+	if stats.DecodedPackets != packets || stats.DecodedBytes != packets*size {
+		t.Errorf("decoded %d packets / %d bytes, want %d / %d", stats.DecodedPackets, stats.DecodedBytes, packets, packets*size)
+	}
+	if stats.EncodePacketsPerSec <= 0 || stats.DecodeBytesPerSec <= 0 {
+		t.Errorf("rates not computed: %+v", stats)
+	}
+	if stats.EncodeP50 > stats.EncodeP99 || stats.DecodeP50 > stats.DecodeP99 || stats.EncodeP99 == 0 {
+		t.Errorf("bad percentiles: encode %v/%v decode %v/%v", stats.EncodeP50, stats.EncodeP99, stats.DecodeP50, stats.DecodeP99)
+	}
+
+	// Граница интервала не меньше значения и превышает его не более чем на 25%
+	for _, ns := range []uint64{0, 3, 4, 7, 100, 1023, 1024, 123456789, 1 << 62} {
+		upper := bucketUpper(latencyBucket(ns))
+		if upper < ns || upper-ns > ns/4 {
+			t.Errorf("bucket upper for %d = %d", ns, upper)
+		}
+	}
+}
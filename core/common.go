@@ -1,6 +1,9 @@
 package core
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 // Константы протокола
 const (
@@ -20,13 +23,17 @@ const (
 	CompressThreshold = 512
 	// CompressLevel - уровень компрессии zlib (1-9)
 	CompressLevel = 6
+	// StreamCompressLevel - уровень компрессии потокового режима
+	// На уровнях ниже 7 deflate не ищет совпадения в словаре для коротких
+	// сообщений после sync flush, и потоковый режим теряет смысл
+	StreamCompressLevel = 7
 )
 
 // Флаги пакета
 const (
 	// FlagFragment - пакет является фрагментом
 	FlagFragment = 0x01
-	// FlagCompressed - payload сжат через zlib
+	// FlagCompressed - payload сжат через zlib (при приёме также принимается gzip)
 	FlagCompressed = 0x02
 	// FlagEncrypted - payload зашифрован через AES-GCM
 	FlagEncrypted = 0x04
@@ -34,6 +41,13 @@ const (
 	FlagReliable = 0x08
 	// FlagACK - пакет является ACK подтверждением
 	FlagACK = 0x10
+	// FlagPriority - приоритетный пакет (управляющие сообщения вне очереди данных)
+	FlagPriority = 0x20
+	// FlagAuthenticated - payload завершается HMAC-SHA256 (заголовок + payload)
+	FlagAuthenticated = 0x40
+	// FlagOrdered - ненадёжный пакет надёжной сессии, Seq которого равен
+	// номеру следующего надёжного пакета (см. ReliableContext.SendUnreliable)
+	FlagOrdered = 0x80
 )
 
 // Opcode операции
@@ -70,8 +84,85 @@ type Config struct {
 	MTU uint
 	// NonBlocking - non-blocking режим сокетов
 	NonBlocking bool
+	// DropForeignPackets - молча отбрасывать и считать UDP датаграммы,
+	// не являющиеся пакетами OverProto (неверный Magic)
+	DropForeignPackets bool
+	// DisableReuseAddr - не устанавливать SO_REUSEADDR на слушающих сокетах
+	// Позволяет получить ошибку "address in use", если порт уже занят
+	DisableReuseAddr bool
+	// CRCScope - область CRC32: заголовок и payload (по умолчанию) или только payload
+	CRCScope CRCScope
+	// CongestionControl - алгоритм congestion control надёжных UDP сессий
+	// (CongestionReno по умолчанию)
+	CongestionControl CongestionAlgorithm
+	// Pacing - равномерно распределять отправку пакетов надёжных сессий
+	// по времени вместо отправки всего окна подряд
+	Pacing bool
+	// NACK - получатель надёжной сессии сразу запрашивает пропущенные пакеты
+	// (ControlNACK), не дожидаясь таймаута отправителя
+	NACK bool
+	// OrderedDelivery - надёжная сессия выдаёт пакеты в порядке отправки,
+	// а ненадёжные пакеты SendUnreliable - между соседними надёжными
+	OrderedDelivery bool
+	// MaxReorderBuffer - предел байт payload, ожидающих пропущенных пакетов
+	// при OrderedDelivery; при превышении сессия завершается. 0 - без ограничения
+	MaxReorderBuffer int
+	// BindInterface - имя сетевого интерфейса (например "eth1"), к которому
+	// привязываются слушающие TCP и UDP сокеты (SO_BINDTODEVICE, только Linux)
+	// Пустая строка - без привязки
+	BindInterface string
+	// DSCP - значение DSCP (0-63) для исходящих пакетов TCP и UDP сокетов
+	// (например 46 - EF для трафика реального времени); 0 - не устанавливать
+	DSCP uint8
+	// Backlog - размер очереди входящих соединений TCPListen
+	// 0 - системный максимум (net.core.somaxconn на Linux)
+	Backlog int
+	// KeepAliveIdle - простой соединения до первой TCP keepalive пробы
+	// для TCPAccept и TCPConnect; 0 - значение Go по умолчанию (15 секунд)
+	KeepAliveIdle time.Duration
+	// KeepAliveInterval - интервал между keepalive пробами; 0 - как KeepAliveIdle
+	KeepAliveInterval time.Duration
+	// KeepAliveCount - число неотвеченных проб, после которого соединение
+	// считается мёртвым; 0 - системное значение (9 на Linux, 8 на macOS, 10 на Windows)
+	KeepAliveCount int
+	// WriteTimeout - предельное время одной отправки TCPSend/UDPSend (и Send);
+	// при истечении возвращается ErrWriteTimeout. 0 - без ограничения
+	WriteTimeout time.Duration
+	// MaxConnections - предел одновременно открытых соединений, принятых
+	// TCPAccept; соединения сверх него закрываются с ControlClose. 0 - без ограничения
+	MaxConnections int
+	// ValidateProto - отклонять принятые пакеты, у которых поле Proto не
+	// соответствует транспорту (ProtoTCP по TCP, ProtoUDP по UDP)
+	// Выключено по умолчанию, чтобы не мешать ретрансляции между транспортами
+	ValidateProto bool
+	// DecodeOnRecv - TCPRecv, TCPRecvInto и UDPRecv пакета OverProto возвращают
+	// payload после проверки HMAC, расшифровки и распаковки (см. DecodePayload)
+	DecodeOnRecv bool
+	// UDPRecvWorkers - число горутин разбора датаграмм UDPRecvWorkers;
+	// 0 - по числу CPU
+	UDPRecvWorkers int
+	// ObfuscationKey - ключ XOR-маски заголовка пакетов TCP и UDP (nil - без маски)
+	// Скрывает Magic и другие узнаваемые поля от DPI; не является защитой
+	// данных. Ключ согласуется сторонами заранее и должен совпадать
+	ObfuscationKey []byte
+	// SkipCRCForOpcodes - опкоды (например, OpACK), пакеты с которыми
+	// передаются с нулевым CRC32 без проверки; должен совпадать у сторон
+	SkipCRCForOpcodes []uint8
+	// CodecLatency - измерять задержку сериализации и десериализации
+	// для p50/p99 в CodecStats (счётчики пакетов и байт ведутся всегда)
+	CodecLatency bool
 }
 
+// CongestionAlgorithm - алгоритм congestion control надёжной передачи
+type CongestionAlgorithm uint8
+
+const (
+	// CongestionReno - slow start, AIMD и fast retransmit (по умолчанию)
+	CongestionReno CongestionAlgorithm = 0
+	// CongestionBBR - модель на основе оценки пропускной способности и минимального RTT
+	CongestionBBR CongestionAlgorithm = 1
+)
+
 // NewConfig создаёт новую конфигурацию с значениями по умолчанию
 func NewConfig() *Config {
 	return &Config{
@@ -81,6 +172,13 @@ func NewConfig() *Config {
 	}
 }
 
+// IsOverProtoPacket быстро проверяет, похожи ли данные на пакет OverProto
+// Сравнивает только первые два байта с Magic, без аллокаций
+// Подходит как дешёвый фильтр в цикле приёма перед Deserialize
+func IsOverProtoPacket(data []byte) bool {
+	return len(data) >= 2 && uint16(data[0])<<8|uint16(data[1]) == Magic
+}
+
 // SafeUint16ToUint16 проверяет, что значение uint помещается в uint16
 func SafeUint16ToUint16(v uint) (uint16, error) {
 	if v > 65535 {
@@ -0,0 +1,294 @@
+package core
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Типы стандартных управляющих сообщений (первый байт payload OpControl)
+// Значения 0x80-0xFF зарезервированы для сообщений приложения
+const (
+	ControlWindowUpdate  uint8 = 0x01 // Обновление окна приёма
+	ControlClose         uint8 = 0x02 // Закрытие соединения/потока
+	ControlPingConfig    uint8 = 0x03 // Параметры keepalive
+	ControlMTUReport     uint8 = 0x04 // Сообщение об MTU пути
+	ControlConnectionID  uint8 = 0x05 // Идентификатор соединения (миграция адреса)
+	ControlPathChallenge uint8 = 0x06 // Проверка нового адреса: случайный токен
+	ControlPathResponse  uint8 = 0x07 // Ответ на проверку адреса: тот же токен
+	ControlStreamBegin   uint8 = 0x08 // Начало потоковой передачи
+	ControlStreamEnd     uint8 = 0x09 // Конец (или прерывание) потоковой передачи
+	ControlNACK          uint8 = 0x0A // Номера пропущенных пакетов надёжной сессии
+	ControlCompressReset uint8 = 0x0B // Сброс словаря потоковой компрессии
+)
+
+// Теги TLV стандартных управляющих сообщений
+const (
+	TagWindow   uint8 = 0x01 // uint32 - размер окна в пакетах
+	TagCode     uint8 = 0x02 // uint16 - код причины закрытия
+	TagReason   uint8 = 0x03 // UTF-8 строка - описание причины
+	TagInterval uint8 = 0x04 // uint32 - интервал в миллисекундах
+	TagTimeout  uint8 = 0x05 // uint32 - таймаут в миллисекундах
+	TagMTU      uint8 = 0x06 // uint16 - MTU в байтах
+	TagConnID   uint8 = 0x07 // uint64 - идентификатор соединения
+	TagToken    uint8 = 0x08 // uint64 - токен проверки адреса
+	TagLength   uint8 = 0x09 // uint64 - размер переданных данных в байтах
+	TagSeqs     uint8 = 0x0A // uint32... - список sequence numbers
+)
+
+// TLV - поле управляющего сообщения: [Tag 1 byte] [Length 2 bytes] [Value]
+type TLV struct {
+	Tag   uint8
+	Value []byte
+}
+
+// ControlMessage - управляющее сообщение в payload пакета OpControl
+// Формат: [Type 1 byte] [TLV]...; многобайтовые значения в big-endian
+// Получатель должен игнорировать неизвестные теги и типы
+type ControlMessage struct {
+	Type uint8
+	TLVs []TLV
+}
+
+// EncodeControl кодирует управляющее сообщение в payload для OpControl
+func EncodeControl(msg *ControlMessage) ([]byte, error) {
+	size := 1
+	for _, tlv := range msg.TLVs {
+		if len(tlv.Value) > 0xFFFF {
+			return nil, errors.New("TLV value too large")
+		}
+		size += 3 + len(tlv.Value)
+	}
+	if size > 0xFFFF {
+		return nil, errors.New("control message too large")
+	}
+
+	buf := make([]byte, 0, size)
+	buf = append(buf, msg.Type)
+	for _, tlv := range msg.TLVs {
+		buf = append(buf, tlv.Tag)
+		buf = binary.BigEndian.AppendUint16(buf, uint16(len(tlv.Value)))
+		buf = append(buf, tlv.Value...)
+	}
+
+	return buf, nil
+}
+
+// DecodeControl разбирает payload пакета OpControl
+// Значения TLV ссылаются на data без копирования
+func DecodeControl(data []byte) (*ControlMessage, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty control message")
+	}
+
+	msg := &ControlMessage{Type: data[0]}
+	rest := data[1:]
+	for len(rest) > 0 {
+		if len(rest) < 3 {
+			return nil, errors.New("truncated TLV header")
+		}
+		length := int(binary.BigEndian.Uint16(rest[1:3]))
+		if len(rest) < 3+length {
+			return nil, errors.New("truncated TLV value")
+		}
+		msg.TLVs = append(msg.TLVs, TLV{Tag: rest[0], Value: rest[3 : 3+length]})
+		rest = rest[3+length:]
+	}
+
+	return msg, nil
+}
+
+// Get возвращает значение первого TLV с тегом tag
+func (msg *ControlMessage) Get(tag uint8) ([]byte, bool) {
+	for _, tlv := range msg.TLVs {
+		if tlv.Tag == tag {
+			return tlv.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Uint16 возвращает значение TLV как uint16
+func (msg *ControlMessage) Uint16(tag uint8) (uint16, error) {
+	value, ok := msg.Get(tag)
+	if !ok {
+		return 0, errors.New("TLV not found")
+	}
+	if len(value) != 2 {
+		return 0, errors.New("invalid TLV length")
+	}
+	return binary.BigEndian.Uint16(value), nil
+}
+
+// Uint32 возвращает значение TLV как uint32
+func (msg *ControlMessage) Uint32(tag uint8) (uint32, error) {
+	value, ok := msg.Get(tag)
+	if !ok {
+		return 0, errors.New("TLV not found")
+	}
+	if len(value) != 4 {
+		return 0, errors.New("invalid TLV length")
+	}
+	return binary.BigEndian.Uint32(value), nil
+}
+
+// Uint64 возвращает значение TLV как uint64
+func (msg *ControlMessage) Uint64(tag uint8) (uint64, error) {
+	value, ok := msg.Get(tag)
+	if !ok {
+		return 0, errors.New("TLV not found")
+	}
+	if len(value) != 8 {
+		return 0, errors.New("invalid TLV length")
+	}
+	return binary.BigEndian.Uint64(value), nil
+}
+
+// Uint32s возвращает значение TLV как список uint32
+func (msg *ControlMessage) Uint32s(tag uint8) ([]uint32, error) {
+	value, ok := msg.Get(tag)
+	if !ok {
+		return nil, errors.New("TLV not found")
+	}
+	if len(value)%4 != 0 {
+		return nil, errors.New("invalid TLV length")
+	}
+	list := make([]uint32, 0, len(value)/4)
+	for i := 0; i < len(value); i += 4 {
+		list = append(list, binary.BigEndian.Uint32(value[i:i+4]))
+	}
+	return list, nil
+}
+
+// String возвращает значение TLV как строку (пустую, если тега нет)
+func (msg *ControlMessage) String(tag uint8) string {
+	value, _ := msg.Get(tag)
+	return string(value)
+}
+
+// uint16TLV создаёт TLV с uint16 значением
+func uint16TLV(tag uint8, v uint16) TLV {
+	return TLV{Tag: tag, Value: binary.BigEndian.AppendUint16(nil, v)}
+}
+
+// uint32TLV создаёт TLV с uint32 значением
+func uint32TLV(tag uint8, v uint32) TLV {
+	return TLV{Tag: tag, Value: binary.BigEndian.AppendUint32(nil, v)}
+}
+
+// millisTLV создаёт TLV с длительностью в миллисекундах (с насыщением до uint32)
+func millisTLV(tag uint8, d time.Duration) TLV {
+	ms := d.Milliseconds()
+	if ms < 0 {
+		ms = 0
+	}
+	if ms > 0xFFFFFFFF {
+		ms = 0xFFFFFFFF
+	}
+	return uint32TLV(tag, uint32(ms))
+}
+
+// NewWindowUpdate создаёт сообщение об обновлении окна приёма
+func NewWindowUpdate(window uint32) *ControlMessage {
+	return &ControlMessage{
+		Type: ControlWindowUpdate,
+		TLVs: []TLV{uint32TLV(TagWindow, window)},
+	}
+}
+
+// NewCloseMessage создаёт сообщение о закрытии с кодом и описанием причины
+func NewCloseMessage(code uint16, reason string) *ControlMessage {
+	msg := &ControlMessage{
+		Type: ControlClose,
+		TLVs: []TLV{uint16TLV(TagCode, code)},
+	}
+	if reason != "" {
+		msg.TLVs = append(msg.TLVs, TLV{Tag: TagReason, Value: []byte(reason)})
+	}
+	return msg
+}
+
+// NewPingConfig создаёт сообщение с параметрами keepalive
+func NewPingConfig(interval, timeout time.Duration) *ControlMessage {
+	return &ControlMessage{
+		Type: ControlPingConfig,
+		TLVs: []TLV{millisTLV(TagInterval, interval), millisTLV(TagTimeout, timeout)},
+	}
+}
+
+// NewMTUReport создаёт сообщение об MTU пути
+func NewMTUReport(mtu uint16) *ControlMessage {
+	return &ControlMessage{
+		Type: ControlMTUReport,
+		TLVs: []TLV{uint16TLV(TagMTU, mtu)},
+	}
+}
+
+// NewConnectionIDMessage создаёт сообщение с идентификатором соединения
+// По нему удалённая сторона узнаёт сессию после смены адреса отправителя
+func NewConnectionIDMessage(id uint64) *ControlMessage {
+	return &ControlMessage{
+		Type: ControlConnectionID,
+		TLVs: []TLV{{Tag: TagConnID, Value: binary.BigEndian.AppendUint64(nil, id)}},
+	}
+}
+
+// NewPathChallenge создаёт запрос проверки адреса с токеном token
+func NewPathChallenge(token uint64) *ControlMessage {
+	return &ControlMessage{
+		Type: ControlPathChallenge,
+		TLVs: []TLV{{Tag: TagToken, Value: binary.BigEndian.AppendUint64(nil, token)}},
+	}
+}
+
+// NewPathResponse создаёт ответ на проверку адреса с токеном из запроса
+func NewPathResponse(token uint64) *ControlMessage {
+	return &ControlMessage{
+		Type: ControlPathResponse,
+		TLVs: []TLV{{Tag: TagToken, Value: binary.BigEndian.AppendUint64(nil, token)}},
+	}
+}
+
+// NewStreamBegin создаёт сообщение о начале потоковой передачи
+// Идентификатор передачи - StreamID пакетов BEGIN, данных и END
+func NewStreamBegin() *ControlMessage {
+	return &ControlMessage{Type: ControlStreamBegin}
+}
+
+// NewStreamEnd создаёт сообщение о завершении передачи length байт
+func NewStreamEnd(length uint64) *ControlMessage {
+	return &ControlMessage{
+		Type: ControlStreamEnd,
+		TLVs: []TLV{{Tag: TagLength, Value: binary.BigEndian.AppendUint64(nil, length)}},
+	}
+}
+
+// NewStreamAbort создаёт сообщение о прерывании передачи отправителем
+// после length байт: END с кодом и описанием причины
+func NewStreamAbort(length uint64, code uint16, reason string) *ControlMessage {
+	msg := NewStreamEnd(length)
+	msg.TLVs = append(msg.TLVs, uint16TLV(TagCode, code))
+	if reason != "" {
+		msg.TLVs = append(msg.TLVs, TLV{Tag: TagReason, Value: []byte(reason)})
+	}
+	return msg
+}
+
+// NewCompressReset создаёт сообщение о сбросе словаря потоковой компрессии:
+// следующий сжатый сегмент начинает новый deflate поток
+func NewCompressReset() *ControlMessage {
+	return &ControlMessage{Type: ControlCompressReset}
+}
+
+// NewNACK создаёт отрицательное подтверждение: получатель надёжной сессии
+// обнаружил пропуск и просит немедленно повторить пакеты seqs
+func NewNACK(seqs []uint32) *ControlMessage {
+	value := make([]byte, 0, 4*len(seqs))
+	for _, seq := range seqs {
+		value = binary.BigEndian.AppendUint32(value, seq)
+	}
+	return &ControlMessage{
+		Type: ControlNACK,
+		TLVs: []TLV{{Tag: TagSeqs, Value: value}},
+	}
+}
@@ -0,0 +1,42 @@
+package core
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestControlMessageRoundTrip(t *testing.T) {
+	data, err := EncodeControl(NewCloseMessage(1001, "going away"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{ControlClose, TagCode, 0x00, 0x02, 0x03, 0xE9, TagReason, 0x00, 0x0A}
+	want = append(want, "going away"...)
+	if !bytes.Equal(data, want) {
+		t.Fatalf("encoded = %x, want %x", data, want)
+	}
+
+	msg, err := DecodeControl(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := msg.Uint16(TagCode)
+	if msg.Type != ControlClose || err != nil || code != 1001 || msg.String(TagReason) != "going away" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	ping, _ := EncodeControl(NewPingConfig(5*time.Second, 15*time.Second))
+	msg, err = DecodeControl(ping)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if interval, _ := msg.Uint32(TagInterval); interval != 5000 {
+		t.Fatalf("interval = %d", interval)
+	}
+
+	if _, err := DecodeControl(data[:len(data)-1]); err == nil {
+		t.Fatal("expected error for truncated message")
+	}
+}
@@ -1,5 +1,7 @@
 package core
 
+import "sync"
+
 // CRC32Context - контекст для вычисления CRC32
 type CRC32Context struct {
 	crc uint32
@@ -9,16 +11,18 @@ var (
 	// crc32Table - таблица lookup для быстрого вычисления CRC32 IEEE 802.3
 	// Полином: 0xEDB88320 (reversed для IEEE 802.3)
 	crc32Table [256]uint32
-	// crc32TableInit - флаг инициализации таблицы
-	crc32TableInit bool
+	// crc32TableOnce - однократная инициализация таблицы
+	// (NewCRC32 вызывается из нескольких горутин)
+	crc32TableOnce sync.Once
 )
 
 // initCRC32Table инициализирует таблицу lookup для CRC32
 func initCRC32Table() {
-	if crc32TableInit {
-		return
-	}
+	crc32TableOnce.Do(buildCRC32Table)
+}
 
+// buildCRC32Table заполняет таблицу lookup для CRC32
+func buildCRC32Table() {
 	// Полином для IEEE 802.3 (reversed): 0xEDB88320
 	poly := uint32(0xEDB88320)
 
@@ -34,8 +38,6 @@ func initCRC32Table() {
 		}
 		crc32Table[i] = crc
 	}
-
-	crc32TableInit = true
 }
 
 // NewCRC32 создаёт новый контекст для вычисления CRC32
@@ -47,6 +49,34 @@ func NewCRC32() *CRC32Context {
 	}
 }
 
+// Reset сбрасывает контекст в начальное состояние (0xFFFFFFFF)
+// Позволяет переиспользовать один контекст для нескольких пакетов
+func (ctx *CRC32Context) Reset() {
+	ctx.crc = 0xFFFFFFFF
+}
+
+// crc32Pool - пул контекстов CRC32 для горячего пути сериализации
+var crc32Pool = sync.Pool{
+	New: func() interface{} {
+		return NewCRC32()
+	},
+}
+
+// acquireCRC32 берёт сброшенный контекст из пула
+func acquireCRC32() *CRC32Context {
+	ctx, ok := crc32Pool.Get().(*CRC32Context)
+	if !ok {
+		return NewCRC32()
+	}
+	ctx.Reset()
+	return ctx
+}
+
+// releaseCRC32 возвращает контекст в пул
+func releaseCRC32(ctx *CRC32Context) {
+	crc32Pool.Put(ctx)
+}
+
 // Update обновляет CRC32 новыми данными
 func (ctx *CRC32Context) Update(data []byte) {
 	for _, b := range data {
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// CRCScope - область данных, покрываемая CRC32 в конце пакета
+type CRCScope uint8
+
+const (
+	// CRCHeaderAndPayload - CRC32 по заголовку и payload (по умолчанию)
+	CRCHeaderAndPayload CRCScope = 0
+	// CRCPayloadOnly - CRC32 только по payload
+	// Для совместимости с системами, считающими контрольную сумму иначе,
+	// или когда заголовок уже защищён AEAD
+	CRCPayloadOnly CRCScope = 1
+)
+
+// crcScope - текущая область CRC32 для Serialize/Deserialize
+var crcScope atomic.Uint32
+
+// SetCRCScope устанавливает область CRC32 для всех последующих Serialize/Deserialize
+// Обе стороны соединения должны использовать одинаковую область
+func SetCRCScope(scope CRCScope) error {
+	if scope != CRCHeaderAndPayload && scope != CRCPayloadOnly {
+		return errors.New("invalid CRC scope")
+	}
+	crcScope.Store(uint32(scope))
+	return nil
+}
+
+// GetCRCScope возвращает текущую область CRC32
+func GetCRCScope() CRCScope {
+	return CRCScope(crcScope.Load())
+}
+
+// crcSkipOpcodes - битовая маска опкодов, для которых CRC32 не вычисляется
+// и не проверяется (бит opcode%64 в слове opcode/64)
+var crcSkipOpcodes [4]atomic.Uint64
+
+// SetSkipCRCOpcodes задаёт опкоды, пакеты с которыми сериализуются с нулевым
+// CRC32 и принимаются без его проверки; nil - CRC32 для всех опкодов
+// Обе стороны соединения должны использовать одинаковый набор
+func SetSkipCRCOpcodes(opcodes []uint8) {
+	var mask [4]uint64
+	for _, op := range opcodes {
+		mask[op/64] |= 1 << (op % 64)
+	}
+	for i := range mask {
+		crcSkipOpcodes[i].Store(mask[i])
+	}
+}
+
+// SkipsCRC проверяет, пропускается ли CRC32 для пакетов с opcode
+func SkipsCRC(opcode uint8) bool {
+	return crcSkipOpcodes[opcode/64].Load()&(1<<(opcode%64)) != 0
+}
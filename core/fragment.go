@@ -19,6 +19,11 @@ type FragmentContext struct {
 	TotalPayloadSize  uint
 	ReceivedPayloadSize uint
 	mu                sync.Mutex
+
+	// limited - контекст учитывается в глобальных лимитах (см. AcquireFragmentContext)
+	limited bool
+	// timeout - предельное время сборки; 0 - FragTimeoutSec
+	timeout time.Duration
 }
 
 // NewFragmentContext создаёт контекст для сборки фрагментов
@@ -49,6 +54,13 @@ func (ctx *FragmentContext) AddFragment(fragID uint16, hdr *PacketHeader, data [
 		return false, nil
 	}
 
+	// Резервируем память в глобальном лимите сборки
+	if ctx.limited {
+		if err := reserveReassemblyBytes(uint64(len(data))); err != nil {
+			return false, err
+		}
+	}
+
 	// Сохраняем фрагмент
 	ctx.Fragments[fragID] = make([]byte, len(data))
 	copy(ctx.Fragments[fragID], data)
@@ -113,11 +125,36 @@ func (ctx *FragmentContext) Assemble() (*PacketHeader, []byte, error) {
 	return &finalHeader, payload, nil
 }
 
-// IsTimeout проверяет, истёк ли timeout (30 секунд)
+// SetTimeout задаёт предельное время сборки, отсчитываемое от CreatedAt:
+// короткое для передач реального времени, длинное для больших передач
+// по медленному каналу. 0 - FragTimeoutSec
+func (ctx *FragmentContext) SetTimeout(d time.Duration) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.timeout = d
+}
+
+// Timeout возвращает предельное время сборки
+func (ctx *FragmentContext) Timeout() time.Duration {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.timeoutLocked()
+}
+
+// timeoutLocked возвращает предельное время сборки
+// Вызывается с захваченным ctx.mu
+func (ctx *FragmentContext) timeoutLocked() time.Duration {
+	if ctx.timeout > 0 {
+		return ctx.timeout
+	}
+	return time.Duration(FragTimeoutSec) * time.Second
+}
+
+// IsTimeout проверяет, истёк ли timeout (SetTimeout, по умолчанию 30 секунд)
 func (ctx *FragmentContext) IsTimeout() bool {
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
-	return time.Since(ctx.CreatedAt) > time.Duration(FragTimeoutSec)*time.Second
+	return time.Since(ctx.CreatedAt) > ctx.timeoutLocked()
 }
 
 // FragmentPacket фрагментирует пакет на части
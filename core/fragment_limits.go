@@ -0,0 +1,119 @@
+package core
+
+import (
+	"errors"
+	"sync"
+)
+
+const (
+	// DefaultMaxReassemblyContexts - максимум одновременно собираемых сообщений
+	DefaultMaxReassemblyContexts = 1024
+	// DefaultMaxReassemblyBytes - максимум байт во всех незавершённых сборках (64MB)
+	DefaultMaxReassemblyBytes = 64 * 1024 * 1024
+)
+
+// ErrReassemblyLimit - превышен лимит памяти или количества сборок фрагментов
+var ErrReassemblyLimit = errors.New("fragment reassembly limit exceeded")
+
+// ReassemblyStats - состояние лимитов сборки фрагментов
+type ReassemblyStats struct {
+	ActiveContexts int    // Незавершённые сборки
+	BufferedBytes  uint64 // Байты фрагментов в незавершённых сборках
+	Dropped        uint64 // Отклонённые сборки и фрагменты из-за лимитов
+}
+
+var (
+	// reassemblyMaxContexts - лимит количества сборок
+	reassemblyMaxContexts = DefaultMaxReassemblyContexts
+	// reassemblyMaxBytes - лимит буферизованных байт
+	reassemblyMaxBytes uint64 = DefaultMaxReassemblyBytes
+	// reassemblyStats - текущее использование
+	reassemblyStats ReassemblyStats
+	// reassemblyMu - мьютекс для лимитов и статистики
+	reassemblyMu sync.Mutex
+)
+
+// SetReassemblyLimits устанавливает глобальные лимиты сборки фрагментов
+// Защищают от peer'а, открывающего множество сборок и не завершающего их
+// (иначе память удерживается до FragTimeoutSec). 0 - значение по умолчанию
+func SetReassemblyLimits(maxContexts int, maxBytes uint64) {
+	if maxContexts <= 0 {
+		maxContexts = DefaultMaxReassemblyContexts
+	}
+	if maxBytes == 0 {
+		maxBytes = DefaultMaxReassemblyBytes
+	}
+
+	reassemblyMu.Lock()
+	defer reassemblyMu.Unlock()
+	reassemblyMaxContexts = maxContexts
+	reassemblyMaxBytes = maxBytes
+}
+
+// GetReassemblyStats возвращает использование лимитов сборки
+func GetReassemblyStats() ReassemblyStats {
+	reassemblyMu.Lock()
+	defer reassemblyMu.Unlock()
+	return reassemblyStats
+}
+
+// AcquireFragmentContext создаёт контекст сборки с учётом глобальных лимитов
+// Возвращает ErrReassemblyLimit, если достигнут лимит количества сборок
+// Контекст должен быть освобождён через Release после сборки или по таймауту
+func AcquireFragmentContext(streamID, seq uint32, totalFrags uint16) (*FragmentContext, error) {
+	reassemblyMu.Lock()
+	if reassemblyStats.ActiveContexts >= reassemblyMaxContexts {
+		reassemblyStats.Dropped++
+		reassemblyMu.Unlock()
+		return nil, ErrReassemblyLimit
+	}
+	reassemblyStats.ActiveContexts++
+	reassemblyMu.Unlock()
+
+	ctx := NewFragmentContext(streamID, seq, totalFrags)
+	ctx.limited = true
+	return ctx, nil
+}
+
+// reserveReassemblyBytes резервирует память под фрагмент
+func reserveReassemblyBytes(n uint64) error {
+	reassemblyMu.Lock()
+	defer reassemblyMu.Unlock()
+
+	if reassemblyStats.BufferedBytes+n > reassemblyMaxBytes {
+		reassemblyStats.Dropped++
+		return ErrReassemblyLimit
+	}
+	reassemblyStats.BufferedBytes += n
+	return nil
+}
+
+// releaseReassembly возвращает слот контекста и его байты
+func releaseReassembly(n uint64) {
+	reassemblyMu.Lock()
+	defer reassemblyMu.Unlock()
+
+	reassemblyStats.ActiveContexts--
+	if n > reassemblyStats.BufferedBytes {
+		n = reassemblyStats.BufferedBytes
+	}
+	reassemblyStats.BufferedBytes -= n
+}
+
+// Release освобождает контекст, созданный AcquireFragmentContext:
+// возвращает его слот и память в глобальный лимит и очищает фрагменты
+// Повторный вызов и вызов для контекста из NewFragmentContext ничего не делают
+func (ctx *FragmentContext) Release() {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if !ctx.limited {
+		return
+	}
+	ctx.limited = false
+	releaseReassembly(uint64(ctx.ReceivedPayloadSize))
+
+	for i := range ctx.Fragments {
+		ctx.Fragments[i] = nil
+	}
+}
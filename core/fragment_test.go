@@ -0,0 +1,170 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFragmentOutOfOrderWithCorruption(t *testing.T) {
+	payload := make([]byte, 5000)
+	for i := range payload {
+		payload[i] = byte(i)
+	}
+
+	hdr := NewPacketHeader()
+	hdr.StreamID = 7
+	hdr.Seq = 42
+	hdr.PayloadLen = uint16(len(payload))
+
+	frags, _, err := FragmentPacket(hdr, payload, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frags) < 4 {
+		t.Fatalf("expected at least 4 fragments, got %d", len(frags))
+	}
+
+	ctx := NewFragmentContext(7, 42, uint16(len(frags)))
+
+	// Повреждаем средний фрагмент
+	corrupt := append([]byte(nil), frags[2]...)
+	corrupt[HeaderSize] ^= 0xFF
+
+	var fragErr *FragmentError
+	if _, err := ctx.AddRawFragment(corrupt); !errors.As(err, &fragErr) || fragErr.FragID != 2 {
+		t.Fatalf("expected error for fragment 2, got %v", err)
+	}
+
+	// Остальные фрагменты в обратном порядке
+	for i := len(frags) - 1; i >= 0; i-- {
+		if i == 2 {
+			continue
+		}
+		if done, err := ctx.AddRawFragment(frags[i]); err != nil || done {
+			t.Fatalf("fragment %d: done=%v err=%v", i, done, err)
+		}
+	}
+
+	if missing := ctx.MissingFragments(); len(missing) != 1 || missing[0] != 2 {
+		t.Fatalf("expected only fragment 2 missing, got %v", missing)
+	}
+
+	done, err := ctx.AddRawFragment(frags[2])
+	if err != nil || !done {
+		t.Fatalf("retransmitted fragment: done=%v err=%v", done, err)
+	}
+
+	_, assembled, err := ctx.Assemble()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(assembled, payload) {
+		t.Fatal("assembled payload mismatch")
+	}
+}
+
+func TestFragmentReassemblerInterleaved(t *testing.T) {
+	r := NewFragmentReassembler()
+	defer r.Close()
+
+	makeFrags := func(seq uint32, fill byte) ([]byte, [][]byte) {
+		payload := bytes.Repeat([]byte{fill}, 3000)
+		hdr := NewPacketHeader()
+		hdr.StreamID = 1
+		hdr.Seq = seq
+		hdr.PayloadLen = uint16(len(payload))
+		frags, _, err := FragmentPacket(hdr, payload, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return payload, frags
+	}
+	payloadA, fragsA := makeFrags(10, 'a')
+	payloadB, fragsB := makeFrags(11, 'b')
+
+	results := make(map[uint32][]byte)
+	for i := range fragsA {
+		for _, frag := range [][]byte{fragsB[len(fragsB)-1-i], fragsA[i]} {
+			hdr, payload, err := r.Add(frag)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hdr != nil {
+				results[hdr.Seq] = payload
+			}
+		}
+	}
+
+	if !bytes.Equal(results[10], payloadA) || !bytes.Equal(results[11], payloadB) {
+		t.Fatal("interleaved messages were not reassembled")
+	}
+	if r.Pending() != 0 || GetReassemblyStats().ActiveContexts != 0 {
+		t.Fatal("reassembly contexts were not released")
+	}
+}
+
+func TestFragmentReassemblerProgress(t *testing.T) {
+	r := NewFragmentReassembler()
+	defer r.Close()
+
+	payload := bytes.Repeat([]byte{'p'}, 2500)
+	hdr := NewPacketHeader()
+	hdr.StreamID = 3
+	hdr.Seq = 5
+	hdr.PayloadLen = uint16(len(payload))
+	frags, _, err := FragmentPacket(hdr, payload, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, ok := r.Progress(3, 5); ok {
+		t.Fatal("progress reported before the first fragment")
+	}
+	for i, frag := range frags[:len(frags)-1] {
+		if _, _, err := r.Add(frag); err != nil {
+			t.Fatal(err)
+		}
+		received, total, got, ok := r.Progress(3, 5)
+		want := uint(i+1) * (1000 - HeaderSize - 4)
+		if !ok || int(received) != i+1 || int(total) != len(frags) || got != want {
+			t.Fatalf("progress %d/%d %d bytes, want %d/%d %d", received, total, got, i+1, len(frags), want)
+		}
+	}
+	if hdr, _, err := r.Add(frags[len(frags)-1]); err != nil || hdr == nil {
+		t.Fatalf("message not assembled: %v", err)
+	}
+	if _, _, _, ok := r.Progress(3, 5); ok {
+		t.Fatal("progress reported after assembly")
+	}
+}
+
+func TestFragmentReassemblerStreamTimeout(t *testing.T) {
+	r := NewFragmentReassembler()
+	defer r.Close()
+	r.SetStreamTimeout(1, 20*time.Millisecond)
+
+	for _, streamID := range []uint32{1, 2} {
+		hdr := NewPacketHeader()
+		hdr.StreamID = streamID
+		payload := make([]byte, 2000)
+		hdr.PayloadLen = uint16(len(payload))
+		frags, _, err := FragmentPacket(hdr, payload, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := r.Add(frags[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Сборка потока 1 просрочена, потока 2 - ждёт FragTimeoutSec
+	time.Sleep(50 * time.Millisecond)
+	if expired := r.Expire(); expired != 1 {
+		t.Fatalf("Expire() = %d, want 1", expired)
+	}
+	if _, _, _, ok := r.Progress(2, 0); !ok || r.Pending() != 1 {
+		t.Fatal("stream with the default timeout was expired")
+	}
+}
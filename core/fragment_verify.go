@@ -0,0 +1,92 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrFragmentMismatch - фрагмент относится к другому сообщению
+var ErrFragmentMismatch = errors.New("fragment does not belong to this message")
+
+// FragmentError - ошибка конкретного фрагмента (повреждён или чужой)
+// Сборка остальных фрагментов при этом продолжается
+type FragmentError struct {
+	StreamID uint32
+	Seq      uint32
+	FragID   uint16
+	Err      error
+}
+
+// Error реализует интерфейс error
+func (e *FragmentError) Error() string {
+	return fmt.Sprintf("fragment %d of stream %d seq %d: %v", e.FragID, e.StreamID, e.Seq, e.Err)
+}
+
+// Unwrap возвращает исходную ошибку
+func (e *FragmentError) Unwrap() error {
+	return e.Err
+}
+
+// AddRawFragment добавляет фрагмент в сериализованном виде
+// CRC32 проверяется для каждого фрагмента отдельно: при повреждении
+// возвращается *FragmentError с номером фрагмента, а уже принятые
+// фрагменты сохраняются - достаточно получить повреждённый повторно
+// Фрагменты принимаются в любом порядке
+// Возвращает true если все фрагменты собраны
+func (ctx *FragmentContext) AddRawFragment(data []byte) (bool, error) {
+	// Заголовок разбираем до проверки CRC, чтобы знать номер фрагмента
+	hdr, err := ParseHeader(data)
+	if err != nil {
+		return false, err
+	}
+
+	if hdr.Flags&FlagFragment == 0 || hdr.StreamID != ctx.StreamID ||
+		hdr.Seq != ctx.Seq || hdr.TotalFrags != ctx.TotalFrags {
+		return false, ctx.fragmentError(hdr.FragID, ErrFragmentMismatch)
+	}
+
+	_, payload, err := Deserialize(data)
+	if err != nil {
+		return false, ctx.fragmentError(hdr.FragID, err)
+	}
+
+	done, err := ctx.AddFragment(hdr.FragID, hdr, payload)
+	if err != nil {
+		return false, ctx.fragmentError(hdr.FragID, err)
+	}
+	return done, nil
+}
+
+// MissingFragments возвращает номера ещё не полученных фрагментов
+// Используется для запроса повторной отправки конкретных фрагментов
+func (ctx *FragmentContext) MissingFragments() []uint16 {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	var missing []uint16
+	for i := uint16(0); i < ctx.TotalFrags; i++ {
+		if ctx.Fragments[i] == nil {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// Progress возвращает число полученных фрагментов, их общее число и объём
+// полученного payload в байтах - например, для индикатора хода передачи
+// Thread-safe, в отличие от прямого чтения полей контекста
+func (ctx *FragmentContext) Progress() (received, total uint16, bytes uint) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.ReceivedFrags, ctx.TotalFrags, ctx.ReceivedPayloadSize
+}
+
+// fragmentError оборачивает ошибку в FragmentError этого контекста
+func (ctx *FragmentContext) fragmentError(fragID uint16, err error) error {
+	return &FragmentError{
+		StreamID: ctx.StreamID,
+		Seq:      ctx.Seq,
+		FragID:   fragID,
+		Err:      err,
+	}
+}
@@ -0,0 +1,123 @@
+package core
+
+import "sync"
+
+// GapFunc - callback при обнаружении пропуска sequence numbers в потоке
+// missing - количество пропущенных номеров между предыдущим и текущим пакетом
+type GapFunc func(streamID uint32, missing uint32)
+
+// GapStats - статистика детектора пропусков
+type GapStats struct {
+	Received   uint64 // Всего учтено пакетов
+	Lost       uint64 // Пропущенные номера, которые так и не пришли
+	Reordered  uint64 // Пакеты, пришедшие позже более новых (закрывают ранее учтённый пропуск)
+	Duplicates uint64 // Повторно пришедшие номера
+}
+
+// gapWindow - сколько номеров позади последнего помнит детектор: опоздавший
+// пакет старше окна не сопоставляется с пропуском и не уменьшает Lost
+const gapWindow = 64
+
+// gapStream - состояние потока в GapDetector
+type gapStream struct {
+	last uint32 // Последний (наибольший) принятый Seq
+	// missing - пропущенные номера позади last: бит i соответствует last-1-i
+	missing uint64
+}
+
+// GapDetector отслеживает последний Seq каждого потока на стороне приёма
+// и сообщает о пропусках - статистика потерь без надёжного уровня
+// Предполагается, что отправитель увеличивает Seq на 1 для каждого пакета потока
+//
+// Сравнение выполняется по модулю 2^32 (serial number arithmetic, RFC 1982):
+// номер, отстоящий вперёд менее чем на 2^31, считается новым, иначе - опоздавшим
+type GapDetector struct {
+	streams map[uint32]*gapStream
+	stats   GapStats
+	onGap   GapFunc
+	mu      sync.Mutex
+}
+
+// NewGapDetector создаёт детектор пропусков
+// onGap может быть nil - тогда пропуски только считаются
+func NewGapDetector(onGap GapFunc) *GapDetector {
+	return &GapDetector{
+		streams: make(map[uint32]*gapStream),
+		onGap:   onGap,
+	}
+}
+
+// Observe учитывает принятый пакет
+// Возвращает количество номеров, пропущенных перед ним (0, если пропуска нет)
+func (d *GapDetector) Observe(hdr *PacketHeader) uint32 {
+	d.mu.Lock()
+	missing := d.observeLocked(hdr.StreamID, hdr.Seq)
+	onGap := d.onGap
+	d.mu.Unlock()
+
+	if missing > 0 && onGap != nil {
+		onGap(hdr.StreamID, missing)
+	}
+	return missing
+}
+
+// observeLocked обновляет состояние потока
+// Вызывается с захваченным d.mu
+func (d *GapDetector) observeLocked(streamID, seq uint32) uint32 {
+	d.stats.Received++
+
+	st, ok := d.streams[streamID]
+	if !ok {
+		// Первый пакет потока
+		d.streams[streamID] = &gapStream{last: seq}
+		return 0
+	}
+
+	diff := seq - st.last // Переполнение uint32 даёт корректную разность по модулю 2^32
+	switch {
+	case diff == 0:
+		d.stats.Duplicates++
+		return 0
+	case diff < 1<<31:
+		// Пакет новее последнего: всё, что между ними, пока считается потерянным
+		missing := diff - 1
+		d.stats.Lost += uint64(missing)
+		st.last = seq
+		if diff >= gapWindow {
+			st.missing = ^uint64(0)
+		} else {
+			st.missing = st.missing<<diff | (1<<missing - 1)
+		}
+		return missing
+	}
+
+	// Опоздавший пакет уменьшает Lost, только если закрывает учтённый пропуск
+	back := st.last - seq - 1
+	if back >= gapWindow {
+		d.stats.Reordered++
+		return 0
+	}
+	bit := uint64(1) << back
+	if st.missing&bit == 0 {
+		d.stats.Duplicates++
+		return 0
+	}
+	st.missing &^= bit
+	d.stats.Reordered++
+	d.stats.Lost--
+	return 0
+}
+
+// Forget удаляет состояние потока (например, при его закрытии)
+func (d *GapDetector) Forget(streamID uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.streams, streamID)
+}
+
+// Stats возвращает статистику детектора
+func (d *GapDetector) Stats() GapStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
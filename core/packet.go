@@ -3,9 +3,13 @@ package core
 import (
 	"encoding/binary"
 	"errors"
+	"io"
 	"time"
 )
 
+// ErrCRCMismatch - CRC32 пакета не совпал с вычисленным
+var ErrCRCMismatch = errors.New("CRC32 mismatch")
+
 // PacketHeader - заголовок пакета OverProto (24 байта)
 // Все multi-byte поля должны быть в network byte order (big-endian) при сериализации
 type PacketHeader struct {
@@ -23,6 +27,12 @@ type PacketHeader struct {
 	CRC32      uint32 // CRC32 (вычисляется, но хранится в заголовке)
 }
 
+// Packet - принятый пакет: заголовок и payload
+type Packet struct {
+	Header  *PacketHeader
+	Payload []byte
+}
+
 // ValidateHeader проверяет Magic и Version заголовка
 func ValidateHeader(hdr *PacketHeader) error {
 	if hdr.Magic != Magic {
@@ -36,7 +46,18 @@ func ValidateHeader(hdr *PacketHeader) error {
 
 // Serialize сериализует пакет в буфер
 // Возвращает: [Header 24 bytes] [Payload] [CRC32 4 bytes]
+// payload копируется в новый буфер и не изменяется и не сохраняется
 func Serialize(hdr *PacketHeader, payload []byte) ([]byte, error) {
+	start := codecStart()
+	buf, err := serialize(hdr, payload)
+	if err == nil {
+		encodeStats.add(len(buf), start)
+	}
+	return buf, err
+}
+
+// serialize - Serialize без учёта в статистике кодека
+func serialize(hdr *PacketHeader, payload []byte) ([]byte, error) {
 	// Проверка длины payload
 	if len(payload) > 65535 {
 		return nil, errors.New("payload too large (max 65535 bytes)")
@@ -74,10 +95,17 @@ func Serialize(hdr *PacketHeader, payload []byte) ([]byte, error) {
 
 	// Вычисляем CRC32 для (Header + Payload)
 	// CRC32 вычисляется для заголовка (где поле CRC32 = 0) + payload
-	crcCtx := NewCRC32()
-	crcCtx.Update(headerBuf)
-	crcCtx.Update(payload)
-	crc32Value := crcCtx.Final()
+	// Для опкодов из SetSkipCRCOpcodes поле CRC32 остаётся нулевым
+	var crc32Value uint32
+	if !SkipsCRC(hdr.Opcode) {
+		crcCtx := acquireCRC32()
+		if GetCRCScope() == CRCHeaderAndPayload {
+			crcCtx.Update(headerBuf)
+		}
+		crcCtx.Update(payload)
+		crc32Value = crcCtx.Final()
+		releaseCRC32(crcCtx)
+	}
 
 	// В C версии заголовок копируется в буфер с обнуленным полем crc32
 	// Поэтому не восстанавливаем Timestamp - поле crc32 должно остаться 0 в отправленном пакете
@@ -91,16 +119,15 @@ func Serialize(hdr *PacketHeader, payload []byte) ([]byte, error) {
 	return result, nil
 }
 
-// Deserialize десериализует пакет из буфера
-// Проверяет Magic, Version и CRC32
-// Возвращает заголовок, payload и ошибку
-func Deserialize(data []byte) (*PacketHeader, []byte, error) {
-	// Проверяем минимальный размер (Header + CRC32)
-	if len(data) < HeaderSize+4 {
-		return nil, nil, errors.New("data too short for packet")
+// ParseHeader разбирает только заголовок из первых HeaderSize байт data
+// Проверяет Magic и Version, но не payload и не CRC32 - подходит для
+// маршрутизации по StreamID/Opcode/Proto сразу после прихода заголовка
+// Байты после заголовка игнорируются
+func ParseHeader(data []byte) (*PacketHeader, error) {
+	if len(data) < HeaderSize {
+		return nil, errors.New("data too short for header")
 	}
 
-	// Читаем заголовок
 	hdr := &PacketHeader{}
 	hdr.Magic = binary.BigEndian.Uint16(data[0:2])
 	hdr.Version = data[2]
@@ -118,6 +145,155 @@ func Deserialize(data []byte) (*PacketHeader, []byte, error) {
 
 	// Проверяем Magic и Version
 	if err := ValidateHeader(hdr); err != nil {
+		return nil, err
+	}
+
+	return hdr, nil
+}
+
+// SerializeTo записывает пакет в w без сборки всего пакета в памяти
+// Заголовок и payload передаются в w как есть, CRC32 вычисляется по мере записи
+// Формат совпадает с Serialize; возвращает количество записанных байт
+func SerializeTo(w io.Writer, hdr *PacketHeader, payload []byte) (int, error) {
+	n, err := serializeTo(w, hdr, payload)
+	if err == nil {
+		encodeStats.add(n, time.Time{})
+	}
+	return n, err
+}
+
+// serializeTo - SerializeTo без учёта в статистике кодека
+func serializeTo(w io.Writer, hdr *PacketHeader, payload []byte) (int, error) {
+	if len(payload) > 65535 {
+		return 0, errors.New("payload too large (max 65535 bytes)")
+	}
+
+	var headerBuf [HeaderSize]byte
+	putHeader(headerBuf[:], hdr)
+
+	crcCtx := acquireCRC32()
+	defer releaseCRC32(crcCtx)
+
+	written := 0
+	if GetCRCScope() == CRCHeaderAndPayload {
+		crcCtx.Update(headerBuf[:])
+	}
+	n, err := w.Write(headerBuf[:])
+	written += n
+	if err != nil {
+		return written, err
+	}
+
+	if len(payload) > 0 {
+		crcCtx.Update(payload)
+		n, err = w.Write(payload)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+
+	var crcBuf [4]byte
+	if !SkipsCRC(hdr.Opcode) {
+		binary.BigEndian.PutUint32(crcBuf[:], crcCtx.Final())
+	}
+	n, err = w.Write(crcBuf[:])
+	written += n
+	return written, err
+}
+
+// AppendPacket дописывает сериализованный пакет в конец dst и возвращает результат
+// Формат совпадает с Serialize. Если ёмкости dst достаточно, память не выделяется -
+// позволяет отправлять пакеты из переиспользуемого буфера
+func AppendPacket(dst []byte, hdr *PacketHeader, payload []byte) ([]byte, error) {
+	start := codecStart()
+	out, err := appendPacket(dst, hdr, payload)
+	if err == nil {
+		encodeStats.add(len(out)-len(dst), start)
+	}
+	return out, err
+}
+
+// appendPacket - AppendPacket без учёта в статистике кодека
+func appendPacket(dst []byte, hdr *PacketHeader, payload []byte) ([]byte, error) {
+	if len(payload) > 65535 {
+		return dst, errors.New("payload too large (max 65535 bytes)")
+	}
+
+	start := len(dst)
+	size := HeaderSize + len(payload) + 4
+	if cap(dst)-start < size {
+		grown := make([]byte, start, start+size)
+		copy(grown, dst)
+		dst = grown
+	}
+	dst = dst[:start+size]
+
+	packet := dst[start:]
+	putHeader(packet[:HeaderSize], hdr)
+	copy(packet[HeaderSize:], payload)
+
+	var crc32Value uint32
+	if !SkipsCRC(hdr.Opcode) {
+		crcCtx := acquireCRC32()
+		if GetCRCScope() == CRCHeaderAndPayload {
+			crcCtx.Update(packet[:HeaderSize])
+		}
+		crcCtx.Update(payload)
+		crc32Value = crcCtx.Final()
+		releaseCRC32(crcCtx)
+	}
+	binary.BigEndian.PutUint32(packet[HeaderSize+len(payload):], crc32Value)
+
+	return dst, nil
+}
+
+// EncodeHeader возвращает заголовок в том виде, в каком он передаётся по сети
+// (байты 20-23 нулевые) - для вычислений над заголовком, например HMAC
+func EncodeHeader(hdr *PacketHeader) [HeaderSize]byte {
+	var buf [HeaderSize]byte
+	putHeader(buf[:], hdr)
+	return buf
+}
+
+// putHeader записывает заголовок в buf (не меньше HeaderSize) в network byte order
+// Байты 20-23 (поле CRC32 в C версии) всегда нулевые, как в Serialize
+func putHeader(buf []byte, hdr *PacketHeader) {
+	binary.BigEndian.PutUint16(buf[0:2], hdr.Magic)
+	buf[2] = hdr.Version
+	buf[3] = hdr.Flags
+	buf[4] = hdr.Opcode
+	buf[5] = hdr.Proto
+	binary.BigEndian.PutUint32(buf[6:10], hdr.StreamID)
+	binary.BigEndian.PutUint32(buf[10:14], hdr.Seq)
+	binary.BigEndian.PutUint16(buf[14:16], hdr.FragID)
+	binary.BigEndian.PutUint16(buf[16:18], hdr.TotalFrags)
+	binary.BigEndian.PutUint16(buf[18:20], hdr.PayloadLen)
+	binary.BigEndian.PutUint32(buf[20:24], 0)
+}
+
+// Deserialize десериализует пакет из буфера
+// Проверяет Magic, Version и CRC32
+// Возвращает заголовок, payload и ошибку
+func Deserialize(data []byte) (*PacketHeader, []byte, error) {
+	start := codecStart()
+	hdr, payload, err := deserialize(data)
+	if err == nil {
+		decodeStats.add(len(data), start)
+	}
+	return hdr, payload, err
+}
+
+// deserialize - Deserialize без учёта в статистике кодека
+func deserialize(data []byte) (*PacketHeader, []byte, error) {
+	// Проверяем минимальный размер (Header + CRC32)
+	if len(data) < HeaderSize+4 {
+		return nil, nil, errors.New("data too short for packet")
+	}
+
+	// Читаем и проверяем заголовок
+	hdr, err := ParseHeader(data)
+	if err != nil {
 		return nil, nil, err
 	}
 
@@ -133,6 +309,11 @@ func Deserialize(data []byte) (*PacketHeader, []byte, error) {
 		copy(payload, data[payloadStart:payloadEnd])
 	}
 
+	// Для опкодов из SetSkipCRCOpcodes CRC32 не проверяется
+	if SkipsCRC(hdr.Opcode) {
+		return hdr, payload, nil
+	}
+
 	// Читаем CRC32 из конца пакета
 	crc32Received := binary.BigEndian.Uint32(data[len(data)-4:])
 
@@ -140,14 +321,17 @@ func Deserialize(data []byte) (*PacketHeader, []byte, error) {
 	// В C версии при десериализации CRC32 вычисляется для заголовка из буфера напрямую
 	// В отправленном пакете поле crc32 уже равно 0 (было обнулено при сериализации)
 	// Поэтому вычисляем CRC32 для заголовка из буфера напрямую (как в C версии)
-	crcCtx := NewCRC32()
-	crcCtx.Update(data[0:HeaderSize]) // Заголовок из буфера (где crc32 уже = 0)
+	crcCtx := acquireCRC32()
+	if GetCRCScope() == CRCHeaderAndPayload {
+		crcCtx.Update(data[0:HeaderSize]) // Заголовок из буфера (где crc32 уже = 0)
+	}
 	crcCtx.Update(payload)
 	crc32Computed := crcCtx.Final()
+	releaseCRC32(crcCtx)
 
 	// Проверяем CRC32
 	if crc32Received != crc32Computed {
-		return nil, nil, errors.New("CRC32 mismatch")
+		return nil, nil, ErrCRCMismatch
 	}
 
 	return hdr, payload, nil
@@ -0,0 +1,38 @@
+package core
+
+import "testing"
+
+func benchmarkPacket(size int) (*PacketHeader, []byte) {
+	hdr := NewPacketHeader()
+	hdr.StreamID = 1
+	hdr.Opcode = OpData
+	hdr.PayloadLen = uint16(size)
+	return hdr, make([]byte, size)
+}
+
+func BenchmarkSerialize(b *testing.B) {
+	hdr, payload := benchmarkPacket(1024)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Serialize(hdr, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDeserialize(b *testing.B) {
+	hdr, payload := benchmarkPacket(1024)
+	data, err := Serialize(hdr, payload)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(payload)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, err := Deserialize(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
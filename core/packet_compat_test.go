@@ -1,7 +1,10 @@
 package core
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"hash/crc32"
 	"testing"
 )
 
@@ -117,3 +120,186 @@ func TestCRC32Compatibility(t *testing.T) {
 	}
 }
 
+
+// TestCRC32Reset проверяет переиспользование контекста после Reset
+func TestCRC32Reset(t *testing.T) {
+	ctx := NewCRC32()
+	ctx.Update([]byte("first packet"))
+	_ = ctx.Final()
+
+	ctx.Reset()
+	ctx.Update([]byte("Hello, OverProto!"))
+	if got, want := ctx.Final(), ComputeCRC32([]byte("Hello, OverProto!")); got != want {
+		t.Errorf("CRC32 after Reset mismatch: got 0x%08X, expected 0x%08X", got, want)
+	}
+}
+
+func TestGapDetectorWraparoundAndReorder(t *testing.T) {
+	var reported []uint32
+	d := NewGapDetector(func(streamID, missing uint32) {
+		reported = append(reported, missing)
+	})
+
+	observe := func(seq uint32) uint32 {
+		return d.Observe(&PacketHeader{StreamID: 1, Seq: seq})
+	}
+
+	observe(0xFFFFFFFE)
+	if m := observe(0xFFFFFFFF); m != 0 {
+		t.Fatalf("expected no gap, got %d", m)
+	}
+	// Переход через 0 не является пропуском, 1 пропущен
+	if m := observe(2); m != 2 {
+		t.Fatalf("expected 2 missing across wraparound, got %d", m)
+	}
+	// Опоздавший пакет закрывает пропуск
+	if m := observe(0); m != 0 {
+		t.Fatalf("late packet reported as gap: %d", m)
+	}
+	observe(2)
+
+	stats := d.Stats()
+	if stats.Lost != 1 || stats.Reordered != 1 || stats.Duplicates != 1 || stats.Received != 5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if len(reported) != 1 || reported[0] != 2 {
+		t.Fatalf("unexpected callbacks: %v", reported)
+	}
+}
+
+func TestGapDetectorLateDuplicatesKeepLoss(t *testing.T) {
+	d := NewGapDetector(nil)
+	observe := func(streamID, seq uint32) {
+		d.Observe(&PacketHeader{StreamID: streamID, Seq: seq})
+	}
+
+	// Поток 1: пропущены 2 и 3; поток 2: без потерь
+	for _, seq := range []uint32{1, 4, 5} {
+		observe(1, seq)
+	}
+	for _, seq := range []uint32{1, 2, 3} {
+		observe(2, seq)
+	}
+	// Повторы уже принятых номеров не закрывают пропуски
+	observe(1, 1)
+	observe(2, 2)
+	observe(2, 1)
+	if stats := d.Stats(); stats.Lost != 2 || stats.Duplicates != 3 || stats.Reordered != 0 {
+		t.Fatalf("duplicates changed loss: %+v", stats)
+	}
+
+	// Опоздавший 3 закрывает пропуск один раз
+	observe(1, 3)
+	observe(1, 3)
+	if stats := d.Stats(); stats.Lost != 1 || stats.Reordered != 1 || stats.Duplicates != 4 {
+		t.Fatalf("unexpected stats after late packet: %+v", stats)
+	}
+}
+
+func TestCRCPayloadOnlyScope(t *testing.T) {
+	if err := SetCRCScope(CRCPayloadOnly); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = SetCRCScope(CRCHeaderAndPayload) }()
+
+	payload := []byte("payload")
+	hdr := NewPacketHeader()
+	hdr.PayloadLen = uint16(len(payload))
+	data, err := Serialize(hdr, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := binary.BigEndian.Uint32(data[len(data)-4:])
+	if want := crc32.ChecksumIEEE(payload); got != want {
+		t.Fatalf("CRC32 = %08x, want %08x", got, want)
+	}
+
+	// Заголовок не покрыт CRC: изменение StreamID не обнаруживается
+	data[9] ^= 0xFF
+	if _, _, err := Deserialize(data); err != nil {
+		t.Fatalf("Deserialize failed: %v", err)
+	}
+}
+
+func TestSkipCRCOpcodes(t *testing.T) {
+	SetSkipCRCOpcodes([]uint8{OpACK})
+	defer SetSkipCRCOpcodes(nil)
+
+	ack := NewPacketHeader()
+	ack.Opcode = OpACK
+	ack.Seq = 5
+	data, err := Serialize(ack, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if crc := binary.BigEndian.Uint32(data[len(data)-4:]); crc != 0 {
+		t.Fatalf("ACK CRC32 = %08x, want 0", crc)
+	}
+	if appended, err := AppendPacket(nil, ack, nil); err != nil || !bytes.Equal(appended, data) {
+		t.Fatalf("AppendPacket differs from Serialize: %v", err)
+	}
+	if _, _, err := Deserialize(data); err != nil {
+		t.Fatalf("ACK without CRC32 rejected: %v", err)
+	}
+
+	// Пакеты данных по-прежнему проверяются
+	payload := []byte("data")
+	hdr := NewPacketHeader()
+	hdr.PayloadLen = uint16(len(payload))
+	data, err = Serialize(hdr, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[HeaderSize] ^= 0xFF
+	if _, _, err := Deserialize(data); !errors.Is(err, ErrCRCMismatch) {
+		t.Fatalf("expected ErrCRCMismatch for data packet, got %v", err)
+	}
+}
+
+func TestSerializeToMatchesSerialize(t *testing.T) {
+	payload := []byte("streamed payload")
+	hdr := NewPacketHeader()
+	hdr.StreamID = 42
+	hdr.PayloadLen = uint16(len(payload))
+
+	want, err := Serialize(hdr, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	n, err := SerializeTo(&buf, hdr, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(want) || !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("SerializeTo = %x (%d), want %x", buf.Bytes(), n, want)
+	}
+}
+
+func TestReassemblyLimits(t *testing.T) {
+	SetReassemblyLimits(1, 10)
+	defer SetReassemblyLimits(0, 0)
+
+	ctx, err := AcquireFragmentContext(1, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AcquireFragmentContext(1, 2, 2); err != ErrReassemblyLimit {
+		t.Fatalf("expected context limit, got %v", err)
+	}
+
+	if _, err := ctx.AddFragment(0, &PacketHeader{}, make([]byte, 8)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ctx.AddFragment(1, &PacketHeader{}, make([]byte, 8)); err != ErrReassemblyLimit {
+		t.Fatalf("expected byte limit, got %v", err)
+	}
+
+	ctx.Release()
+	stats := GetReassemblyStats()
+	if stats.ActiveContexts != 0 || stats.BufferedBytes != 0 || stats.Dropped != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
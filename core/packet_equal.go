@@ -0,0 +1,30 @@
+package core
+
+import "bytes"
+
+// Equal сравнивает заголовки по всем полям, кроме Timestamp и CRC32:
+// они меняются при каждой отправке и на проводе не передаются
+// Два nil заголовка равны
+func (hdr *PacketHeader) Equal(other *PacketHeader) bool {
+	if hdr == nil || other == nil {
+		return hdr == other
+	}
+	a, b := *hdr, *other
+	a.Timestamp, b.Timestamp = 0, 0
+	a.CRC32, b.CRC32 = 0, 0
+	return a == b
+}
+
+// EqualExact сравнивает заголовки по всем полям, включая Timestamp и CRC32
+func (hdr *PacketHeader) EqualExact(other *PacketHeader) bool {
+	if hdr == nil || other == nil {
+		return hdr == other
+	}
+	return *hdr == *other
+}
+
+// Equal сравнивает пакеты: заголовки как PacketHeader.Equal и payload побайтно
+// (nil и пустой payload равны)
+func (p Packet) Equal(other Packet) bool {
+	return p.Header.Equal(other.Header) && bytes.Equal(p.Payload, other.Payload)
+}
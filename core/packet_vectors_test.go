@@ -0,0 +1,98 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// packetVectors - эталонные сериализованные пакеты (формат C версии)
+// Байты 20-23 (Timestamp/CRC32 в C версии) на проводе всегда равны 0,
+// CRC32 - стандартный CRC-32 IEEE 802.3 над заголовком и payload
+var packetVectors = []struct {
+	name    string
+	hdr     PacketHeader
+	payload []byte
+	wire    string
+}{
+	{
+		name: "empty ping",
+		hdr:  PacketHeader{Magic: Magic, Version: Version, Opcode: OpPing, Proto: ProtoTCP},
+		wire: "abcd0100040100000000000000000000000000000000000081527856",
+	},
+	{
+		name:    "data over TCP",
+		hdr:     PacketHeader{Magic: Magic, Version: Version, Opcode: OpData, Proto: ProtoTCP, StreamID: 1, PayloadLen: 5},
+		payload: []byte("hello"),
+		wire:    "abcd0100010100000001000000000000000000050000000068656c6c6fbf106dbd",
+	},
+	{
+		name: "reliable data over UDP",
+		hdr: PacketHeader{Magic: Magic, Version: Version, Flags: FlagReliable, Opcode: OpData, Proto: ProtoUDP,
+			StreamID: 0x12345678, Seq: 0x87654321, PayloadLen: 4},
+		payload: []byte{0xDE, 0xAD, 0xBE, 0xEF},
+		wire:    "abcd01080102123456788765432100000000000400000000deadbeefa28d2c50",
+	},
+	{
+		name: "fragment 2 of 3",
+		hdr: PacketHeader{Magic: Magic, Version: Version, Flags: FlagFragment, Opcode: OpData, Proto: ProtoUDP,
+			StreamID: 7, Seq: 42, FragID: 2, TotalFrags: 3, PayloadLen: 3},
+		payload: []byte("abc"),
+		wire:    "abcd01010102000000070000002a000200030003000000006162636b1ad91f",
+	},
+	{
+		name: "ACK with timestamp (not transmitted)",
+		hdr: PacketHeader{Magic: Magic, Version: Version, Flags: FlagACK | FlagReliable, Opcode: OpACK, Proto: ProtoUDP,
+			Seq: 9, Timestamp: 0x65000000},
+		wire: "abcd01180302000000000000000900000000000000000000d61b7d73",
+	},
+}
+
+// TestPacketVectors проверяет сериализацию и десериализацию эталонных пакетов
+func TestPacketVectors(t *testing.T) {
+	for _, tc := range packetVectors {
+		t.Run(tc.name, func(t *testing.T) {
+			want, err := hex.DecodeString(tc.wire)
+			if err != nil {
+				t.Fatalf("invalid test vector: %v", err)
+			}
+
+			hdr := tc.hdr
+			got, err := Serialize(&hdr, tc.payload)
+			if err != nil {
+				t.Fatalf("Serialize failed: %v", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("wire mismatch:\n got %x\nwant %x", got, want)
+			}
+
+			parsed, payload, err := Deserialize(want)
+			if err != nil {
+				t.Fatalf("Deserialize failed: %v", err)
+			}
+			decoded := Packet{Header: parsed, Payload: payload}
+			if !decoded.Equal(Packet{Header: &tc.hdr, Payload: tc.payload}) {
+				t.Errorf("packet mismatch after Deserialize: %+v %x", parsed, payload)
+			}
+		})
+	}
+}
+
+func TestPacketHeaderEqual(t *testing.T) {
+	a := NewPacketHeader()
+	a.StreamID = 3
+	b := *a
+	b.Timestamp++
+	b.CRC32 = 0xDEADBEEF
+
+	if !a.Equal(&b) || a.EqualExact(&b) {
+		t.Fatal("Timestamp and CRC32 must be ignored only by Equal")
+	}
+	b.Seq++
+	if a.Equal(&b) {
+		t.Fatal("headers with different Seq are equal")
+	}
+	if a.Equal(nil) || !(*PacketHeader)(nil).Equal(nil) {
+		t.Fatal("nil headers compared incorrectly")
+	}
+}
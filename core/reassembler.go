@@ -0,0 +1,161 @@
+package core
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// fragmentKey - ключ сборки: одно сообщение потока
+type fragmentKey struct {
+	streamID uint32
+	seq      uint32
+}
+
+// FragmentReassembler направляет принятые фрагменты в контексты сборки
+// по (StreamID, Seq), поэтому несколько больших сообщений одного потока
+// с разными Seq собираются одновременно
+// Контексты учитываются в глобальных лимитах (см. SetReassemblyLimits)
+// Адрес отправителя в ключ не входит: при приёме от нескольких удалённых
+// сторон нужен отдельный сборщик на каждую, иначе фрагменты сообщений
+// разных отправителей с одинаковыми (StreamID, Seq) смешаются
+type FragmentReassembler struct {
+	contexts map[fragmentKey]*FragmentContext
+	timeout  time.Duration            // Для новых сборок; 0 - FragTimeoutSec
+	streams  map[uint32]time.Duration // Таймауты отдельных потоков (SetStreamTimeout)
+	mu       sync.Mutex
+}
+
+// NewFragmentReassembler создаёт сборщик фрагментов
+func NewFragmentReassembler() *FragmentReassembler {
+	return &FragmentReassembler{
+		contexts: make(map[fragmentKey]*FragmentContext),
+		streams:  make(map[uint32]time.Duration),
+	}
+}
+
+// SetTimeout задаёт время, за которое должна завершиться сборка сообщения,
+// для сборок, начатых после вызова. 0 - FragTimeoutSec
+func (r *FragmentReassembler) SetTimeout(d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.timeout = d
+}
+
+// SetStreamTimeout задаёт время сборки сообщений потока streamID вместо
+// SetTimeout - например, 2 секунды для потока реального времени и
+// 5 минут для большой передачи по медленному каналу. 0 снимает настройку
+// Применяется к сборкам, начатым после вызова
+func (r *FragmentReassembler) SetStreamTimeout(streamID uint32, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d <= 0 {
+		delete(r.streams, streamID)
+		return
+	}
+	r.streams[streamID] = d
+}
+
+// Add обрабатывает принятый пакет в сериализованном виде
+// Пакет без FlagFragment десериализуется и возвращается сразу
+// Для фрагмента возвращает собранное сообщение, когда получены все части,
+// иначе nil, nil, nil. Ошибки отдельных фрагментов - *FragmentError
+func (r *FragmentReassembler) Add(data []byte) (*PacketHeader, []byte, error) {
+	hdr, err := ParseHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	if hdr.Flags&FlagFragment == 0 {
+		return Deserialize(data)
+	}
+	if hdr.TotalFrags == 0 || hdr.TotalFrags > FragMaxFragments {
+		return nil, nil, errors.New("invalid total fragments count")
+	}
+
+	key := fragmentKey{streamID: hdr.StreamID, seq: hdr.Seq}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx, ok := r.contexts[key]
+	if !ok {
+		ctx, err = AcquireFragmentContext(hdr.StreamID, hdr.Seq, hdr.TotalFrags)
+		if errors.Is(err, ErrReassemblyLimit) && r.expireLocked() > 0 {
+			// Освободили просроченные сборки - пробуем ещё раз
+			ctx, err = AcquireFragmentContext(hdr.StreamID, hdr.Seq, hdr.TotalFrags)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if d, ok := r.streams[hdr.StreamID]; ok {
+			ctx.SetTimeout(d)
+		} else {
+			ctx.SetTimeout(r.timeout)
+		}
+		r.contexts[key] = ctx
+	}
+
+	done, err := ctx.AddRawFragment(data)
+	if err != nil || !done {
+		return nil, nil, err
+	}
+
+	delete(r.contexts, key)
+	defer ctx.Release()
+	return ctx.Assemble()
+}
+
+// Pending возвращает количество незавершённых сборок
+func (r *FragmentReassembler) Pending() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.contexts)
+}
+
+// Progress возвращает ход сборки сообщения (streamID, seq): полученные
+// фрагменты, их общее число и полученные байты payload
+// ok == false, если сборка не начата или уже завершена
+func (r *FragmentReassembler) Progress(streamID, seq uint32) (received, total uint16, bytes uint, ok bool) {
+	r.mu.Lock()
+	ctx, ok := r.contexts[fragmentKey{streamID: streamID, seq: seq}]
+	r.mu.Unlock()
+	if !ok {
+		return 0, 0, 0, false
+	}
+	received, total, bytes = ctx.Progress()
+	return received, total, bytes, true
+}
+
+// Expire удаляет сборки, не завершившиеся за своё время (SetTimeout,
+// SetStreamTimeout, по умолчанию FragTimeoutSec)
+// Возвращает количество удалённых сборок
+func (r *FragmentReassembler) Expire() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.expireLocked()
+}
+
+// expireLocked удаляет просроченные сборки
+// Вызывается с захваченным r.mu
+func (r *FragmentReassembler) expireLocked() int {
+	expired := 0
+	for key, ctx := range r.contexts {
+		if ctx.IsTimeout() {
+			delete(r.contexts, key)
+			ctx.Release()
+			expired++
+		}
+	}
+	return expired
+}
+
+// Close удаляет все незавершённые сборки и освобождает их память
+func (r *FragmentReassembler) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for key, ctx := range r.contexts {
+		delete(r.contexts, key)
+		ctx.Release()
+	}
+}
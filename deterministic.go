@@ -0,0 +1,48 @@
+package overproto
+
+import (
+	"math/rand"
+	"sync"
+
+	"github.com/nickolajgrishuk/overproto-go/optimize"
+	"github.com/nickolajgrishuk/overproto-go/transport"
+)
+
+// seededReader - потокобезопасный io.Reader поверх math/rand с зерном
+type seededReader struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// newSeededReader создаёт воспроизводимый источник байт
+func newSeededReader(seed int64) *seededReader {
+	return &seededReader{rnd: rand.New(rand.NewSource(seed))} //nolint:gosec // только для тестов
+}
+
+// Read реализует io.Reader
+func (r *seededReader) Read(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rnd.Read(p)
+}
+
+// SetDeterministic делает всю случайность библиотеки воспроизводимой по seed:
+// IV шифрования (SetIVSource), соль счётчика nonce, разброс RTO
+// ретрансмиссий, идентификаторы соединений и миграции, токены проверки адреса,
+// начальный Seq фрагментированных сообщений Send
+// Каждая подсистема получает свой генератор, поэтому при одинаковом порядке
+// вызовов прогоны дают побайтно одинаковый результат (golden тесты)
+// Можно вызывать как до, так и после Init: Init не заменяет заданные здесь
+// источники случайными
+// ТОЛЬКО ДЛЯ ТЕСТОВ: предсказуемые IV и токены полностью ломают шифрование
+// и проверку адреса. Действует до Shutdown
+func SetDeterministic(seed int64) {
+	mu.Lock()
+	deterministic = true
+	mu.Unlock()
+
+	optimize.SetIVSource(newSeededReader(seed))
+	optimize.SetRandSource(newSeededReader(seed + 1))
+	transport.SetRandSource(newSeededReader(seed + 2))
+	seedFragmentSeq(newSeededReader(seed + 3))
+}
@@ -88,9 +88,8 @@ func runServer(port uint16) {
 }
 
 func handleEncryptedConnection(conn net.Conn) {
-	defer conn.Close()
-
 	tcpConn := overproto.NewTCPConnection(conn)
+	defer tcpConn.Close()
 
 	for {
 		hdr, payload, err := overproto.TCPRecv(tcpConn)
@@ -105,7 +104,7 @@ func handleEncryptedConnection(conn net.Conn) {
 		// Эхо-ответ с шифрованием
 		echoData := []byte(fmt.Sprintf("Encrypted echo: %s", string(payload)))
 		_, err = overproto.Send(
-			conn,
+			tcpConn,
 			hdr.StreamID,
 			overproto.OpData,
 			overproto.ProtoTCP,
@@ -124,7 +123,8 @@ func runClient(host string, port uint16) {
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
-	defer conn.Close()
+	tcpConn := overproto.NewTCPConnection(conn)
+	defer tcpConn.Close()
 
 	log.Println("Connected successfully!")
 
@@ -145,7 +145,7 @@ func runClient(host string, port uint16) {
 				data := []byte(fmt.Sprintf("Encrypted message #%d", messageNum))
 
 				sent, err := overproto.Send(
-					conn,
+					tcpConn,
 					1,
 					overproto.OpData,
 					overproto.ProtoTCP,
@@ -166,7 +166,6 @@ func runClient(host string, port uint16) {
 	}()
 
 	// Горутина для приёма данных
-	tcpConn := overproto.NewTCPConnection(conn)
 	go func() {
 		for {
 			hdr, payload, err := overproto.TCPRecv(tcpConn)
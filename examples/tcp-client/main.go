@@ -38,7 +38,9 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to connect: %v", err)
 	}
-	defer conn.Close()
+	// Отправка и приём через tcpConn: обмен учитывается в LastActivity
+	tcpConn := overproto.NewTCPConnection(conn)
+	defer tcpConn.Close()
 
 	log.Println("Connected successfully!")
 
@@ -59,7 +61,7 @@ func main() {
 				data := []byte(fmt.Sprintf("Message #%d from TCP client", messageNum))
 
 				sent, err := overproto.Send(
-					conn,
+					tcpConn,
 					1,                  // streamID
 					overproto.OpData,   // opcode
 					overproto.ProtoTCP, // протокол
@@ -80,7 +82,6 @@ func main() {
 	}()
 
 	// Горутина для приёма данных
-	tcpConn := overproto.NewTCPConnection(conn)
 	go func() {
 		for {
 			hdr, payload, err := overproto.TCPRecv(tcpConn)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -16,9 +17,8 @@ import (
 )
 
 var (
-	clients     = make(map[net.Conn]bool)
-	clientsMu   sync.RWMutex
-	clientCount int
+	clients   = make(map[*overproto.TCPConnection]bool)
+	clientsMu sync.RWMutex
 )
 
 func main() {
@@ -59,24 +59,20 @@ func main() {
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 
 	// Горутина для принятия соединений
+	conns, acceptErrs := overproto.AcceptChan(listener)
 	go func() {
-		for {
-			conn, err := listener.Accept()
-			if err != nil {
-				log.Printf("Accept error: %v", err)
-				return
-			}
-
+		for conn := range conns {
+			// Закрытие через tcpConn.Close() удаляет соединение из статистики
+			tcpConn := overproto.NewTCPConnection(conn)
 			clientsMu.Lock()
-			clients[conn] = true
-			clientCount++
-			clientID := clientCount
+			clients[tcpConn] = true
 			clientsMu.Unlock()
 
-			log.Printf("Client #%d connected from %s", clientID, conn.RemoteAddr())
-
 			// Обработка соединения в отдельной горутине
-			go handleClient(conn, clientID)
+			go handleClient(tcpConn)
+		}
+		if err := <-acceptErrs; err != nil {
+			log.Printf("Accept error: %v", err)
 		}
 	}()
 
@@ -96,19 +92,22 @@ func main() {
 	log.Println("Server stopped")
 }
 
-func handleClient(conn net.Conn, clientID int) {
+func handleClient(tcpConn *overproto.TCPConnection) {
+	// ID соединения связывает строки журнала одного клиента;
+	// ошибки приёма и отправки через tcpConn уже содержат его
+	clientID := tcpConn.ID()
+	log.Printf("Client %s connected from %s", clientID, tcpConn.Conn().RemoteAddr())
+
 	defer func() {
 		clientsMu.Lock()
-		delete(clients, conn)
+		delete(clients, tcpConn)
 		clientsMu.Unlock()
-		if err := conn.Close(); err != nil {
-			log.Printf("Error closing client #%d connection: %v", clientID, err)
+		if err := tcpConn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("Error closing client %s connection: %v", clientID, err)
 		}
-		log.Printf("Client #%d disconnected", clientID)
+		log.Printf("Client %s disconnected", clientID)
 	}()
 
-	tcpConn := overproto.NewTCPConnection(conn)
-
 	// Горутина для отправки периодических сообщений клиенту
 	go func() {
 		ticker := time.NewTicker(5 * time.Second)
@@ -119,10 +118,10 @@ func handleClient(conn net.Conn, clientID int) {
 			select {
 			case <-ticker.C:
 				messageNum++
-				data := []byte(fmt.Sprintf("Server message #%d to client #%d", messageNum, clientID))
+				data := []byte(fmt.Sprintf("Server message #%d to client %s", messageNum, clientID))
 
 				sent, err := overproto.Send(
-					conn,
+					tcpConn,
 					1,                    // streamID
 					overproto.OpData,     // opcode
 					overproto.ProtoTCP,   // протокол
@@ -130,11 +129,11 @@ func handleClient(conn net.Conn, clientID int) {
 					0,                    // флаги
 				)
 				if err != nil {
-					log.Printf("Failed to send to client #%d: %v", clientID, err)
+					log.Printf("Failed to send: %v", err)
 					return
 				}
 
-				log.Printf("Sent %d bytes to client #%d", sent, clientID)
+				log.Printf("Sent %d bytes to client %s", sent, clientID)
 			}
 		}
 	}()
@@ -145,20 +144,20 @@ func handleClient(conn net.Conn, clientID int) {
 		if err != nil {
 			// EOF означает нормальное закрытие соединения клиентом
 			if err == io.EOF {
-				log.Printf("Client #%d disconnected (EOF)", clientID)
+				log.Printf("Client %s disconnected (EOF)", clientID)
 			} else {
-				log.Printf("Client #%d receive error: %v", clientID, err)
+				log.Printf("Receive error: %v", err)
 			}
 			return
 		}
 
-		log.Printf("Client #%d: streamID=%d, opcode=%d, payloadLen=%d, data=%s",
+		log.Printf("Client %s: streamID=%d, opcode=%d, payloadLen=%d, data=%s",
 			clientID, hdr.StreamID, hdr.Opcode, hdr.PayloadLen, string(payload))
 
 		// Эхо-ответ
 		echoData := []byte(fmt.Sprintf("Echo: %s", string(payload)))
 		_, err = overproto.Send(
-			conn,
+			tcpConn,
 			hdr.StreamID,        // тот же streamID
 			overproto.OpData,    // opcode
 			overproto.ProtoTCP,  // протокол
@@ -166,7 +165,7 @@ func handleClient(conn net.Conn, clientID int) {
 			0,                   // флаги
 		)
 		if err != nil {
-			log.Printf("Failed to send echo to client #%d: %v", clientID, err)
+			log.Printf("Failed to send echo: %v", err)
 		}
 	}
 }
@@ -87,14 +87,15 @@ func main() {
 	// Горутина для приёма данных
 	go func() {
 		for {
-			hdr, payload, addr, err := overproto.UDPRecv(conn)
+			// Сокет подключён: отправитель всегда сервер
+			hdr, payload, err := overproto.UDPRecvConnected(conn)
 			if err != nil {
 				log.Printf("Failed to receive: %v", err)
 				return
 			}
 
 			log.Printf("Received from %s: streamID=%d, opcode=%d, payloadLen=%d, data=%s",
-				addr, hdr.StreamID, hdr.Opcode, hdr.PayloadLen, string(payload))
+				conn.RemoteAddr(), hdr.StreamID, hdr.Opcode, hdr.PayloadLen, string(payload))
 		}
 	}()
 
@@ -2,9 +2,12 @@ package optimize
 
 import (
 	"bytes"
+	"compress/gzip"
 	"compress/zlib"
 	"errors"
 	"io"
+	"math"
+	"sync/atomic"
 
 	"github.com/nickolajgrishuk/overproto-go/core"
 )
@@ -48,7 +51,40 @@ func Compress(data []byte) ([]byte, error) {
 	return compressed, nil
 }
 
+// CompressGzip сжимает данные в формате gzip (RFC 1952) для совместимости
+// с клиентами, которые понимают только gzip. Send по-прежнему использует zlib
+// Если сжатие неэффективно (размер увеличился), возвращает ошибку
+func CompressGzip(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+
+	var buf bytes.Buffer
+	writer, err := gzip.NewWriterLevel(&buf, core.CompressLevel)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = writer.Write(data); err != nil {
+		_ = writer.Close()
+		return nil, err
+	}
+	if err = writer.Close(); err != nil {
+		return nil, err
+	}
+
+	if buf.Len() >= len(data) {
+		return nil, errors.New("compression not effective")
+	}
+	return buf.Bytes(), nil
+}
+
+// isGzip проверяет magic gzip (0x1f 0x8b); zlib начинается с 0x78
+func isGzip(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
 // Decompress распаковывает данные через zlib inflate
+// Формат определяется по magic: gzip (0x1f 0x8b) или zlib (0x78)
 // Автоматически определяет размер буфера
 func Decompress(data []byte) ([]byte, error) {
 	if len(data) == 0 {
@@ -56,7 +92,13 @@ func Decompress(data []byte) ([]byte, error) {
 	}
 
 	// Создаём reader
-	reader, err := zlib.NewReader(bytes.NewReader(data))
+	var reader io.ReadCloser
+	var err error
+	if isGzip(data) {
+		reader, err = gzip.NewReader(bytes.NewReader(data))
+	} else {
+		reader, err = zlib.NewReader(bytes.NewReader(data))
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -93,3 +135,86 @@ func ShouldCompress(size uint) bool {
 	return size >= core.CompressThreshold
 }
 
+// Параметры эвристики сжимаемости
+const (
+	// entropySampleSize - сколько первых байт анализируется
+	entropySampleSize = 256
+	// entropyThreshold - энтропия (бит на байт), выше которой данные считаются несжимаемыми
+	// Сжатые и зашифрованные данные (медиа, архивы) дают значения около 7.2-8 на выборке 256 байт
+	entropyThreshold = 7.0
+)
+
+// CompressionStats - статистика автоматической компрессии
+type CompressionStats struct {
+	Attempts       uint64 // Запусков zlib
+	Compressed     uint64 // Успешных сжатий
+	Ineffective    uint64 // Сжатий, не уменьшивших размер
+	SkippedEntropy uint64 // Пропущено по эвристике энтропии без запуска zlib
+}
+
+var (
+	compressAttempts       atomic.Uint64
+	compressSucceeded      atomic.Uint64
+	compressIneffective    atomic.Uint64
+	compressSkippedEntropy atomic.Uint64
+)
+
+// LikelyCompressible оценивает сжимаемость по энтропии первых 256 байт
+// Дешёвая проверка, позволяющая не запускать zlib на уже сжатых данных
+func LikelyCompressible(data []byte) bool {
+	sample := data
+	if len(sample) > entropySampleSize {
+		sample = sample[:entropySampleSize]
+	}
+	if len(sample) == 0 {
+		return false
+	}
+
+	var counts [256]int
+	for _, b := range sample {
+		counts[b]++
+	}
+
+	// Энтропия Шеннона в битах на байт
+	entropy := 0.0
+	total := float64(len(sample))
+	for _, c := range counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / total
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy < entropyThreshold
+}
+
+// CompressIfWorthwhile сжимает данные, если они выглядят сжимаемыми и сжатие эффективно
+// Возвращает сжатые данные и true, либо исходные данные и false
+// Учитывает результат в статистике компрессии
+func CompressIfWorthwhile(data []byte) ([]byte, bool) {
+	if !LikelyCompressible(data) {
+		compressSkippedEntropy.Add(1)
+		return data, false
+	}
+
+	compressAttempts.Add(1)
+	compressed, err := Compress(data)
+	if err != nil {
+		compressIneffective.Add(1)
+		return data, false
+	}
+
+	compressSucceeded.Add(1)
+	return compressed, true
+}
+
+// GetCompressionStats возвращает статистику автоматической компрессии
+func GetCompressionStats() CompressionStats {
+	return CompressionStats{
+		Attempts:       compressAttempts.Load(),
+		Compressed:     compressSucceeded.Load(),
+		Ineffective:    compressIneffective.Load(),
+		SkippedEntropy: compressSkippedEntropy.Load(),
+	}
+}
@@ -0,0 +1,51 @@
+package optimize
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecompressDetectsGzip(t *testing.T) {
+	for name, compress := range map[string]func([]byte) ([]byte, error){
+		"zlib": Compress,
+		"gzip": CompressGzip,
+	} {
+		compressed, err := compress(benchmarkText)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		got, err := Decompress(compressed)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, benchmarkText) {
+			t.Fatalf("%s: round trip mismatch", name)
+		}
+	}
+}
+
+func TestDecompressInto(t *testing.T) {
+	record := bytes.Repeat([]byte("telemetry:42;"), 100)
+	compressed, err := Compress(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dst := make([]byte, len(record))
+	for i := 0; i < 2; i++ { // второй вызов использует reader из пула
+		n, err := DecompressInto(dst, compressed)
+		if err != nil || !bytes.Equal(dst[:n], record) {
+			t.Fatalf("DecompressInto: n=%d err=%v", n, err)
+		}
+	}
+
+	if _, err := DecompressInto(make([]byte, len(record)-1), compressed); !errors.Is(err, ErrBufferTooSmall) {
+		t.Fatalf("expected ErrBufferTooSmall, got %v", err)
+	}
+
+	// Повреждённый поток - ошибка, а не усечённый результат
+	if _, err := DecompressInto(dst, compressed[:len(compressed)-4]); err == nil {
+		t.Fatal("expected error for truncated stream")
+	}
+}
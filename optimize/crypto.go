@@ -3,7 +3,6 @@ package optimize
 import (
 	"crypto/aes"
 	"crypto/cipher"
-	"crypto/rand"
 	"errors"
 	"sync"
 )
@@ -20,106 +19,218 @@ const (
 var (
 	// encryptionKey - глобальный ключ шифрования
 	encryptionKey []byte
-	// keyMutex - мьютекс для thread-safe доступа к ключу
+	// streamKeys - ключи отдельных потоков (StreamID -> ключ), приоритетнее глобального
+	streamKeys = make(map[uint32][]byte)
+	// keyMutex - мьютекс для thread-safe доступа к ключам
 	keyMutex sync.RWMutex
 )
 
-// SetEncryptionKey устанавливает глобальный ключ шифрования
+// SetEncryptionKey устанавливает глобальный ключ шифрования AES-256
+// Ключи AES-128/192 - SetEncryptionKeyBytes
 // Thread-safe
 func SetEncryptionKey(key [32]byte) error {
-	if len(key) != AESKeySize {
-		return errors.New("invalid key size")
-	}
-
-	keyMutex.Lock()
-	defer keyMutex.Unlock()
-
-	// Копируем ключ
-	encryptionKey = make([]byte, AESKeySize)
-	copy(encryptionKey, key[:])
-
-	return nil
+	return SetEncryptionKeyBytes(key[:])
 }
 
 // IsEncryptionEnabled проверяет, установлен ли ключ шифрования
 func IsEncryptionEnabled() bool {
 	keyMutex.RLock()
 	defer keyMutex.RUnlock()
-	return len(encryptionKey) == AESKeySize
+	return validKeySize(len(encryptionKey))
 }
 
 // ClearEncryptionKey очищает ключ из памяти (заполняет нулями)
+// Ключи потоков также очищаются
 func ClearEncryptionKey() {
 	keyMutex.Lock()
 	defer keyMutex.Unlock()
 
 	if encryptionKey != nil {
 		// Заполняем нулями для безопасности
-		for i := range encryptionKey {
-			encryptionKey[i] = 0
-		}
+		zeroKey(encryptionKey)
 		encryptionKey = nil
 	}
+
+	for streamID, key := range streamKeys {
+		zeroKey(key)
+		delete(streamKeys, streamID)
+	}
+}
+
+// SetStreamKey устанавливает ключ шифрования AES-256 для отдельного потока
+// Пакеты с этим StreamID шифруются и расшифровываются этим ключом,
+// остальные - глобальным ключом (SetEncryptionKey)
+// Ключи AES-128/192 - SetStreamKeyBytes
+// Thread-safe
+func SetStreamKey(streamID uint32, key [32]byte) error {
+	return SetStreamKeyBytes(streamID, key[:])
+}
+
+// ClearStreamKey удаляет ключ потока из памяти (заполняет нулями)
+// Вызывается при закрытии потока; после этого используется глобальный ключ
+func ClearStreamKey(streamID uint32) {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	if key, ok := streamKeys[streamID]; ok {
+		zeroKey(key)
+		delete(streamKeys, streamID)
+	}
+}
+
+// IsEncryptionEnabledForStream проверяет, есть ли ключ для потока
+// (собственный ключ потока или глобальный)
+func IsEncryptionEnabledForStream(streamID uint32) bool {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+	return validKeySize(len(keyForStreamLocked(streamID)))
+}
+
+// keyForStreamLocked возвращает ключ потока или глобальный ключ
+// Вызывается с захваченным keyMutex и используется до его освобождения:
+// замена и очистка ключа затирают прежний буфер нулями
+func keyForStreamLocked(streamID uint32) []byte {
+	if key, ok := streamKeys[streamID]; ok {
+		return key
+	}
+	return encryptionKey
+}
+
+// zeroKey заполняет ключ нулями
+// Состояние счётчика IV ключа (NonceCounter) также удаляется
+func zeroKey(key []byte) {
+	forgetCounterNonce(key)
+	for i := range key {
+		key[i] = 0
+	}
 }
 
-// Encrypt шифрует данные через AES-256-GCM
+// Encrypt шифрует данные через AES-GCM
 // Возвращает зашифрованные данные и IV
 // IV генерируется случайно для каждого шифрования
 // Формат результата: [IV 12 bytes] [Encrypted data] [Tag 16 bytes]
 func Encrypt(data []byte) ([]byte, []byte, error) {
 	keyMutex.RLock()
-	key := encryptionKey
-	keyMutex.RUnlock()
+	defer keyMutex.RUnlock()
+
+	return encryptWithKey(encryptionKey, data)
+}
+
+// EncryptForStream шифрует данные ключом потока streamID
+// Если ключ потока не задан, используется глобальный ключ
+func EncryptForStream(streamID uint32, data []byte) ([]byte, []byte, error) {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+	return encryptWithKey(keyForStreamLocked(streamID), data)
+}
+
+// EncryptWireForStream шифрует данные ключом потока streamID и возвращает их
+// в формате Send: [IV 12 bytes] [Encrypted data] [Tag 16 bytes]
+// IV и шифротекст размещаются в одном буфере без промежуточных копий
+func EncryptWireForStream(streamID uint32, data []byte) ([]byte, error) {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+	return sealWithKey(keyForStreamLocked(streamID), data)
+}
 
-	if key == nil || len(key) != AESKeySize {
-		return nil, nil, errors.New("encryption key not set")
+// encryptWithKey шифрует данные через AES-GCM указанным ключом
+// Возвращает шифротекст с tag и IV отдельно
+func encryptWithKey(key []byte, data []byte) ([]byte, []byte, error) {
+	sealed, err := sealWithKey(key, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sealed[AESIVSize:], sealed[:AESIVSize:AESIVSize], nil
+}
+
+// sealWithKey шифрует данные через AES-GCM указанным ключом
+// Результат: [IV 12 bytes] [Encrypted data] [Tag 16 bytes] в одном буфере
+func sealWithKey(key []byte, data []byte) ([]byte, error) {
+	if !validKeySize(len(key)) {
+		return nil, errors.New("encryption key not set")
 	}
 
 	if len(data) == 0 {
-		return nil, nil, errors.New("empty data")
+		return nil, errors.New("empty data")
 	}
 
-	// Создаём AES cipher
+	// Создаём AES cipher (вариант AES-128/192/256 определяется длиной ключа)
 	block, err := aes.NewCipher(key)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
 	// Создаём GCM
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
 
+	// Буфер сразу под IV, шифротекст и tag
+	sealed := make([]byte, AESIVSize, AESIVSize+len(data)+AESGCMTagSize)
+
 	// Генерируем случайный IV (12 байт) через криптографически стойкий генератор
-	// Примечание: gosec G407 - это ложное срабатывание, IV генерируется случайно через rand.Read
-	iv := make([]byte, AESIVSize)
-	_, err = rand.Read(iv) //nolint:gosec // IV генерируется криптографически стойким способом
-	if err != nil {
-		return nil, nil, err
+	// или внешний источник (см. SetIVSource), либо из счётчика ключа (NonceCounter)
+	// Примечание: gosec G407 - это ложное срабатывание, IV генерируется случайно
+	iv := sealed[:AESIVSize]
+	if err := nextIV(key, iv); err != nil {
+		return nil, err
 	}
 
-	// Шифруем данные
+	// Шифруем данные, дописывая их после IV
 	// Seal автоматически добавляет tag в конец
-	// iv генерируется случайно через rand.Read выше, это не hardcoded значение
-	encrypted := gcm.Seal(nil, iv, data, nil) //nolint:gosec // IV генерируется криптографически стойким способом через rand.Read
-
-	// Формат: [IV 12 bytes] [Encrypted data] [Tag 16 bytes]
-	// Но encrypted уже содержит tag, поэтому просто возвращаем его
-	// IV возвращаем отдельно
-	return encrypted, iv, nil
+	// iv генерируется случайно через readIV выше, это не hardcoded значение
+	return gcm.Seal(sealed, iv, data, nil), nil //nolint:gosec // IV генерируется криптографически стойким способом через readIV
 }
 
-// Decrypt расшифровывает данные через AES-256-GCM
+// Decrypt расшифровывает данные через AES-GCM
 // Проверяет аутентификационный tag
 // encrypted должен содержать зашифрованные данные с tag в конце
 // iv - это IV из начала зашифрованных данных
 func Decrypt(encrypted []byte, iv []byte) ([]byte, error) {
 	keyMutex.RLock()
-	key := encryptionKey
-	keyMutex.RUnlock()
+	defer keyMutex.RUnlock()
+
+	return decryptWithKey(encryptionKey, encrypted, iv)
+}
+
+// DecryptForStream расшифровывает данные ключом потока streamID
+// Если ключ потока не задан, используется глобальный ключ
+func DecryptForStream(streamID uint32, encrypted []byte, iv []byte) ([]byte, error) {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+	return decryptWithKey(keyForStreamLocked(streamID), encrypted, iv)
+}
+
+// DecryptWire расшифровывает данные в формате Send глобальным ключом:
+// [IV 12 bytes] [Encrypted data] [Tag 16 bytes]
+// IV отделяется от шифротекста здесь, вызывающему не нужно знать смещение
+func DecryptWire(blob []byte) ([]byte, error) {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+
+	return openWithKey(encryptionKey, blob)
+}
+
+// DecryptWireForStream расшифровывает данные в формате Send ключом потока streamID
+// Если ключ потока не задан, используется глобальный ключ
+func DecryptWireForStream(streamID uint32, blob []byte) ([]byte, error) {
+	keyMutex.RLock()
+	defer keyMutex.RUnlock()
+	return openWithKey(keyForStreamLocked(streamID), blob)
+}
+
+// openWithKey разделяет IV и шифротекст и расшифровывает их указанным ключом
+func openWithKey(key []byte, blob []byte) ([]byte, error) {
+	if len(blob) < AESIVSize {
+		return nil, errors.New("encrypted payload too short")
+	}
+	return decryptWithKey(key, blob[AESIVSize:], blob[:AESIVSize])
+}
 
-	if key == nil || len(key) != AESKeySize {
+// decryptWithKey расшифровывает данные через AES-GCM указанным ключом
+func decryptWithKey(key []byte, encrypted []byte, iv []byte) ([]byte, error) {
+	if !validKeySize(len(key)) {
 		return nil, errors.New("encryption key not set")
 	}
 
@@ -136,7 +247,7 @@ func Decrypt(encrypted []byte, iv []byte) ([]byte, error) {
 		return nil, errors.New("encrypted data too short")
 	}
 
-	// Создаём AES cipher
+	// Создаём AES cipher (вариант AES-128/192/256 определяется длиной ключа)
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,73 @@
+package optimize
+
+import (
+	"crypto/rand"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ivHistorySize - сколько последних IV внешнего источника проверяется на повтор
+const ivHistorySize = 4096
+
+// ErrIVReuse - источник IV вернул уже использованное значение
+// Повтор IV с тем же ключом в AES-GCM раскрывает открытый текст и ключ аутентификации
+var ErrIVReuse = errors.New("IV source returned a repeated IV")
+
+var (
+	// ivSource - источник случайных IV, nil - crypto/rand
+	ivSource io.Reader
+	// ivHistory - последние IV внешнего источника (для обнаружения повторов)
+	ivHistory = make(map[[AESIVSize]byte]struct{})
+	// ivRing - порядок IV в ivHistory для вытеснения старых
+	ivRing [ivHistorySize][AESIVSize]byte
+	// ivRingPos - позиция следующей записи в ivRing
+	ivRingPos int
+	// ivMutex - мьютекс для источника и истории IV
+	ivMutex sync.Mutex
+)
+
+// SetIVSource задаёт источник IV для шифрования (детерминированный reader
+// в тестах, аппаратный RNG в production); nil возвращает crypto/rand
+// Для внешнего источника последние 4096 IV проверяются на повтор:
+// при повторе шифрование возвращает ErrIVReuse
+// Thread-safe
+func SetIVSource(r io.Reader) {
+	ivMutex.Lock()
+	defer ivMutex.Unlock()
+
+	ivSource = r
+	ivHistory = make(map[[AESIVSize]byte]struct{})
+	ivRingPos = 0
+}
+
+// readIV заполняет iv из текущего источника
+func readIV(iv []byte) error {
+	ivMutex.Lock()
+	if ivSource == nil {
+		// crypto/rand потокобезопасен - читаем без блокировки
+		ivMutex.Unlock()
+		_, err := rand.Read(iv)
+		return err
+	}
+	defer ivMutex.Unlock()
+
+	if _, err := io.ReadFull(ivSource, iv); err != nil {
+		return err
+	}
+
+	var key [AESIVSize]byte
+	copy(key[:], iv)
+	if _, seen := ivHistory[key]; seen {
+		return ErrIVReuse
+	}
+
+	// Вытесняем самый старый IV, когда история заполнена
+	if len(ivHistory) >= ivHistorySize {
+		delete(ivHistory, ivRing[ivRingPos])
+	}
+	ivHistory[key] = struct{}{}
+	ivRing[ivRingPos] = key
+	ivRingPos = (ivRingPos + 1) % ivHistorySize
+	return nil
+}
@@ -0,0 +1,57 @@
+package optimize
+
+import "errors"
+
+const (
+	// AESKeySize128 - размер ключа AES-128 (16 байт)
+	AESKeySize128 = 16
+	// AESKeySize192 - размер ключа AES-192 (24 байта)
+	AESKeySize192 = 24
+)
+
+// ErrInvalidKeySize - длина ключа не 16, 24 или 32 байта
+var ErrInvalidKeySize = errors.New("invalid key size: must be 16, 24 or 32 bytes")
+
+// validKeySize проверяет длину ключа AES-128/192/256
+func validKeySize(n int) bool {
+	return n == AESKeySize128 || n == AESKeySize192 || n == AESKeySize
+}
+
+// SetEncryptionKeyBytes устанавливает глобальный ключ шифрования
+// Вариант AES выбирается по длине ключа: 16 байт - AES-128,
+// 24 - AES-192, 32 - AES-256; обе стороны должны использовать один ключ
+// Ключ копируется
+// Thread-safe
+func SetEncryptionKeyBytes(key []byte) error {
+	if !validKeySize(len(key)) {
+		return ErrInvalidKeySize
+	}
+
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	// Копируем ключ; счётчик IV прежнего ключа больше не нужен
+	forgetCounterNonce(encryptionKey)
+	encryptionKey = append([]byte(nil), key...)
+
+	return nil
+}
+
+// SetStreamKeyBytes устанавливает ключ потока длиной 16, 24 или 32 байта
+// (AES-128/192/256), см. SetStreamKey
+// Thread-safe
+func SetStreamKeyBytes(streamID uint32, key []byte) error {
+	if !validKeySize(len(key)) {
+		return ErrInvalidKeySize
+	}
+
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	if old, ok := streamKeys[streamID]; ok {
+		zeroKey(old)
+	}
+	streamKeys[streamID] = append([]byte(nil), key...)
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package optimize
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestIVSourceDeterministicAndReuse(t *testing.T) {
+	if err := SetEncryptionKey([32]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearEncryptionKey()
+	defer SetIVSource(nil)
+
+	// Одинаковый детерминированный источник даёт одинаковый шифротекст
+	var results [2][]byte
+	for i := range results {
+		SetIVSource(bytes.NewReader(bytes.Repeat([]byte{1, 2, 3, 4}, 6)))
+		encrypted, _, err := Encrypt([]byte("reproducible"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		results[i] = encrypted
+	}
+	if !bytes.Equal(results[0], results[1]) {
+		t.Fatal("deterministic IV source produced different ciphertext")
+	}
+
+	// Источник, повторяющий IV, обнаруживается
+	SetIVSource(bytes.NewReader(make([]byte, 2*AESIVSize)))
+	if _, _, err := Encrypt([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Encrypt([]byte("second")); !errors.Is(err, ErrIVReuse) {
+		t.Fatalf("expected ErrIVReuse, got %v", err)
+	}
+}
+
+func TestCounterNonceMode(t *testing.T) {
+	if err := SetEncryptionKey([32]byte{4}); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearEncryptionKey()
+	if err := SetNonceMode(NonceCounter); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = SetNonceMode(NonceRandom) }()
+
+	_, iv1, err := Encrypt([]byte("one"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, iv2, err := Encrypt([]byte("two"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(iv1[:4], iv2[:4]) {
+		t.Fatal("salt changed between messages under one key")
+	}
+	if binary.BigEndian.Uint64(iv2[4:])-binary.BigEndian.Uint64(iv1[4:]) != 1 {
+		t.Fatal("counter did not advance by one")
+	}
+
+	// Исчерпанный счётчик требует смены ключа
+	state, err := counterNonceFor(encryptionKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.counter.Store(math.MaxUint64 - 1)
+	for i := 0; i < 3; i++ {
+		if _, _, err := Encrypt([]byte("three")); !errors.Is(err, ErrRekeyRequired) {
+			t.Fatalf("call %d: expected ErrRekeyRequired, got %v", i, err)
+		}
+	}
+	// Исчерпанный счётчик не переполняется и не повторяет первые IV
+	if got := state.counter.Load(); got != math.MaxUint64-1 {
+		t.Fatalf("exhausted counter moved to %d", got)
+	}
+
+	if err := SetEncryptionKey([32]byte{5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Encrypt([]byte("four")); err != nil {
+		t.Fatalf("new key should reset the counter: %v", err)
+	}
+}
+
+func TestStreamKeyRotationDuringEncrypt(t *testing.T) {
+	keyA := bytes.Repeat([]byte{0xA}, AESKeySize)
+	keyB := bytes.Repeat([]byte{0xB}, AESKeySize)
+	defer ClearStreamKey(7)
+	if err := SetStreamKeyBytes(7, keyA); err != nil {
+		t.Fatal(err)
+	}
+
+	// Ротация ключа не должна затирать ключ, которым идёт шифрование
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 2000; i++ {
+			key := keyA
+			if i%2 == 0 {
+				key = keyB
+			}
+			_ = SetStreamKeyBytes(7, key)
+		}
+	}()
+
+	var sealed [][]byte
+	for running := true; running; {
+		select {
+		case <-done:
+			running = false
+		default:
+		}
+		blob, err := EncryptWireForStream(7, []byte("rotating"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sealed = append(sealed, blob)
+	}
+
+	for _, blob := range sealed {
+		_, errA := openWithKey(keyA, blob)
+		_, errB := openWithKey(keyB, blob)
+		if errA != nil && errB != nil {
+			t.Fatal("packet encrypted under a zeroed key")
+		}
+	}
+}
+
+func TestEncryptionKeySizes(t *testing.T) {
+	defer ClearEncryptionKey()
+
+	for _, size := range []int{AESKeySize128, AESKeySize192, AESKeySize} {
+		key := bytes.Repeat([]byte{byte(size)}, size)
+		if err := SetEncryptionKeyBytes(key); err != nil {
+			t.Fatal(err)
+		}
+		encrypted, iv, err := Encrypt([]byte("interop"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Шифротекст совместим со стандартным AES-GCM того же размера ключа
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := gcm.Open(nil, iv, encrypted, nil)
+		if err != nil || string(plain) != "interop" {
+			t.Fatalf("AES-%d: %q %v", size*8, plain, err)
+		}
+	}
+
+	if err := SetEncryptionKeyBytes(make([]byte, 20)); !errors.Is(err, ErrInvalidKeySize) {
+		t.Fatalf("expected ErrInvalidKeySize, got %v", err)
+	}
+}
+
+func TestDecryptWire(t *testing.T) {
+	if err := SetEncryptionKey([32]byte{6}); err != nil {
+		t.Fatal(err)
+	}
+	defer ClearEncryptionKey()
+
+	blob, err := EncryptWireForStream(1, []byte("wire format"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := DecryptWire(blob)
+	if err != nil || string(plain) != "wire format" {
+		t.Fatalf("DecryptWire: %q %v", plain, err)
+	}
+	if _, err := DecryptWire(blob[:AESIVSize-1]); err == nil {
+		t.Fatal("expected error for blob shorter than IV")
+	}
+}
@@ -0,0 +1,85 @@
+package optimize
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrBufferTooSmall - распакованные данные не помещаются в буфер DecompressInto
+var ErrBufferTooSmall = errors.New("decompressed data does not fit into buffer")
+
+// zlibReaderPool - zlib reader'ы для DecompressInto (переиспользуются через zlib.Resetter)
+var zlibReaderPool sync.Pool
+
+// DecompressInto распаковывает data (zlib или gzip) в буфер dst
+// Возвращает количество записанных байт или ErrBufferTooSmall, если
+// распакованные данные длиннее dst
+// В отличие от Decompress не выделяет буфер результата и переиспользует
+// zlib reader, поэтому подходит для данных заранее известного размера
+func DecompressInto(dst, data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, errors.New("empty data")
+	}
+
+	src := bytes.NewReader(data)
+	var reader io.Reader
+	if isGzip(data) {
+		gz, err := gzip.NewReader(src)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		reader = gz
+	} else {
+		zr, err := getZlibReader(src)
+		if err != nil {
+			return 0, err
+		}
+		defer zlibReaderPool.Put(zr)
+		reader = zr
+	}
+
+	n := 0
+	for n < len(dst) {
+		m, err := reader.Read(dst[n:])
+		n += m
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+
+	// dst заполнен: данные должны закончиться (EOF также означает,
+	// что контрольная сумма потока проверена)
+	var extra [1]byte
+	for {
+		m, err := reader.Read(extra[:])
+		if m > 0 {
+			return n, ErrBufferTooSmall
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+	}
+}
+
+// getZlibReader возвращает zlib reader из пула, настроенный на src
+func getZlibReader(src io.Reader) (io.ReadCloser, error) {
+	if zr, ok := zlibReaderPool.Get().(io.ReadCloser); ok {
+		if err := zr.(zlib.Resetter).Reset(src, nil); err != nil {
+			zlibReaderPool.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	return zlib.NewReader(src)
+}
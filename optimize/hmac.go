@@ -0,0 +1,110 @@
+package optimize
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"sync"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// HMACSize - размер HMAC-SHA256, дописываемого к payload (32 байта)
+const HMACSize = sha256.Size
+
+// ErrHMACMismatch - HMAC пакета не совпал: пакет подделан или повреждён
+var ErrHMACMismatch = errors.New("HMAC mismatch")
+
+var (
+	// authKey - общий ключ HMAC
+	authKey []byte
+	// authKeyMutex - мьютекс для authKey
+	authKeyMutex sync.RWMutex
+)
+
+// SetAuthKey устанавливает общий ключ HMAC для пакетов с FlagAuthenticated
+// Независим от ключа шифрования
+// Thread-safe
+func SetAuthKey(key [32]byte) {
+	authKeyMutex.Lock()
+	defer authKeyMutex.Unlock()
+
+	zeroKey(authKey)
+	authKey = make([]byte, len(key))
+	copy(authKey, key[:])
+}
+
+// IsAuthEnabled проверяет, установлен ли ключ HMAC
+func IsAuthEnabled() bool {
+	authKeyMutex.RLock()
+	defer authKeyMutex.RUnlock()
+	return authKey != nil
+}
+
+// ClearAuthKey очищает ключ HMAC из памяти (заполняет нулями)
+func ClearAuthKey() {
+	authKeyMutex.Lock()
+	defer authKeyMutex.Unlock()
+
+	zeroKey(authKey)
+	authKey = nil
+}
+
+// SignPacket дописывает к payload HMAC-SHA256 заголовка и payload
+// hdr.PayloadLen устанавливается с учётом HMAC, флаг FlagAuthenticated - тоже,
+// поэтому после вызова заголовок менять нельзя
+// Возвращает новый буфер: [payload] [HMAC 32 bytes]
+func SignPacket(hdr *core.PacketHeader, payload []byte) ([]byte, error) {
+	authKeyMutex.RLock()
+	defer authKeyMutex.RUnlock()
+
+	if authKey == nil {
+		return nil, errors.New("authentication key not set")
+	}
+
+	payloadLen, err := core.SafeIntToUint16(len(payload) + HMACSize)
+	if err != nil {
+		return nil, errors.New("payload too large")
+	}
+	hdr.Flags |= core.FlagAuthenticated
+	hdr.PayloadLen = payloadLen
+
+	signed := make([]byte, len(payload), len(payload)+HMACSize)
+	copy(signed, payload)
+	return computeMAC(hdr, payload, signed), nil
+}
+
+// VerifyPacket проверяет HMAC принятого пакета с FlagAuthenticated
+// Возвращает payload без HMAC; пакет без флага возвращается без изменений
+func VerifyPacket(hdr *core.PacketHeader, payload []byte) ([]byte, error) {
+	if (hdr.Flags & core.FlagAuthenticated) == 0 {
+		return payload, nil
+	}
+	if len(payload) < HMACSize {
+		return nil, errors.New("authenticated payload too short")
+	}
+
+	authKeyMutex.RLock()
+	defer authKeyMutex.RUnlock()
+
+	if authKey == nil {
+		return nil, errors.New("authentication key not set")
+	}
+
+	data := payload[:len(payload)-HMACSize]
+	expected := computeMAC(hdr, data, nil)
+	if !hmac.Equal(expected, payload[len(data):]) {
+		return nil, ErrHMACMismatch
+	}
+	return data, nil
+}
+
+// computeMAC дописывает к dst HMAC-SHA256 заголовка (как на проводе) и payload
+// Вызывается с захваченным authKeyMutex
+func computeMAC(hdr *core.PacketHeader, payload []byte, dst []byte) []byte {
+	header := core.EncodeHeader(hdr)
+	mac := hmac.New(sha256.New, authKey)
+	mac.Write(header[:])
+	mac.Write(payload)
+	return mac.Sum(dst)
+}
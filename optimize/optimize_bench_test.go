@@ -0,0 +1,69 @@
+package optimize
+
+import (
+	"bytes"
+	"testing"
+)
+
+// benchmarkText - сжимаемые данные, похожие на текстовый payload
+var benchmarkText = bytes.Repeat([]byte("overproto benchmark payload "), 64)
+
+func BenchmarkCompress(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkText)))
+	for i := 0; i < b.N; i++ {
+		if _, err := Compress(benchmarkText); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecompress(b *testing.B) {
+	compressed, err := Compress(benchmarkText)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkText)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decompress(compressed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	if err := SetEncryptionKey([32]byte{1}); err != nil {
+		b.Fatal(err)
+	}
+	defer ClearEncryptionKey()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkText)))
+	for i := 0; i < b.N; i++ {
+		if _, _, err := Encrypt(benchmarkText); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	if err := SetEncryptionKey([32]byte{1}); err != nil {
+		b.Fatal(err)
+	}
+	defer ClearEncryptionKey()
+
+	encrypted, iv, err := Encrypt(benchmarkText)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchmarkText)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Decrypt(encrypted, iv); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package optimize
+
+import (
+	"crypto/rand"
+	"io"
+	"sync"
+)
+
+var (
+	// randSource - источник случайных байт вместо crypto/rand, nil - crypto/rand
+	randSource io.Reader
+	// randMutex - мьютекс randSource
+	randMutex sync.Mutex
+)
+
+// SetRandSource задаёт источник случайных байт пакета вместо crypto/rand
+// (соль счётчика nonce); nil возвращает crypto/rand. IV задаются отдельно
+// через SetIVSource
+// Только для тестов: предсказуемый источник ломает криптостойкость
+// Thread-safe
+func SetRandSource(r io.Reader) {
+	randMutex.Lock()
+	defer randMutex.Unlock()
+	randSource = r
+}
+
+// readRandom заполняет buf из текущего источника
+func readRandom(buf []byte) error {
+	randMutex.Lock()
+	src := randSource
+	randMutex.Unlock()
+	if src == nil {
+		src = rand.Reader
+	}
+	_, err := io.ReadFull(src, buf)
+	return err
+}
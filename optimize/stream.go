@@ -0,0 +1,134 @@
+package optimize
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+const (
+	// streamWindowSize - размер окна deflate (история для следующих сообщений)
+	streamWindowSize = 32 * 1024
+	// maxStreamSegmentSize - максимальный размер распакованного сегмента
+	maxStreamSegmentSize = 10 * 1024 * 1024
+)
+
+// syncFlushMarker - пустой stored блок, которым заканчивается каждый сегмент (Z_SYNC_FLUSH)
+var syncFlushMarker = []byte{0x00, 0x00, 0xFF, 0xFF}
+
+// StreamCompressor - компрессор, общий для всех пакетов соединения
+// Один deflate поток охватывает всё соединение: каждое сообщение сбрасывается
+// через Z_SYNC_FLUSH и образует самостоятельный сегмент, а словарь сохраняется,
+// поэтому повторяющиеся сообщения сжимаются значительно лучше
+// Сегменты должны распаковываться строго в порядке сжатия
+type StreamCompressor struct {
+	buf    bytes.Buffer
+	writer *flate.Writer
+	mu     sync.Mutex
+}
+
+// NewStreamCompressor создаёт компрессор потока
+func NewStreamCompressor() (*StreamCompressor, error) {
+	c := &StreamCompressor{}
+	writer, err := flate.NewWriter(&c.buf, core.StreamCompressLevel)
+	if err != nil {
+		return nil, err
+	}
+	c.writer = writer
+	return c, nil
+}
+
+// Compress сжимает сообщение и возвращает сегмент, заканчивающийся sync flush
+// Thread-safe, но порядок вызовов определяет порядок распаковки
+func (c *StreamCompressor) Compress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty data")
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.buf.Reset()
+	if _, err := c.writer.Write(data); err != nil {
+		return nil, err
+	}
+	// Flush выполняет Z_SYNC_FLUSH: сегмент выравнивается по байту, словарь сохраняется
+	if err := c.writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	segment := make([]byte, c.buf.Len())
+	copy(segment, c.buf.Bytes())
+	return segment, nil
+}
+
+// Reset начинает новый deflate поток: накопленный словарь забывается,
+// следующий сегмент сжимается без ссылок на предыдущие
+func (c *StreamCompressor) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.buf.Reset()
+	c.writer.Reset(&c.buf)
+}
+
+// StreamDecompressor - распаковщик, парный StreamCompressor
+// Хранит последние 32KB распакованных данных как словарь для следующего сегмента
+type StreamDecompressor struct {
+	history []byte
+	mu      sync.Mutex
+}
+
+// NewStreamDecompressor создаёт распаковщик потока
+func NewStreamDecompressor() *StreamDecompressor {
+	return &StreamDecompressor{}
+}
+
+// Decompress распаковывает очередной сегмент потока
+// Сегменты должны передаваться в том же порядке, в котором были сжаты
+func (d *StreamDecompressor) Decompress(segment []byte) ([]byte, error) {
+	if len(segment) == 0 {
+		return nil, errors.New("empty data")
+	}
+	// Каждый сегмент обязан заканчиваться маркером sync flush,
+	// иначе он обрезан или сжат не потоковым компрессором
+	if !bytes.HasSuffix(segment, syncFlushMarker) {
+		return nil, errors.New("stream segment missing sync flush marker")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	reader := flate.NewReaderDict(bytes.NewReader(segment), d.history)
+	defer reader.Close()
+
+	var result bytes.Buffer
+	_, err := io.Copy(&result, io.LimitReader(reader, maxStreamSegmentSize))
+	// Сегмент не содержит финального блока, поэтому после маркера sync flush
+	// deflate reader сообщает io.ErrUnexpectedEOF - это штатный конец сегмента
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil, err
+	}
+	if result.Len() >= maxStreamSegmentSize {
+		return nil, errors.New("decompressed data too large (potential decompression bomb)")
+	}
+
+	// Обновляем словарь: последние 32KB распакованных данных
+	d.history = append(d.history, result.Bytes()...)
+	if len(d.history) > streamWindowSize {
+		d.history = append(d.history[:0], d.history[len(d.history)-streamWindowSize:]...)
+	}
+
+	return result.Bytes(), nil
+}
+
+// Reset забывает словарь: следующий сегмент распаковывается как начало
+// нового потока (парный вызов StreamCompressor.Reset)
+func (d *StreamDecompressor) Reset() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.history = nil
+}
@@ -1,9 +1,14 @@
 package overproto
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
 	"errors"
+	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/nickolajgrishuk/overproto-go/core"
@@ -20,6 +25,54 @@ type (
 	TCPConnection = transport.TCPConnection
 	// PacketHeader - заголовок пакета OverProto
 	PacketHeader = core.PacketHeader
+	// Packet - принятый пакет: заголовок и payload
+	Packet = core.Packet
+	// StatsSnapshot - снимок состояния соединений и трафика
+	StatsSnapshot = transport.Stats
+	// CodecStatsSnapshot - снимок затрат на сериализацию и десериализацию
+	CodecStatsSnapshot = core.CodecStats
+	// ConnStats - состояние отдельного TCP соединения
+	ConnStats = transport.ConnStats
+	// SessionStats - состояние отдельной надёжной UDP сессии
+	SessionStats = transport.SessionStats
+	// FragmentReassembler - сборщик фрагментированных сообщений
+	FragmentReassembler = core.FragmentReassembler
+	// ReliableSession - надёжная UDP сессия с внутренней обработкой ACK
+	ReliableSession = transport.ReliableSession
+	// SessionHandler - обработчик пакетов одного опкода в ReliableSession
+	SessionHandler = transport.SessionHandler
+	// GapDetector - детектор пропусков Seq на стороне приёма
+	GapDetector = core.GapDetector
+	// GapFunc - callback при обнаружении пропуска Seq
+	GapFunc = core.GapFunc
+	// GapStats - статистика детектора пропусков
+	GapStats = core.GapStats
+	// CRCScope - область данных, покрываемая CRC32
+	CRCScope = core.CRCScope
+	// CongestionAlgorithm - алгоритм congestion control надёжных сессий
+	CongestionAlgorithm = core.CongestionAlgorithm
+	// ControlMessage - управляющее сообщение (TLV) в payload OpControl
+	ControlMessage = core.ControlMessage
+	// NonceMode - способ формирования IV для AES-GCM
+	NonceMode = optimize.NonceMode
+	// AuthFunc - проверка первого пакета соединения или сессии
+	AuthFunc = transport.AuthFunc
+	// UDPHandler - обработчик пакета, принятого UDPRecvWorkers
+	UDPHandler = transport.UDPHandler
+	// UDPMux - маршрутизация пакетов UDPServe по опкодам и надёжным сессиям
+	UDPMux = transport.UDPMux
+	// UDPPacketHandler - обработчик пакетов одного опкода в UDPServe
+	UDPPacketHandler = transport.UDPPacketHandler
+	// UnknownOpcodeHandler - обработчик пакетов UDPServe без обработчика опкода
+	UnknownOpcodeHandler = transport.UnknownOpcodeHandler
+	// ConnError - ошибка соединения или сессии с её идентификатором
+	ConnError = transport.ConnError
+	// KeepAliveFailFunc - обработчик обрыва соединения, обнаруженного TCP keepalive
+	KeepAliveFailFunc = transport.KeepAliveFailFunc
+	// ReassemblyStats - использование лимитов сборки фрагментов
+	ReassemblyStats = core.ReassemblyStats
+	// TLV - поле управляющего сообщения
+	TLV = core.TLV
 )
 
 var (
@@ -28,6 +81,9 @@ var (
 	config *core.Config
 	// initialized - флаг инициализации
 	initialized bool
+	// deterministic - включён SetDeterministic: Init не заменяет его
+	// начальный Seq фрагментов случайным
+	deterministic bool
 	// recvCallback - callback функция для приёма пакетов
 	// TODO: вызывать при получении пакетов
 	recvCallback RecvCallback
@@ -62,29 +118,83 @@ func Init(cfg *core.Config) error {
 	} else {
 		config = cfg
 	}
+	if config.DSCP > transport.MaxDSCP {
+		config = nil
+		return errors.New("invalid DSCP value (must be 0-63)")
+	}
+	if config.KeepAliveIdle < 0 || config.KeepAliveInterval < 0 || config.KeepAliveCount < 0 {
+		config = nil
+		return errors.New("invalid keepalive settings (must not be negative)")
+	}
+	if config.WriteTimeout < 0 {
+		config = nil
+		return errors.New("invalid write timeout (must not be negative)")
+	}
+	if config.MaxConnections < 0 {
+		config = nil
+		return errors.New("invalid max connections (must not be negative)")
+	}
+	if config.Backlog < 0 {
+		config = nil
+		return errors.New("invalid backlog (must not be negative)")
+	}
+	if config.MaxReorderBuffer < 0 {
+		config = nil
+		return errors.New("invalid max reorder buffer (must not be negative)")
+	}
+	if config.UDPRecvWorkers < 0 {
+		config = nil
+		return errors.New("invalid UDP receive workers count (must not be negative)")
+	}
+	if err := core.SetCRCScope(config.CRCScope); err != nil {
+		config = nil
+		return err
+	}
+	core.SetSkipCRCOpcodes(config.SkipCRCForOpcodes)
+	core.SetCodecLatency(config.CodecLatency)
+	transport.SetConfig(config)
+	if !deterministic {
+		seedFragmentSeq(rand.Reader)
+	}
 
 	initialized = true
 	return nil
 }
 
 // Shutdown завершает работу библиотеки
-// Освобождает все ресурсы
+// Освобождает все ресурсы: закрывает слушатели, соединения и UDP сокеты,
+// открытые функциями библиотеки, и возвращает объединённую ошибку закрытия
 // Thread-safe
-func Shutdown() {
+func Shutdown() error {
 	mu.Lock()
 	defer mu.Unlock()
 
+	// Закрываем сокеты, соединения и сессии, открытые библиотекой,
+	// даже если Init не вызывался
+	err := transport.CloseAll()
+
 	if !initialized {
-		return
+		return err
 	}
 
-	// Очищаем ключ шифрования
+	// Очищаем ключи шифрования и HMAC
 	optimize.ClearEncryptionKey()
+	optimize.ClearAuthKey()
+	optimize.SetIVSource(nil)
+	optimize.SetRandSource(nil)
+	transport.SetRandSource(nil)
+	deterministic = false
+	_ = optimize.SetNonceMode(optimize.NonceRandom)
 
 	initialized = false
 	config = nil
+	transport.SetConfig(nil)
+	_ = core.SetCRCScope(core.CRCHeaderAndPayload)
+	core.SetSkipCRCOpcodes(nil)
+	core.SetCodecLatency(false)
 	recvCallback = nil
 	recvCtx = nil
+	return err
 }
 
 // SetHandler устанавливает callback функцию для приёма пакетов
@@ -99,8 +209,47 @@ func SetHandler(callback RecvCallback, ctx interface{}) {
 // Send отправляет пакет данных
 // Удобная функция-обёртка для создания и отправки пакета
 // Автоматически применяет компрессию и шифрование если нужно
-// conn может быть net.Conn (TCP) или *net.UDPConn (UDP)
+// conn может быть net.Conn или *TCPConnection (TCP) либо подключённый
+// net.PacketConn, например *net.UDPConn (UDP)
+// По UDP пакет больше UDPMaxPacket отправляется фрагментами (см.
+// UDPSendFragmented) с Seq из общего счётчика, чтобы получатель не смешал
+// фрагменты разных сообщений потока
 func Send(conn interface{}, streamID uint32, opcode, proto uint8, data []byte, flags uint8) (int, error) {
+	return send(conn, streamID, opcode, proto, data, flags, SendOptions{}, true)
+}
+
+// fragmentSeq - счётчик Seq фрагментированных UDP сообщений Send
+var fragmentSeq atomic.Uint32
+
+// seedFragmentSeq задаёт случайное начало fragmentSeq: при общем начальном
+// значении разные отправители выдавали бы одинаковые Seq, и сборщик,
+// получающий их фрагменты, смешал бы сообщения одного StreamID
+func seedFragmentSeq(r io.Reader) {
+	var buf [4]byte
+	if _, err := io.ReadFull(r, buf[:]); err == nil {
+		fragmentSeq.Store(binary.BigEndian.Uint32(buf[:]))
+	}
+}
+
+// SendOptions - необязательные поля заголовка для SendWithOptions
+// Timestamp не передаётся по сети (байты 20-23 заголовка всегда 0), поэтому
+// переопределять его незачем: пакеты без шифрования и так совпадают побайтно,
+// а для шифрованных IV задаётся через SetIVSource
+type SendOptions struct {
+	// Seq - значение поля Seq (Send отправляет 0)
+	Seq uint32
+}
+
+// SendWithOptions отправляет пакет как Send, заполняя поля заголовка из opts
+// Позволяет ретранслятору сохранить Seq исходного пакета
+// Фрагменты UDP пакета получают opts.Seq
+func SendWithOptions(conn interface{}, streamID uint32, opcode, proto uint8, data []byte, flags uint8, opts SendOptions) (int, error) {
+	return send(conn, streamID, opcode, proto, data, flags, opts, false)
+}
+
+// send - общая реализация Send и SendWithOptions
+// autoSeq - назначать Seq фрагментированному UDP пакету из fragmentSeq
+func send(conn interface{}, streamID uint32, opcode, proto uint8, data []byte, flags uint8, opts SendOptions, autoSeq bool) (int, error) {
 	mu.RLock()
 	if !initialized {
 		mu.RUnlock()
@@ -113,40 +262,35 @@ func Send(conn interface{}, streamID uint32, opcode, proto uint8, data []byte, f
 		return 0, errors.New("payload too large (max 65535 bytes)")
 	}
 
-	payload := make([]byte, len(data))
-	copy(payload, data)
+	// data не копируется: компрессия и шифрование создают новые буферы,
+	// а сериализация только читает payload, поэтому данные вызывающего не меняются
+	payload := data
+	flags = emptyPayloadFlags(payload, flags)
 
 	// 1. Автоматическая компрессия
-	// Если размер >= 512 байт и флаг компрессии не установлен
-	if len(payload) >= int(core.CompressThreshold) && (flags&core.FlagCompressed) == 0 {
-		compressed, err := optimize.Compress(payload)
-		if err == nil {
-			// Компрессия успешна
-			payload = compressed
-			flags |= core.FlagCompressed
-		}
-		// Если компрессия неэффективна, продолжаем без неё
+	// На соединении с потоковой компрессией незашифрованные и неподписанные
+	// пакеты сжимаются общим потоком при отправке (см. TCPSendStream)
+	tcpConn, _ := conn.(*TCPConnection)
+	streamCompressed := tcpConn != nil && tcpConn.StreamCompressionEnabled() &&
+		(flags&(core.FlagEncrypted|core.FlagAuthenticated)) == 0
+	if !streamCompressed {
+		payload, flags = autoCompress(payload, flags)
 	}
 
 	// 2. Шифрование
 	// Если флаг шифрования установлен
+	// Ключ выбирается по StreamID (SetStreamKey), иначе используется глобальный
 	if (flags & core.FlagEncrypted) != 0 {
-		if !optimize.IsEncryptionEnabled() {
+		if !optimize.IsEncryptionEnabledForStream(streamID) {
 			return 0, errors.New("encryption enabled but key not set")
 		}
 
-		encrypted, iv, err := optimize.Encrypt(payload)
+		// Формат: [IV 12 bytes] [Encrypted data] [Tag 16 bytes]
+		encrypted, err := optimize.EncryptWireForStream(streamID, payload)
 		if err != nil {
 			return 0, err
 		}
-
-		// Формат: [IV 12 bytes] [Encrypted data] [Tag 16 bytes]
-		// Но Encrypt возвращает только encrypted с tag, а IV отдельно
-		// Нужно объединить IV и encrypted
-		finalEncrypted := make([]byte, len(iv)+len(encrypted))
-		copy(finalEncrypted[0:len(iv)], iv)
-		copy(finalEncrypted[len(iv):], encrypted)
-		payload = finalEncrypted
+		payload = encrypted
 	}
 
 	// 3. Создание заголовка
@@ -167,19 +311,48 @@ func Send(conn interface{}, streamID uint32, opcode, proto uint8, data []byte, f
 		return 0, errors.New("timestamp conversion failed")
 	}
 	hdr.Timestamp = timestamp
-	hdr.Seq = 0 // TODO: управление sequence numbers
+	hdr.Seq = opts.Seq
+
+	// Пакет, не помещающийся в датаграмму, уйдёт фрагментами; Seq задаётся
+	// до HMAC, так как входит в подписанный заголовок
+	var udpMTU uint
+	if udpConn, ok := conn.(net.PacketConn); ok && proto == core.ProtoUDP {
+		udpMTU = transport.UDPMaxPacket(udpConn)
+		packetSize := core.HeaderSize + len(payload) + 4
+		if (flags & core.FlagAuthenticated) != 0 {
+			packetSize += optimize.HMACSize
+		}
+		if autoSeq && packetSize > int(udpMTU) {
+			hdr.Seq = fragmentSeq.Add(1)
+		}
+	}
+
+	// 4. Аутентификация (HMAC-SHA256 заголовка и итогового payload)
+	// Вычисляется последним, после компрессии и шифрования
+	if (flags & core.FlagAuthenticated) != 0 {
+		payload, err = optimize.SignPacket(hdr, payload)
+		if err != nil {
+			return 0, err
+		}
+	}
 
-	// 4. Отправка через выбранный транспорт
+	// 5. Отправка через выбранный транспорт
 	switch proto {
 	case core.ProtoTCP:
-		tcpConn, ok := conn.(net.Conn)
+		if tcpConn != nil {
+			if streamCompressed {
+				return transport.TCPSendStream(tcpConn, hdr, payload)
+			}
+			return transport.TCPSendConn(tcpConn, hdr, payload)
+		}
+		netConn, ok := conn.(net.Conn)
 		if !ok {
 			return 0, errors.New("invalid connection type for TCP")
 		}
-		return transport.TCPSend(tcpConn, hdr, payload)
+		return transport.TCPSend(netConn, hdr, payload)
 
 	case core.ProtoUDP:
-		udpConn, ok := conn.(*net.UDPConn)
+		udpConn, ok := conn.(net.PacketConn)
 		if !ok {
 			return 0, errors.New("invalid connection type for UDP")
 		}
@@ -188,16 +361,182 @@ func Send(conn interface{}, streamID uint32, opcode, proto uint8, data []byte, f
 		if (flags & core.FlagReliable) != 0 {
 			// TODO: использовать reliable transport
 			// Пока отправляем через обычный UDP
-			return transport.UDPSend(udpConn, hdr, payload, nil)
+			return transport.UDPSendFragmented(udpConn, hdr, payload, udpMTU, nil)
 		}
 
-		return transport.UDPSend(udpConn, hdr, payload, nil)
+		return transport.UDPSendFragmented(udpConn, hdr, payload, udpMTU, nil)
 
 	default:
 		return 0, errors.New("unsupported protocol")
 	}
 }
 
+// SendRaw отправляет уже сериализованный пакет (например, raw из TCPRecvRaw
+// или UDPRecvRaw) без повторной сериализации, сохраняя байты как есть -
+// в том числе CRC32 и payload, который ретранслятор не может расшифровать
+// Проверяются только Magic и соответствие длины PayloadLen
+// conn - *TCPConnection или net.Conn (TCP), либо подключённый net.PacketConn (UDP)
+func SendRaw(conn interface{}, data []byte) (int, error) {
+	mu.RLock()
+	if !initialized {
+		mu.RUnlock()
+		return 0, errors.New("not initialized")
+	}
+	mu.RUnlock()
+
+	switch c := conn.(type) {
+	case *TCPConnection:
+		return transport.TCPSendRawConn(c, data)
+	case net.PacketConn:
+		return transport.UDPSendRaw(c, data, nil)
+	case net.Conn:
+		return transport.TCPSendRaw(c, data)
+	default:
+		return 0, errors.New("invalid connection type")
+	}
+}
+
+// SendRawTo отправляет уже сериализованный пакет датаграммой на адрес addr
+// Подходит для UDP ретранслятора на неподключённом сокете
+func SendRawTo(conn net.PacketConn, data []byte, addr *net.UDPAddr) (int, error) {
+	mu.RLock()
+	if !initialized {
+		mu.RUnlock()
+		return 0, errors.New("not initialized")
+	}
+	mu.RUnlock()
+
+	return transport.UDPSendRaw(conn, data, addr)
+}
+
+// FastPathMaxPayload - максимальный payload, который SendFast отправляет без выделения памяти
+const FastPathMaxPayload = transport.PooledSendMaxPayload
+
+// ConnLimitCloseCode - код ControlClose для соединений сверх Config.MaxConnections
+const ConnLimitCloseCode = transport.ConnLimitCloseCode
+
+// GoingAwayCloseCode - код ControlClose, которым Drain уведомляет клиентов
+const GoingAwayCloseCode = transport.GoingAwayCloseCode
+
+// Drain переводит сервер в режим вывода из работы для обновления без простоя:
+// новые соединения отклоняются с ControlClose(GoingAwayCloseCode, reason),
+// открытые соединения получают такое же сообщение и продолжают работать
+// Режим выключается в Shutdown; состояние - Stats().Draining
+func Drain(reason string) error {
+	return transport.Drain(reason)
+}
+
+// IsDraining проверяет, включён ли режим Drain
+func IsDraining() bool {
+	return transport.IsDraining()
+}
+
+// CloseIdle закрывает TCP соединения без приёма и отправки данных дольше
+// threshold и возвращает их количество; время последней активности
+// соединения - ConnStats.LastActivity
+// Учитывается только обмен через *TCPConnection: отправляйте через него,
+// а не через исходный net.Conn, иначе соединение будет закрыто как простаивающее
+func CloseIdle(threshold time.Duration) int {
+	return transport.CloseIdle(threshold)
+}
+
+// SendFast отправляет небольшой пакет по TCP без компрессии и шифрования
+// Для payload до FastPathMaxPayload байт не выделяет память: заголовок на стеке,
+// сериализация в буфер из пула, без копии payload. Более крупные пакеты
+// отправляются через Send с flags = 0
+func SendFast(conn net.Conn, streamID uint32, opcode uint8, data []byte) (int, error) {
+	if len(data) > FastPathMaxPayload {
+		return Send(conn, streamID, opcode, core.ProtoTCP, data, 0)
+	}
+
+	mu.RLock()
+	if !initialized {
+		mu.RUnlock()
+		return 0, errors.New("not initialized")
+	}
+	mu.RUnlock()
+
+	timestamp, err := core.SafeInt64ToUint32(time.Now().Unix())
+	if err != nil {
+		return 0, errors.New("timestamp conversion failed")
+	}
+
+	hdr := core.PacketHeader{
+		Magic:      core.Magic,
+		Version:    core.Version,
+		Opcode:     opcode,
+		Proto:      core.ProtoTCP,
+		StreamID:   streamID,
+		PayloadLen: uint16(len(data)),
+		Timestamp:  timestamp,
+	}
+	return transport.TCPSendPooled(conn, &hdr, data)
+}
+
+// autoCompress применяет автоматическую компрессию
+// Если размер >= 512 байт, флаг компрессии не установлен и данные выглядят сжимаемыми
+// Возвращает итоговый payload и флаги
+func autoCompress(payload []byte, flags uint8) ([]byte, uint8) {
+	if len(payload) >= int(core.CompressThreshold) && (flags&core.FlagCompressed) == 0 {
+		// Несжимаемые данные (по оценке энтропии) не сжимаем вовсе,
+		// неэффективное сжатие отбрасываем - в обоих случаях продолжаем без компрессии
+		if compressed, ok := optimize.CompressIfWorthwhile(payload); ok {
+			return compressed, flags | core.FlagCompressed
+		}
+	}
+	return payload, flags
+}
+
+// emptyPayloadFlags снимает FlagCompressed и FlagEncrypted для пустого payload:
+// сжимать и шифровать нечего, а получатель не должен пытаться
+// распаковать или расшифровать пустые данные
+func emptyPayloadFlags(payload []byte, flags uint8) uint8 {
+	if len(payload) == 0 {
+		return flags &^ (core.FlagCompressed | core.FlagEncrypted)
+	}
+	return flags
+}
+
+// EstimateSize вычисляет итоговый размер пакета на проводе для Send:
+// заголовок + payload после компрессии и шифрования + CRC32
+// Для оценки компрессии данные действительно сжимаются, поэтому вызов
+// стоит столько же, сколько компрессия в Send
+// Шифрование добавляет фиксированные IV и tag (28 байт)
+func EstimateSize(data []byte, flags uint8) (int, error) {
+	if len(data) > 65535 {
+		return 0, errors.New("payload too large (max 65535 bytes)")
+	}
+
+	payload, flags := autoCompress(data, emptyPayloadFlags(data, flags))
+	size := len(payload) + payloadOverhead(flags)
+	if size > 65535 {
+		return 0, errors.New("payload too large (max 65535 bytes)")
+	}
+
+	return core.HeaderSize + size + 4, nil
+}
+
+// Overhead возвращает фиксированные накладные расходы пакета с флагами flags:
+// заголовок (24) + CRC32 (4) + IV и tag при FlagEncrypted (28) + HMAC
+// при FlagAuthenticated (32)
+// Компрессия не учитывается: её вклад зависит от данных и может быть отрицательным
+// Максимальный payload для пакета размером mtu: mtu - Overhead(flags)
+func Overhead(flags uint8) int {
+	return core.HeaderSize + payloadOverhead(flags) + 4
+}
+
+// payloadOverhead возвращает байты, добавляемые к payload шифрованием и HMAC
+func payloadOverhead(flags uint8) int {
+	size := 0
+	if (flags & core.FlagEncrypted) != 0 {
+		size += optimize.AESIVSize + optimize.AESGCMTagSize
+	}
+	if (flags & core.FlagAuthenticated) != 0 {
+		size += optimize.HMACSize
+	}
+	return size
+}
+
 // TCPListen создаёт TCP сервер на указанном порту
 func TCPListen(port uint16) (net.Listener, error) {
 	return transport.TCPListen(port)
@@ -208,14 +547,29 @@ func TCPAccept(listener net.Listener) (net.Conn, error) {
 	return transport.TCPAccept(listener)
 }
 
+// AcceptChan принимает соединения в отдельной горутине и передаёт их в канал
+// Каналы закрываются при закрытии listener
+func AcceptChan(listener net.Listener) (<-chan net.Conn, <-chan error) {
+	return transport.AcceptChan(listener)
+}
+
 // TCPConnect подключается к TCP серверу
 func TCPConnect(host string, port uint16) (net.Conn, error) {
 	return transport.TCPConnect(host, port)
 }
 
 // TCPRecv принимает пакет через TCP
+// При Config.DecodeOnRecv payload возвращается проверенным, расшифрованным и распакованным
 func TCPRecv(conn *TCPConnection) (*PacketHeader, []byte, error) {
-	return transport.TCPRecv(conn)
+	hdr, payload, err := transport.TCPRecv(conn)
+	if err != nil || !decodeOnRecv() {
+		return hdr, payload, err
+	}
+	payload, err = decodePayload(hdr, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hdr, payload, nil
 }
 
 // NewTCPConnection создаёт новое TCP соединение с state machine
@@ -223,19 +577,133 @@ func NewTCPConnection(conn net.Conn) *TCPConnection {
 	return transport.NewTCPConnection(conn)
 }
 
+// UnixListen создаёт слушающий Unix domain socket
+// Принятые соединения используются с NewTCPConnection и TCPRecv
+func UnixListen(path string) (*net.UnixListener, error) {
+	return transport.UnixListen(path)
+}
+
+// UnixConnect подключается к Unix domain socket
+func UnixConnect(path string) (*net.UnixConn, error) {
+	return transport.UnixConnect(path)
+}
+
+// UnixSendFDs отправляет пакет OpControl с файловыми дескрипторами (SCM_RIGHTS)
+func UnixSendFDs(conn *net.UnixConn, streamID uint32, payload []byte, fds []int) (int, error) {
+	return transport.UnixSendFDs(conn, streamID, payload, fds)
+}
+
+// UnixRecvFDs принимает пакет вместе с переданными файловыми дескрипторами
+func UnixRecvFDs(conn *net.UnixConn) (*PacketHeader, []byte, []int, error) {
+	return transport.UnixRecvFDs(conn)
+}
+
 // UDPBind создаёт UDP сокет с привязкой к порту
 func UDPBind(port uint16) (*net.UDPConn, error) {
 	return transport.UDPBind(port)
 }
 
+// UDPBindReusePort создаёт UDP сокет с SO_REUSEPORT (только Linux)
+// Позволяет запустить несколько циклов приёма на одном порту
+func UDPBindReusePort(port uint16) (*net.UDPConn, error) {
+	return transport.UDPBindReusePort(port)
+}
+
 // UDPConnect создаёт UDP сокет с подключением к удалённому адресу
 func UDPConnect(host string, port uint16) (*net.UDPConn, error) {
 	return transport.UDPConnect(host, port)
 }
 
+// RecvChan принимает пакеты в отдельной горутине и передаёт их в канал
+// с буфером size; заполненный канал приостанавливает чтение из сокета
+func RecvChan(conn *TCPConnection, size int) (<-chan Packet, <-chan error) {
+	return transport.RecvChan(conn, size)
+}
+
+// TCPRecvInto принимает пакет через TCP и записывает payload в buf
+// При Config.DecodeOnRecv в buf записывается декодированный payload
+func TCPRecvInto(conn *TCPConnection, buf *bytes.Buffer) (*PacketHeader, error) {
+	hdr, err := transport.TCPRecvInto(conn, buf)
+	if err != nil || !decodeOnRecv() || !needsDecode(hdr) {
+		return hdr, err
+	}
+	payload, err := decodePayload(hdr, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+	buf.Reset()
+	buf.Write(payload)
+	return hdr, nil
+}
+
+// TCPRecvRaw принимает пакет через TCP и возвращает также его байты как на проводе
+func TCPRecvRaw(conn *TCPConnection) (*PacketHeader, []byte, []byte, error) {
+	return transport.TCPRecvRaw(conn)
+}
+
+// UDPRecvRaw принимает пакет через UDP и возвращает также датаграмму как на проводе
+func UDPRecvRaw(conn net.PacketConn) (*PacketHeader, []byte, []byte, *net.UDPAddr, error) {
+	return transport.UDPRecvRaw(conn)
+}
+
+// UDPRecvWorkers читает датаграммы в вызывающей горутине, а разбор и
+// декодирование (DecodePayload) выполняет в Config.UDPRecvWorkers горутинах
+// Пакеты одного отправителя передаются handler в порядке прихода
+// Возвращает ошибку чтения из conn (например, после его закрытия)
+func UDPRecvWorkers(conn net.PacketConn, handler UDPHandler) error {
+	return transport.UDPRecvWorkers(conn, func(hdr *PacketHeader, payload []byte, addr *net.UDPAddr, err error) {
+		if err == nil {
+			payload, err = decodePayload(hdr, payload)
+		}
+		if err != nil {
+			handler(nil, nil, addr, err)
+			return
+		}
+		handler(hdr, payload, addr, nil)
+	})
+}
+
+// NewUDPMux создаёт таблицу маршрутизации для UDPServe
+func NewUDPMux() *UDPMux {
+	return transport.NewUDPMux()
+}
+
+// UDPServe принимает пакеты из conn и распределяет их по опкодам mux:
+// пакеты надёжных сессий проходят через сессию (ACK, дубликаты), на OpPing
+// отвечает OpPong, остальные передаются обработчикам
+// Возвращает ошибку чтения из conn (например, после его закрытия)
+func UDPServe(conn net.PacketConn, mux *UDPMux) error {
+	return transport.UDPServe(conn, mux)
+}
+
 // UDPRecv принимает пакет через UDP
-func UDPRecv(conn *net.UDPConn) (*PacketHeader, []byte, *net.UDPAddr, error) {
-	return transport.UDPRecv(conn)
+// conn может быть *net.UDPConn или любой другой net.PacketConn
+// При Config.DecodeOnRecv payload декодируется как в TCPRecv
+func UDPRecv(conn net.PacketConn) (*PacketHeader, []byte, *net.UDPAddr, error) {
+	hdr, payload, addr, err := transport.UDPRecv(conn)
+	if err != nil || !decodeOnRecv() {
+		return hdr, payload, addr, err
+	}
+	payload, err = decodePayload(hdr, payload)
+	if err != nil {
+		return nil, nil, addr, err
+	}
+	return hdr, payload, addr, nil
+}
+
+// UDPRecvConnected принимает пакет из подключённого сокета (UDPConnect)
+// без адреса отправителя; для сокетов UDPBind используется UDPRecv
+// При Config.DecodeOnRecv payload декодируется как в UDPRecv
+func UDPRecvConnected(conn net.Conn) (*PacketHeader, []byte, error) {
+	hdr, payload, err := transport.UDPRecvConnected(conn)
+	if err != nil || !decodeOnRecv() {
+		return hdr, payload, err
+	}
+	payload, err = decodePayload(hdr, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+	return hdr, payload, nil
 }
 
 // SetEncryptionKey устанавливает ключ шифрования
@@ -243,16 +711,325 @@ func SetEncryptionKey(key [32]byte) error {
 	return optimize.SetEncryptionKey(key)
 }
 
+// SetEncryptionKeyBytes устанавливает ключ шифрования длиной 16, 24 или 32 байта
+// Вариант AES-128/192/256 выбирается по длине ключа
+func SetEncryptionKeyBytes(key []byte) error {
+	return optimize.SetEncryptionKeyBytes(key)
+}
+
+// SetStreamKey устанавливает ключ шифрования для потока streamID
+// Send и DecryptPayload используют его вместо глобального ключа
+func SetStreamKey(streamID uint32, key [32]byte) error {
+	return optimize.SetStreamKey(streamID, key)
+}
+
+// SetStreamKeyBytes устанавливает ключ потока длиной 16, 24 или 32 байта
+func SetStreamKeyBytes(streamID uint32, key []byte) error {
+	return optimize.SetStreamKeyBytes(streamID, key)
+}
+
+// ErrInvalidKeySize - длина ключа шифрования не 16, 24 или 32 байта
+var ErrInvalidKeySize = optimize.ErrInvalidKeySize
+
+// ClearStreamKey удаляет ключ потока при его закрытии
+func ClearStreamKey(streamID uint32) {
+	optimize.ClearStreamKey(streamID)
+}
+
+// DecryptPayload расшифровывает payload принятого пакета с FlagEncrypted
+// Формат payload как в Send: [IV 12 bytes] [Encrypted data] [Tag 16 bytes]
+// Ключ выбирается по hdr.StreamID, иначе используется глобальный
+func DecryptPayload(hdr *PacketHeader, payload []byte) ([]byte, error) {
+	if (hdr.Flags & core.FlagEncrypted) == 0 {
+		return payload, nil
+	}
+	return optimize.DecryptWireForStream(hdr.StreamID, payload)
+}
+
+// DecodePayload возвращает исходные данные принятого пакета, выполняя шаги
+// Send в обратном порядке: проверка HMAC, расшифровка, распаковка
+// Снятые флаги сбрасываются в hdr, а PayloadLen становится размером результата
+func DecodePayload(hdr *PacketHeader, payload []byte) ([]byte, error) {
+	return decodePayload(hdr, payload)
+}
+
+// decodePayload - обратный конвейер Send (сжатие -> шифрование -> HMAC):
+// HMAC -> расшифровка -> распаковка. Порядок менять нельзя: HMAC покрывает
+// шифротекст, а сжимались открытые данные
+// Флаг снимается сразу после своего шага, поэтому повторный вызов
+// для того же hdr ничего не меняет
+func decodePayload(hdr *PacketHeader, payload []byte) ([]byte, error) {
+	payload, err := optimize.VerifyPacket(hdr, payload)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Flags &^= core.FlagAuthenticated
+
+	payload, err = DecryptPayload(hdr, payload)
+	if err != nil {
+		return nil, err
+	}
+	hdr.Flags &^= core.FlagEncrypted
+
+	if hdr.Flags&core.FlagCompressed != 0 && len(payload) > 0 {
+		payload, err = optimize.Decompress(payload)
+		if err != nil {
+			return nil, err
+		}
+	}
+	hdr.Flags &^= core.FlagCompressed
+
+	if payloadLen, err := core.SafeIntToUint16(len(payload)); err == nil {
+		hdr.PayloadLen = payloadLen
+	}
+	return payload, nil
+}
+
+// needsDecode проверяет, изменит ли decodePayload payload пакета
+func needsDecode(hdr *PacketHeader) bool {
+	return hdr.Flags&(core.FlagAuthenticated|core.FlagEncrypted|core.FlagCompressed) != 0
+}
+
+// decodeOnRecv проверяет, включён ли Config.DecodeOnRecv
+func decodeOnRecv() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return config != nil && config.DecodeOnRecv
+}
+
+// SetIVSource задаёт источник IV для шифрования; nil - crypto/rand
+// Повтор одного из последних IV внешнего источника отклоняется с ErrIVReuse
+func SetIVSource(r io.Reader) {
+	optimize.SetIVSource(r)
+}
+
+// ErrIVReuse - источник IV вернул уже использованное значение
+var ErrIVReuse = optimize.ErrIVReuse
+
+// SetNonceMode выбирает способ формирования IV: случайный (по умолчанию)
+// или соль ключа + 64-битный счётчик для долгоживущих ключей
+func SetNonceMode(mode NonceMode) error {
+	return optimize.SetNonceMode(mode)
+}
+
+// ErrRekeyRequired - счётчик IV ключа исчерпан, нужно установить новый ключ
+var ErrRekeyRequired = optimize.ErrRekeyRequired
+
+// SetAuthKey устанавливает общий ключ HMAC-SHA256 для пакетов с FlagAuthenticated
+func SetAuthKey(key [32]byte) {
+	optimize.SetAuthKey(key)
+}
+
+// VerifyPayload проверяет HMAC принятого пакета с FlagAuthenticated
+// и возвращает payload без HMAC; остальные пакеты возвращаются без изменений
+// Для пакета, который также зашифрован, вызывается до DecryptPayload
+func VerifyPayload(hdr *PacketHeader, payload []byte) ([]byte, error) {
+	return optimize.VerifyPacket(hdr, payload)
+}
+
+// ErrHMACMismatch - HMAC принятого пакета не совпал
+var ErrHMACMismatch = optimize.ErrHMACMismatch
+
 // IsEncryptionEnabled проверяет, установлен ли ключ шифрования
 func IsEncryptionEnabled() bool {
 	return optimize.IsEncryptionEnabled()
 }
 
+// Stats возвращает снимок состояния библиотеки:
+// количество активных TCP соединений и надёжных UDP сессий,
+// общий объём трафика и состояние каждого соединения
+// Thread-safe
+func Stats() StatsSnapshot {
+	return transport.GetStats()
+}
+
+// CodecStats возвращает снимок статистики кодека: число и объём
+// сериализованных и десериализованных пакетов, их темп и, при
+// Config.CodecLatency, p50/p99 задержки одного вызова
+// Позволяет отличить упор в CPU кодека от упора в сеть
+// Thread-safe
+func CodecStats() CodecStatsSnapshot {
+	return core.GetCodecStats()
+}
+
+// ResetCodecStats обнуляет статистику кодека и начинает новый период замера
+func ResetCodecStats() {
+	core.ResetCodecStats()
+}
+
+// NewGapDetector создаёт детектор пропусков sequence numbers
+// onGap может быть nil - тогда пропуски только считаются
+func NewGapDetector(onGap GapFunc) *GapDetector {
+	return core.NewGapDetector(onGap)
+}
+
+// NewReliableSession создаёт надёжную UDP сессию с удалённой стороной addr
+// ACK и ретрансмиссии обрабатываются внутренней горутиной сессии
+func NewReliableSession(conn net.PacketConn, addr *net.UDPAddr, streamID uint32) (*ReliableSession, error) {
+	return transport.NewReliableSession(conn, addr, streamID)
+}
+
+// NewFragmentReassembler создаёт сборщик фрагментов
+// Сообщения разных Seq одного потока собираются одновременно
+func NewFragmentReassembler() *FragmentReassembler {
+	return core.NewFragmentReassembler()
+}
+
 // NewConfig создаёт новую конфигурацию
 func NewConfig() *core.Config {
 	return core.NewConfig()
 }
 
+// IsOverProtoPacket быстро проверяет Magic в начале данных без аллокаций
+func IsOverProtoPacket(data []byte) bool {
+	return core.IsOverProtoPacket(data)
+}
+
+// SendControl кодирует управляющее сообщение и отправляет его пакетом OpControl
+func SendControl(conn interface{}, streamID uint32, proto uint8, msg *ControlMessage, flags uint8) (int, error) {
+	payload, err := core.EncodeControl(msg)
+	if err != nil {
+		return 0, err
+	}
+	return Send(conn, streamID, core.OpControl, proto, payload, flags)
+}
+
+// EncodeControl кодирует управляющее сообщение в payload для OpControl
+func EncodeControl(msg *ControlMessage) ([]byte, error) {
+	return core.EncodeControl(msg)
+}
+
+// DecodeControl разбирает payload пакета OpControl
+func DecodeControl(data []byte) (*ControlMessage, error) {
+	return core.DecodeControl(data)
+}
+
+// NewWindowUpdate создаёт сообщение об обновлении окна приёма
+func NewWindowUpdate(window uint32) *ControlMessage {
+	return core.NewWindowUpdate(window)
+}
+
+// NewCloseMessage создаёт сообщение о закрытии
+func NewCloseMessage(code uint16, reason string) *ControlMessage {
+	return core.NewCloseMessage(code, reason)
+}
+
+// NewPingConfig создаёт сообщение с параметрами keepalive
+func NewPingConfig(interval, timeout time.Duration) *ControlMessage {
+	return core.NewPingConfig(interval, timeout)
+}
+
+// NewMTUReport создаёт сообщение об MTU пути
+func NewMTUReport(mtu uint16) *ControlMessage {
+	return core.NewMTUReport(mtu)
+}
+
+// NewConnectionIDMessage создаёт сообщение с идентификатором соединения
+func NewConnectionIDMessage(id uint64) *ControlMessage {
+	return core.NewConnectionIDMessage(id)
+}
+
+// NewPathChallenge создаёт запрос проверки адреса с токеном token
+func NewPathChallenge(token uint64) *ControlMessage {
+	return core.NewPathChallenge(token)
+}
+
+// NewPathResponse создаёт ответ на проверку адреса
+func NewPathResponse(token uint64) *ControlMessage {
+	return core.NewPathResponse(token)
+}
+
+// NewStreamBegin создаёт сообщение о начале потоковой передачи
+func NewStreamBegin() *ControlMessage {
+	return core.NewStreamBegin()
+}
+
+// NewStreamEnd создаёт сообщение о завершении передачи length байт
+func NewStreamEnd(length uint64) *ControlMessage {
+	return core.NewStreamEnd(length)
+}
+
+// NewStreamAbort создаёт сообщение о прерывании передачи после length байт
+func NewStreamAbort(length uint64, code uint16, reason string) *ControlMessage {
+	return core.NewStreamAbort(length, code, reason)
+}
+
+// NewCompressReset создаёт сообщение о сбросе словаря потоковой компрессии
+func NewCompressReset() *ControlMessage {
+	return core.NewCompressReset()
+}
+
+// NewNACK создаёт запрос повторной отправки пропущенных пакетов seqs
+func NewNACK(seqs []uint32) *ControlMessage {
+	return core.NewNACK(seqs)
+}
+
+// SerializeTo записывает пакет в w без сборки всего пакета в памяти
+// CRC32 вычисляется по мере записи
+func SerializeTo(w io.Writer, hdr *PacketHeader, payload []byte) (int, error) {
+	return core.SerializeTo(w, hdr, payload)
+}
+
+// ParseHeader разбирает только заголовок пакета без проверки payload и CRC32
+func ParseHeader(data []byte) (*PacketHeader, error) {
+	return core.ParseHeader(data)
+}
+
+// ErrInvalidRawPacket - данные для SendRaw не являются сериализованным пакетом
+var ErrInvalidRawPacket = transport.ErrInvalidRawPacket
+
+// ErrCRCMismatch - CRC32 принятого пакета не совпал (см. TCPConnection.Resync)
+var ErrCRCMismatch = core.ErrCRCMismatch
+
+// ErrDatagramTruncated - принятая UDP датаграмма была обрезана
+var ErrDatagramTruncated = transport.ErrDatagramTruncated
+
+// ErrAuthFailed - первый пакет соединения не прошёл аутентификацию
+var ErrAuthFailed = transport.ErrAuthFailed
+
+// ErrPeerDead - удалённая сторона надёжной сессии перестала подтверждать пакеты
+var ErrPeerDead = transport.ErrPeerDead
+
+// ErrReorderBufferFull - пакеты, ожидающие пропущенный, превысили Config.MaxReorderBuffer
+var ErrReorderBufferFull = transport.ErrReorderBufferFull
+
+// ErrSessionClosed - надёжная сессия закрыта
+var ErrSessionClosed = transport.ErrSessionClosed
+
+// ErrProtoMismatch - поле Proto пакета не соответствует транспорту (Config.ValidateProto)
+var ErrProtoMismatch = transport.ErrProtoMismatch
+
+// ErrWriteTimeout - отправка не завершилась за Config.WriteTimeout
+var ErrWriteTimeout = transport.ErrWriteTimeout
+
+// ErrRecvTimeout - приём TCP прерван дедлайном чтения; частично принятый
+// пакет сохранён, и повторный вызов продолжает его
+var ErrRecvTimeout = transport.ErrRecvTimeout
+
+// ErrKeepAliveFailed - удалённая сторона не ответила на TCP keepalive пробы
+var ErrKeepAliveFailed = transport.ErrKeepAliveFailed
+
+// ErrKeepAliveUnsupported - интервал и число keepalive проб не настраиваются на этой платформе
+var ErrKeepAliveUnsupported = transport.ErrKeepAliveUnsupported
+
+// ErrBindInterfaceUnsupported - Config.BindInterface не поддерживается на этой платформе
+var ErrBindInterfaceUnsupported = transport.ErrBindInterfaceUnsupported
+
+// ErrFDsTruncated - ядро отбросило часть дескрипторов пакета UnixRecvFDs
+var ErrFDsTruncated = transport.ErrFDsTruncated
+
+// ErrPeerUnreachable - на UDP порту удалённой стороны никто не слушает
+var ErrPeerUnreachable = transport.ErrPeerUnreachable
+
+// ErrReassemblyLimit - превышен лимит сборки фрагментов
+var ErrReassemblyLimit = core.ErrReassemblyLimit
+
+// SetReassemblyLimits задаёт лимиты одновременных сборок и буферизованных байт фрагментов
+// 0 означает значение по умолчанию
+func SetReassemblyLimits(maxContexts int, maxBytes uint64) {
+	core.SetReassemblyLimits(maxContexts, maxBytes)
+}
+
 // Экспортируем константы для удобства
 const (
 	FlagFragment   = core.FlagFragment
@@ -260,6 +1037,10 @@ const (
 	FlagEncrypted  = core.FlagEncrypted
 	FlagReliable   = core.FlagReliable
 	FlagACK        = core.FlagACK
+	FlagPriority   = core.FlagPriority
+
+	FlagAuthenticated = core.FlagAuthenticated
+	FlagOrdered       = core.FlagOrdered
 
 	OpData    = core.OpData
 	OpControl = core.OpControl
@@ -270,4 +1051,38 @@ const (
 	ProtoTCP  = core.ProtoTCP
 	ProtoUDP  = core.ProtoUDP
 	ProtoHTTP = core.ProtoHTTP
+
+	HeaderSize = core.HeaderSize
+
+	CRCHeaderAndPayload = core.CRCHeaderAndPayload
+	CRCPayloadOnly      = core.CRCPayloadOnly
+
+	ControlWindowUpdate  = core.ControlWindowUpdate
+	ControlClose         = core.ControlClose
+	ControlPingConfig    = core.ControlPingConfig
+	ControlMTUReport     = core.ControlMTUReport
+	ControlConnectionID  = core.ControlConnectionID
+	ControlPathChallenge = core.ControlPathChallenge
+	ControlPathResponse  = core.ControlPathResponse
+	ControlStreamBegin   = core.ControlStreamBegin
+	ControlStreamEnd     = core.ControlStreamEnd
+	ControlNACK          = core.ControlNACK
+	ControlCompressReset = core.ControlCompressReset
+
+	TagWindow   = core.TagWindow
+	TagCode     = core.TagCode
+	TagReason   = core.TagReason
+	TagInterval = core.TagInterval
+	TagTimeout  = core.TagTimeout
+	TagMTU      = core.TagMTU
+	TagConnID   = core.TagConnID
+	TagToken    = core.TagToken
+	TagLength   = core.TagLength
+	TagSeqs     = core.TagSeqs
+
+	CongestionReno = core.CongestionReno
+	CongestionBBR  = core.CongestionBBR
+
+	NonceRandom  = optimize.NonceRandom
+	NonceCounter = optimize.NonceCounter
 )
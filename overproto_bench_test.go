@@ -0,0 +1,79 @@
+package overproto
+
+import (
+	"net"
+	"testing"
+)
+
+// BenchmarkSendRecv измеряет полный цикл Send -> TCPRecv через net.Pipe
+func BenchmarkSendRecv(b *testing.B) {
+	if err := Init(nil); err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	recvConn := NewTCPConnection(server)
+	data := make([]byte, 256)
+
+	done := make(chan error, 1)
+	go func() {
+		for i := 0; i < b.N; i++ {
+			if _, _, err := TCPRecv(recvConn); err != nil {
+				done <- err
+				return
+			}
+		}
+		done <- nil
+	}()
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Send(client, 1, OpData, ProtoTCP, data, 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := <-done; err != nil {
+		b.Fatal(err)
+	}
+}
+
+// discardConn - net.Conn, отбрасывающий записанные данные
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func BenchmarkSendFast(b *testing.B) {
+	if err := Init(nil); err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	var conn net.Conn = discardConn{}
+	data := make([]byte, 256)
+
+	b.ReportAllocs()
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := SendFast(conn, 1, OpData, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// TestSendFastZeroAllocs проверяет, что SendFast для небольшого пакета не выделяет память
+func TestSendFastZeroAllocs(t *testing.T) {
+	result := testing.Benchmark(BenchmarkSendFast)
+	if allocs := result.AllocsPerOp(); allocs != 0 {
+		t.Fatalf("SendFast: %d allocs/op, want 0", allocs)
+	}
+}
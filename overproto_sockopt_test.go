@@ -0,0 +1,45 @@
+//go:build !windows
+
+package overproto
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// TestInitZeroConfigSetsReuseAddr проверяет, что литерал Config без
+// DisableReuseAddr сохраняет SO_REUSEADDR на слушающих сокетах
+func TestInitZeroConfigSetsReuseAddr(t *testing.T) {
+	if err := Init(&core.Config{}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	// Go сам выставляет SO_REUSEADDR на слушающих TCP сокетах, поэтому
+	// проверяется UDPBind
+	conn, err := UDPBind(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reuse int
+	var getErr error
+	if err := raw.Control(func(fd uintptr) {
+		reuse, getErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if reuse == 0 {
+		t.Fatal("SO_REUSEADDR not set for a zero Config")
+	}
+}
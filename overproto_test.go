@@ -0,0 +1,639 @@
+package overproto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// TestSendDoesNotModifyData проверяет, что Send без копирования payload
+// не изменяет данные вызывающего ни в одном из режимов
+func TestSendDoesNotModifyData(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+	if err := SetEncryptionKey([32]byte{7}); err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+
+	data := bytes.Repeat([]byte("compressible "), 100)
+	orig := append([]byte(nil), data...)
+
+	for _, flags := range []uint8{0, FlagEncrypted} {
+		if _, err := Send(client, 1, OpData, ProtoTCP, data, flags); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, orig) {
+			t.Fatalf("Send modified caller data with flags %#x", flags)
+		}
+	}
+}
+
+func TestSendAuthenticatedVerify(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+	SetAuthKey([32]byte{9})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewTCPConnection(server)
+
+	go func() {
+		_, _ = Send(client, 5, OpData, ProtoTCP, []byte("public but signed"), FlagAuthenticated)
+	}()
+
+	hdr, payload, err := TCPRecv(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := VerifyPayload(hdr, payload)
+	if err != nil || string(data) != "public but signed" {
+		t.Fatalf("verify failed: %q %v", data, err)
+	}
+
+	// Подмена StreamID или payload обнаруживается
+	forged := *hdr
+	forged.StreamID = 6
+	if _, err := VerifyPayload(&forged, payload); !errors.Is(err, ErrHMACMismatch) {
+		t.Fatalf("expected HMAC mismatch for forged header, got %v", err)
+	}
+	payload[0] ^= 0xFF
+	if _, err := VerifyPayload(hdr, payload); !errors.Is(err, ErrHMACMismatch) {
+		t.Fatalf("expected HMAC mismatch for forged payload, got %v", err)
+	}
+}
+
+func TestOverheadMatchesEstimateSize(t *testing.T) {
+	data := []byte{1, 2, 3}
+	for _, flags := range []uint8{0, FlagEncrypted, FlagAuthenticated, FlagEncrypted | FlagAuthenticated} {
+		size, err := EstimateSize(data, flags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size != len(data)+Overhead(flags) {
+			t.Fatalf("flags %#x: EstimateSize %d, Overhead %d", flags, size, Overhead(flags))
+		}
+	}
+	if Overhead(0) != 28 || Overhead(FlagEncrypted) != 56 {
+		t.Fatalf("unexpected overhead: %d, %d", Overhead(0), Overhead(FlagEncrypted))
+	}
+}
+
+// failingReader возвращает данные, затем ошибку чтения
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestSendStreamRoundTrip(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+	if err := SetEncryptionKey([32]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewTCPConnection(server)
+
+	// Несколько пакетов данных, сжимаемая часть и неполный последний пакет
+	data := append(bytes.Repeat([]byte("stream "), 20000), make([]byte, StreamChunkSize/3)...)
+	sendErr := make(chan error, 1)
+	go func() {
+		n, err := SendStream(client, 9, bytes.NewReader(data), FlagEncrypted)
+		if err == nil && n != int64(len(data)) {
+			err = errors.New("short stream")
+		}
+		sendErr <- err
+	}()
+
+	reader, err := RecvStream(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.TransferID() != 9 || !bytes.Equal(got, data) {
+		t.Fatalf("stream mismatch: id %d, %d of %d bytes", reader.TransferID(), len(got), len(data))
+	}
+	if err := <-sendErr; err != nil {
+		t.Fatal(err)
+	}
+
+	// Ошибка источника прерывает передачу у получателя
+	readErr := errors.New("disk failure")
+	go func() {
+		_, _ = SendStream(client, 10, &failingReader{data: []byte("partial"), err: readErr}, 0)
+	}()
+	reader, err = RecvStream(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(reader); !errors.Is(err, ErrStreamAborted) {
+		t.Fatalf("expected ErrStreamAborted, got %v", err)
+	}
+}
+
+func TestSendEmptyPayload(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+	if err := SetEncryptionKey([32]byte{8}); err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewTCPConnection(server)
+
+	flags := uint8(FlagCompressed | FlagEncrypted)
+	sendErr := make(chan error, 1)
+	go func() {
+		_, err := Send(client, 4, OpData, ProtoTCP, nil, flags)
+		sendErr <- err
+	}()
+
+	hdr, payload, err := TCPRecv(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-sendErr; err != nil {
+		t.Fatal(err)
+	}
+	if hdr.PayloadLen != 0 || len(payload) != 0 || hdr.Flags&flags != 0 {
+		t.Fatalf("unexpected empty packet: %+v %x", hdr, payload)
+	}
+	if size, err := EstimateSize(nil, flags); err != nil || size != Overhead(0) {
+		t.Fatalf("EstimateSize for empty payload: %d %v", size, err)
+	}
+}
+
+// TestSendRawRelaysBytes проверяет, что ретранслятор передаёт пакет
+// с зашифрованным payload без изменений
+func TestSendRawRelaysBytes(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+	if err := SetEncryptionKey([32]byte{3}); err != nil {
+		t.Fatal(err)
+	}
+
+	srcClient, srcServer := net.Pipe()
+	defer srcClient.Close()
+	defer srcServer.Close()
+	dstClient, dstServer := net.Pipe()
+	defer dstClient.Close()
+	defer dstServer.Close()
+
+	go func() {
+		_, _ = Send(srcClient, 2, OpData, ProtoTCP, []byte("secret"), FlagEncrypted)
+	}()
+	_, _, raw, err := TCPRecvRaw(NewTCPConnection(srcServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		if _, err := SendRaw(dstClient, raw); err != nil {
+			t.Error(err)
+		}
+	}()
+	_, _, relayed, err := TCPRecvRaw(NewTCPConnection(dstServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(relayed, raw) {
+		t.Fatal("relayed packet differs from the original bytes")
+	}
+
+	if _, err := SendRaw(dstClient, raw[:len(raw)-1]); !errors.Is(err, ErrInvalidRawPacket) {
+		t.Fatalf("expected ErrInvalidRawPacket for truncated packet, got %v", err)
+	}
+}
+
+// TestDecodeOnRecvRoundTrip проверяет обратный порядок декодирования:
+// payload сжат, зашифрован и подписан при отправке
+func TestDecodeOnRecvRoundTrip(t *testing.T) {
+	cfg := NewConfig()
+	cfg.DecodeOnRecv = true
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+	if err := SetEncryptionKey([32]byte{11}); err != nil {
+		t.Fatal(err)
+	}
+	SetAuthKey([32]byte{12})
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewTCPConnection(server)
+
+	data := bytes.Repeat([]byte("compress then encrypt "), 200)
+	flags := uint8(FlagEncrypted | FlagAuthenticated)
+	go func() {
+		_, _ = Send(client, 2, OpData, ProtoTCP, data, flags)
+		_, _ = Send(client, 2, OpData, ProtoTCP, data, flags)
+	}()
+
+	hdr, payload, err := TCPRecv(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(payload, data) || hdr.Flags != 0 || int(hdr.PayloadLen) != len(data) {
+		t.Fatalf("decode mismatch: flags %#x, %d of %d bytes", hdr.Flags, len(payload), len(data))
+	}
+
+	// Повторное декодирование ничего не меняет
+	if again, err := DecodePayload(hdr, payload); err != nil || !bytes.Equal(again, data) {
+		t.Fatalf("second decode changed payload: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := TCPRecvInto(conn, &buf); err != nil || !bytes.Equal(buf.Bytes(), data) {
+		t.Fatalf("TCPRecvInto did not decode: %v", err)
+	}
+}
+
+func TestRequestConcurrent(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewTCPConnection(client)
+	serverConn := NewTCPConnection(server)
+
+	// Сервер отвечает на пару запросов в обратном порядке,
+	// третий запрос остаётся без ответа
+	go func() {
+		var reqs []Packet
+		for {
+			hdr, payload, err := TCPRecv(serverConn)
+			if err != nil {
+				return
+			}
+			if string(payload) == "ignored" {
+				continue
+			}
+			reqs = append(reqs, Packet{Header: hdr, Payload: payload})
+			if len(reqs) == 2 {
+				for i := len(reqs) - 1; i >= 0; i-- {
+					_, _ = Respond(server, reqs[i].Header, append([]byte("re: "), reqs[i].Payload...), 0)
+				}
+				reqs = nil
+			}
+		}
+	}()
+
+	results := make(chan error, 2)
+	for _, msg := range []string{"first", "second"} {
+		msg := msg
+		go func() {
+			resp, err := Request(conn, OpData, []byte(msg), 2*time.Second)
+			if err == nil && string(resp) != "re: "+msg {
+				err = errors.New("mismatched response " + string(resp) + " for " + msg)
+			}
+			results <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-results; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := Request(conn, OpData, []byte("ignored"), 50*time.Millisecond); !errors.Is(err, ErrRequestTimeout) {
+		t.Fatalf("expected ErrRequestTimeout, got %v", err)
+	}
+}
+
+func TestRequestSurvivesTimeoutAndBadPackets(t *testing.T) {
+	cfg := NewConfig()
+	cfg.ValidateProto = true
+	if err := Init(cfg); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewTCPConnection(client)
+	serverConn := NewTCPConnection(server)
+
+	// Дедлайн чтения истекает, пока сервер медлит с ответом; затем приходят
+	// пакет с повреждённым CRC32 и пакет с чужим Proto, и только потом ответ
+	_ = client.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	go func() {
+		req, _, err := TCPRecv(serverConn)
+		if err != nil {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+
+		bad := core.NewPacketHeader()
+		bad.StreamID = req.StreamID
+		bad.Opcode = OpData
+		bad.Proto = ProtoTCP
+		bad.PayloadLen = 3
+		corrupt, _ := core.Serialize(bad, []byte("bad"))
+		corrupt[len(corrupt)-1] ^= 0xFF
+		bad.Proto = ProtoUDP
+		foreign, _ := core.Serialize(bad, []byte("udp"))
+		_, _ = server.Write(append(corrupt, foreign...))
+		_, _ = Respond(server, req, []byte("ok"), 0)
+	}()
+
+	resp, err := Request(conn, OpData, []byte("ping"), 2*time.Second)
+	if err != nil || string(resp) != "ok" {
+		t.Fatalf("Request: %q %v", resp, err)
+	}
+}
+
+func TestRequestAfterFailureDoesNotSend(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := NewTCPConnection(client)
+
+	// Демультиплексор, приём которого уже завершился ошибкой
+	demuxesMu.Lock()
+	demuxes[conn] = &requestDemux{conn: conn, pending: make(map[uint32]chan requestResult), err: io.EOF}
+	demuxesMu.Unlock()
+	defer func() {
+		demuxesMu.Lock()
+		delete(demuxes, conn)
+		demuxesMu.Unlock()
+	}()
+
+	result := make(chan error, 1)
+	go func() {
+		_, err := Request(conn, OpData, []byte("lost"), time.Second)
+		result <- err
+	}()
+
+	_ = server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if n, err := server.Read(make([]byte, 64)); err == nil {
+		t.Fatalf("request sent after the demux failed: %d bytes", n)
+	}
+	if err := <-result; !errors.Is(err, io.EOF) {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestSendChunksSplitsLargeData(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+	if err := SetEncryptionKey([32]byte{5}); err != nil {
+		t.Fatal(err)
+	}
+
+	data := make([]byte, 150000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	chunks := Chunk(data, FlagEncrypted)
+	if len(chunks) != 3 || len(chunks[0]) != MaxChunkSize(FlagEncrypted) {
+		t.Fatalf("unexpected chunks: %d", len(chunks))
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() {
+		if _, err := SendChunks(client, 9, OpData, ProtoTCP, data, FlagEncrypted); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	conn := NewTCPConnection(server)
+	var got []byte
+	for seq := uint32(0); seq < 3; seq++ {
+		hdr, payload, err := TCPRecv(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.StreamID != 9 || hdr.Seq != seq {
+			t.Fatalf("chunk %d: stream %d seq %d", seq, hdr.StreamID, hdr.Seq)
+		}
+		plain, err := DecodePayload(hdr, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, plain...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("reassembled data differs")
+	}
+}
+
+func TestSendWithOptionsReproducible(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		for i := 0; i < 2; i++ {
+			if _, err := SendWithOptions(client, 1, OpData, ProtoTCP, []byte("same"), 0, SendOptions{Seq: 3}); err != nil {
+				t.Error(err)
+			}
+		}
+	}()
+
+	conn := NewTCPConnection(server)
+	hdr, _, first, err := TCPRecvRaw(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.Seq != 3 {
+		t.Fatalf("seq %d", hdr.Seq)
+	}
+	_, _, second, err := TCPRecvRaw(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("identical sends produced different packets")
+	}
+	// Timestamp не передаётся, поэтому время отправки не влияет на байты
+	if !bytes.Equal(first[20:24], make([]byte, 4)) {
+		t.Fatalf("timestamp bytes on the wire: % x", first[20:24])
+	}
+}
+
+func TestSendFragmentsLargeUDPPayload(t *testing.T) {
+	if err := Init(nil); err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = Shutdown() }()
+
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	SetAuthKey([32]byte{8})
+
+	data := make([]byte, 10000)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Send(client, 4, OpData, ProtoUDP, data, FlagAuthenticated); err != nil {
+		t.Fatal(err)
+	}
+
+	// Config.MTU = 1400: каждая датаграмма - фрагмент не больше MTU
+	reassembler := NewFragmentReassembler()
+	defer reassembler.Close()
+	_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+	datagrams := 0
+	for {
+		_, _, raw, _, err := UDPRecvRaw(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		datagrams++
+		if len(raw) > 1400 {
+			t.Fatalf("datagram of %d bytes exceeds MTU", len(raw))
+		}
+		hdr, payload, err := reassembler.Add(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr == nil {
+			continue
+		}
+		plain, err := DecodePayload(hdr, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plain, data) || hdr.StreamID != 4 {
+			t.Fatal("reassembled message differs")
+		}
+		break
+	}
+	if datagrams < 8 {
+		t.Fatalf("message sent in %d datagrams", datagrams)
+	}
+}
+
+func TestSetDeterministicReproducesEncryptedPackets(t *testing.T) {
+	// Несжимаемые данные: сообщение не помещается в одну датаграмму
+	large := make([]byte, 5000)
+	if _, err := rand.Read(large); err != nil {
+		t.Fatal(err)
+	}
+
+	// SetDeterministic вызывается до Init, как в типичной подготовке теста
+	capture := func(seed int64) []byte {
+		t.Helper()
+		SetDeterministic(seed)
+		if err := Init(nil); err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = Shutdown() }()
+		if err := SetEncryptionKey([32]byte{3}); err != nil {
+			t.Fatal(err)
+		}
+
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+		go func() {
+			if _, err := Send(client, 1, OpData, ProtoTCP, []byte("golden"), FlagEncrypted); err != nil {
+				t.Error(err)
+			}
+		}()
+		_, _, raw, err := TCPRecvRaw(NewTCPConnection(server))
+		if err != nil {
+			t.Fatal(err)
+		}
+		packets := append([]byte(nil), raw...)
+
+		// Первый фрагмент большого UDP сообщения несёт Seq из счётчика фрагментов
+		udpServer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer udpServer.Close()
+		udpClient, err := net.DialUDP("udp", nil, udpServer.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer udpClient.Close()
+		if _, err := Send(udpClient, 1, OpData, ProtoUDP, large, 0); err != nil {
+			t.Fatal(err)
+		}
+		_ = udpServer.SetReadDeadline(time.Now().Add(2 * time.Second))
+		hdr, _, fragment, _, err := UDPRecvRaw(udpServer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Flags&FlagFragment == 0 {
+			t.Fatal("UDP message was not fragmented")
+		}
+		return append(packets, fragment...)
+	}
+
+	first, second := capture(42), capture(42)
+	if !bytes.Equal(first, second) {
+		t.Fatal("packets with the same seed differ")
+	}
+	if bytes.Equal(first, capture(43)) {
+		t.Fatal("packets with different seeds are equal")
+	}
+}
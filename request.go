@@ -0,0 +1,197 @@
+package overproto
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+	"github.com/nickolajgrishuk/overproto-go/transport"
+)
+
+// ErrRequestTimeout - ответ на запрос не пришёл за отведённое время
+var ErrRequestTimeout = errors.New("request timed out")
+
+// requestResult - ответ на запрос или ошибка его приёма
+type requestResult struct {
+	payload []byte
+	err     error
+}
+
+// requestDemux - таблица ожидающих ответа запросов одного соединения
+// Горутина приёма направляет ответы ожидающим по StreamID
+type requestDemux struct {
+	conn    *TCPConnection
+	mu      sync.Mutex
+	pending map[uint32]chan requestResult
+	nextID  uint32
+	err     error // Ошибка приёма, завершившая демультиплексор
+}
+
+var (
+	// demuxes - демультиплексоры соединений, на которых вызывался Request
+	demuxes = make(map[*TCPConnection]*requestDemux)
+	// demuxesMu - мьютекс для demuxes
+	demuxesMu sync.Mutex
+)
+
+// Request отправляет пакет с уникальным идентификатором запроса в StreamID
+// и ждёт ответ с тем же StreamID не дольше timeout
+// Первый вызов для соединения запускает горутину приёма, которая читает
+// соединение до его закрытия: вызывать TCPRecv на нём после этого нельзя.
+// Пакеты, не относящиеся к ожидающим запросам (например, ответ после
+// таймаута), и отдельные повреждённые пакеты (ErrCRCMismatch,
+// ErrProtoMismatch) отбрасываются; дедлайн чтения соединения снимается,
+// время ожидания задаёт timeout. Запросы завершаются ошибкой приёма только
+// при закрытии соединения, ошибке сокета или ErrAuthFailed
+// Параллельные запросы на одном соединении поддерживаются
+func Request(conn *TCPConnection, opcode uint8, data []byte, timeout time.Duration) ([]byte, error) {
+	d := demuxFor(conn)
+	id, ch, err := d.register()
+	if err != nil {
+		// Приём уже завершён: запрос не отправляется
+		return nil, err
+	}
+	defer d.unregister(id)
+
+	if _, err := Send(conn, id, opcode, core.ProtoTCP, data, 0); err != nil {
+		return nil, err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.payload, res.err
+	case <-timer.C:
+		return nil, ErrRequestTimeout
+	}
+}
+
+// Respond отправляет ответ на запрос req: пакет OpData с тем же StreamID
+func Respond(conn interface{}, req *PacketHeader, data []byte, flags uint8) (int, error) {
+	return Send(conn, req.StreamID, core.OpData, core.ProtoTCP, data, flags)
+}
+
+// demuxFor возвращает демультиплексор соединения, запуская его при первом вызове
+func demuxFor(conn *TCPConnection) *requestDemux {
+	demuxesMu.Lock()
+	defer demuxesMu.Unlock()
+
+	d, ok := demuxes[conn]
+	if !ok {
+		d = &requestDemux{
+			conn:    conn,
+			pending: make(map[uint32]chan requestResult),
+		}
+		demuxes[conn] = d
+		go d.loop()
+	}
+	return d
+}
+
+// register выделяет идентификатор запроса (0 не используется) и канал ответа
+// Если приём уже завершён, возвращает его ошибку
+func (d *requestDemux) register() (uint32, chan requestResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.err != nil {
+		return 0, nil, d.err
+	}
+	for {
+		d.nextID++
+		if _, busy := d.pending[d.nextID]; d.nextID != 0 && !busy {
+			break
+		}
+	}
+	// Буфер на один ответ: горутина приёма никогда не блокируется
+	ch := make(chan requestResult, 1)
+	d.pending[d.nextID] = ch
+	return d.nextID, ch, nil
+}
+
+// unregister удаляет запрос из таблицы
+func (d *requestDemux) unregister(id uint32) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.pending, id)
+}
+
+// deliver передаёт результат ожидающему запросу id
+func (d *requestDemux) deliver(id uint32, res requestResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if ch, ok := d.pending[id]; ok {
+		delete(d.pending, id)
+		ch <- res
+	}
+}
+
+// loop принимает ответы до необратимой ошибки приёма, после чего
+// завершает все ожидающие запросы этой ошибкой
+func (d *requestDemux) loop() {
+	for {
+		hdr, payload, err := TCPRecv(d.conn)
+		if err != nil {
+			if err = d.recover(err); err != nil {
+				d.fail(err)
+				return
+			}
+			continue
+		}
+		payload, err = decodePayload(hdr, payload)
+		d.deliver(hdr.StreamID, requestResult{payload: payload, err: err})
+	}
+}
+
+// recover продолжает приём после ошибки, не относящейся к соединению в целом,
+// и возвращает nil; необратимую ошибку возвращает без изменений
+func (d *requestDemux) recover(err error) error {
+	if errors.Is(err, ErrRecvTimeout) {
+		// Частично принятый пакет сохранён; без снятия истёкшего дедлайна
+		// каждое следующее чтение сразу завершалось бы таймаутом
+		_ = d.conn.Conn().SetReadDeadline(time.Time{})
+		return nil
+	}
+	if requestRecvFatal(err) {
+		return err
+	}
+	// Пакет отброшен: Resync восстанавливает выравнивание потока
+	// и возвращает соединение в статистику
+	if _, err := d.conn.Resync(); err != nil && !errors.Is(err, ErrRecvTimeout) {
+		return err
+	}
+	return nil
+}
+
+// requestRecvFatal проверяет, завершает ли ошибка приёма (кроме ErrRecvTimeout)
+// демультиплексор: закрытие соединения, ошибка сокета или аутентификации
+// Остальные ошибки относятся к одному пакету
+func requestRecvFatal(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, io.ErrClosedPipe) || errors.Is(err, ErrAuthFailed) ||
+		errors.Is(err, transport.ErrKeepAliveFailed) || errors.As(err, &opErr)
+}
+
+// fail завершает ожидающие запросы ошибкой err и удаляет демультиплексор:
+// следующий Request запустит приём заново
+func (d *requestDemux) fail(err error) {
+	demuxesMu.Lock()
+	if demuxes[d.conn] == d {
+		delete(demuxes, d.conn)
+	}
+	demuxesMu.Unlock()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.err = err
+	for id, ch := range d.pending {
+		delete(d.pending, id)
+		ch <- requestResult{err: err}
+	}
+}
@@ -0,0 +1,177 @@
+package overproto
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+const (
+	// StreamChunkSize - максимальный объём данных в одном пакете потоковой передачи
+	StreamChunkSize = 32 * 1024
+	// StreamAbortCode - код END при ошибке чтения источника на стороне отправителя
+	StreamAbortCode uint16 = 1
+)
+
+var (
+	// ErrStreamUnexpected - в соединении пришёл пакет, не относящийся к передаче
+	ErrStreamUnexpected = errors.New("unexpected packet in stream transfer")
+	// ErrStreamAborted - отправитель прервал передачу
+	ErrStreamAborted = errors.New("stream transfer aborted by sender")
+	// ErrStreamLength - размер из END не совпал с количеством принятых байт
+	ErrStreamLength = errors.New("stream transfer length mismatch")
+)
+
+// SendStream передаёт данные из r неизвестного заранее размера по TCP:
+// пакет ControlStreamBegin, пакеты OpData по StreamChunkSize байт и
+// ControlStreamEnd с общим размером. Все пакеты передачи имеют StreamID
+// transferID; flags применяются к каждому пакету как в Send
+// При ошибке чтения r получателю отправляется END с StreamAbortCode
+// Возвращает количество переданных байт из r
+func SendStream(conn interface{}, transferID uint32, r io.Reader, flags uint8) (int64, error) {
+	if _, err := SendControl(conn, transferID, core.ProtoTCP, core.NewStreamBegin(), flags); err != nil {
+		return 0, err
+	}
+
+	buf := make([]byte, StreamChunkSize)
+	var total int64
+	for {
+		n, readErr := io.ReadFull(r, buf)
+		if n > 0 {
+			if _, err := Send(conn, transferID, core.OpData, core.ProtoTCP, buf[:n], flags); err != nil {
+				return total, err
+			}
+			total += int64(n)
+		}
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			abort := core.NewStreamAbort(uint64(total), StreamAbortCode, readErr.Error())
+			_, _ = SendControl(conn, transferID, core.ProtoTCP, abort, flags)
+			return total, readErr
+		}
+	}
+
+	if _, err := SendControl(conn, transferID, core.ProtoTCP, core.NewStreamEnd(uint64(total)), flags); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// StreamReader - приёмная сторона потоковой передачи
+// Читает пакеты передачи из соединения по мере вызовов Read и декодирует
+// их как DecodePayload, поэтому объём передачи не ограничен памятью получателя
+// Пока передача не завершена, соединение не должно читаться иначе
+type StreamReader struct {
+	conn       *TCPConnection
+	transferID uint32
+	buf        []byte // Непрочитанный остаток данных последнего пакета
+	received   uint64 // Принято байт данных
+	err        error  // io.EOF после END либо ошибка передачи
+}
+
+// RecvStream принимает пакет ControlStreamBegin и возвращает StreamReader
+// для данных этой передачи; другой первый пакет - ErrStreamUnexpected
+func RecvStream(conn *TCPConnection) (*StreamReader, error) {
+	hdr, payload, err := TCPRecv(conn)
+	if err != nil {
+		return nil, err
+	}
+	if hdr.Opcode != core.OpControl {
+		return nil, ErrStreamUnexpected
+	}
+	data, err := decodePayload(hdr, payload)
+	if err != nil {
+		return nil, err
+	}
+	msg, err := core.DecodeControl(data)
+	if err != nil {
+		return nil, err
+	}
+	if msg.Type != core.ControlStreamBegin {
+		return nil, ErrStreamUnexpected
+	}
+	return NewStreamReader(conn, hdr.StreamID), nil
+}
+
+// NewStreamReader создаёт StreamReader для передачи transferID,
+// пакет BEGIN которой уже принят вызывающим
+func NewStreamReader(conn *TCPConnection, transferID uint32) *StreamReader {
+	return &StreamReader{
+		conn:       conn,
+		transferID: transferID,
+	}
+}
+
+// TransferID возвращает идентификатор передачи (StreamID её пакетов)
+func (s *StreamReader) TransferID() uint32 {
+	return s.transferID
+}
+
+// Read реализует io.Reader: возвращает io.EOF после END с совпавшим размером
+// Прерывание отправителем - ErrStreamAborted, обрыв соединения - io.ErrUnexpectedEOF
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		s.err = s.next()
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// next принимает следующий пакет передачи
+func (s *StreamReader) next() error {
+	hdr, payload, err := TCPRecv(s.conn)
+	if err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	if hdr.StreamID != s.transferID {
+		return ErrStreamUnexpected
+	}
+	data, err := decodePayload(hdr, payload)
+	if err != nil {
+		return err
+	}
+
+	switch hdr.Opcode {
+	case core.OpData:
+		s.buf = data
+		s.received += uint64(len(data))
+		return nil
+	case core.OpControl:
+		msg, err := core.DecodeControl(data)
+		if err != nil {
+			return err
+		}
+		if msg.Type != core.ControlStreamEnd {
+			return ErrStreamUnexpected
+		}
+		return s.finish(msg)
+	default:
+		return ErrStreamUnexpected
+	}
+}
+
+// finish обрабатывает END: прерывание отправителем или проверка размера
+func (s *StreamReader) finish(msg *core.ControlMessage) error {
+	if code, err := msg.Uint16(core.TagCode); err == nil {
+		return fmt.Errorf("%w: code %d: %s", ErrStreamAborted, code, msg.String(core.TagReason))
+	}
+	length, err := msg.Uint64(core.TagLength)
+	if err != nil {
+		return err
+	}
+	if length != s.received {
+		return ErrStreamLength
+	}
+	return io.EOF
+}
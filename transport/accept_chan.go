@@ -0,0 +1,62 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// acceptMaxBackoff - максимальная пауза между повторами Accept при нехватке дескрипторов
+const acceptMaxBackoff = time.Second
+
+// AcceptChan запускает цикл приёма соединений (TCPAccept) и передаёт
+// принятые соединения в канал
+// При закрытии listener оба канала закрываются без ошибки. При другой
+// ошибке Accept она передаётся в канал ошибок, после чего оба канала закрываются
+// При нехватке файловых дескрипторов (EMFILE, ENFILE) Accept повторяется
+// с нарастающей паузой
+// Канал соединений не буферизован: читать его нужно до закрытия,
+// иначе горутина приёма не завершится
+func AcceptChan(listener net.Listener) (<-chan net.Conn, <-chan error) {
+	connCh := make(chan net.Conn)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(connCh)
+		defer close(errCh)
+
+		var backoff time.Duration
+		for {
+			conn, err := TCPAccept(listener)
+			if err != nil {
+				if errors.Is(err, net.ErrClosed) {
+					return
+				}
+				if errors.Is(err, syscall.EMFILE) || errors.Is(err, syscall.ENFILE) {
+					backoff = nextAcceptBackoff(backoff)
+					time.Sleep(backoff)
+					continue
+				}
+				errCh <- err
+				return
+			}
+			backoff = 0
+			connCh <- conn
+		}
+	}()
+
+	return connCh, errCh
+}
+
+// nextAcceptBackoff удваивает паузу перед повтором Accept (от 5 мс до acceptMaxBackoff)
+func nextAcceptBackoff(backoff time.Duration) time.Duration {
+	if backoff == 0 {
+		return 5 * time.Millisecond
+	}
+	backoff *= 2
+	if backoff > acceptMaxBackoff {
+		backoff = acceptMaxBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,71 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrAuthFailed - первый пакет соединения или сессии не прошёл аутентификацию
+var ErrAuthFailed = errors.New("authentication failed")
+
+// AuthFunc проверяет первый пакет соединения или сессии (например, OpControl с токеном)
+// Ненулевая ошибка отклоняет клиента: соединение закрывается
+type AuthFunc func(streamID uint32, payload []byte) error
+
+// authGate - состояние аутентификации соединения или сессии
+type authGate struct {
+	fn     atomic.Pointer[AuthFunc]
+	passed atomic.Bool
+}
+
+// set устанавливает функцию аутентификации; nil отключает проверку
+func (g *authGate) set(fn AuthFunc) {
+	if fn == nil {
+		g.fn.Store(nil)
+		return
+	}
+	g.fn.Store(&fn)
+}
+
+// check вызывает AuthFunc для первого пакета
+// Возвращает ошибку, обёрнутую в ErrAuthFailed, если пакет отклонён
+func (g *authGate) check(streamID uint32, payload []byte) error {
+	if g.passed.Load() {
+		return nil
+	}
+	fn := g.fn.Load()
+	if fn == nil {
+		return nil
+	}
+	if err := (*fn)(streamID, payload); err != nil {
+		return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	}
+	g.passed.Store(true)
+	return nil
+}
+
+// SetAuthFunc задаёт проверку первого принятого пакета соединения
+// Пока пакет не принят, соединение не считается аутентифицированным;
+// при ошибке fn TCPRecv закрывает соединение и возвращает ErrAuthFailed
+// Вызывается до первого TCPRecv. Thread-safe
+func (conn *TCPConnection) SetAuthFunc(fn AuthFunc) {
+	conn.auth.set(fn)
+}
+
+// Authenticated сообщает, прошёл ли первый пакет проверку SetAuthFunc
+func (conn *TCPConnection) Authenticated() bool {
+	return conn.auth.passed.Load()
+}
+
+// SetAuthFunc задаёт проверку первого принятого пакета сессии
+// При ошибке fn Recv закрывает сессию и возвращает ErrAuthFailed
+// Вызывается до первого Recv. Thread-safe
+func (ctx *ReliableContext) SetAuthFunc(fn AuthFunc) {
+	ctx.auth.set(fn)
+}
+
+// Authenticated сообщает, прошёл ли первый пакет проверку SetAuthFunc
+func (ctx *ReliableContext) Authenticated() bool {
+	return ctx.auth.passed.Load()
+}
@@ -0,0 +1,11 @@
+//go:build linux
+
+package transport
+
+import "syscall"
+
+// bindToDevice привязывает сокет к сетевому интерфейсу через SO_BINDTODEVICE
+// Требует CAP_NET_RAW на ядрах до 5.7
+func bindToDevice(fd uintptr, name string) error {
+	return syscall.BindToDevice(int(fd), name)
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package transport
+
+// bindToDevice не поддерживается: SO_BINDTODEVICE есть только в Linux
+func bindToDevice(fd uintptr, name string) error {
+	return ErrBindInterfaceUnsupported
+}
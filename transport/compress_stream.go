@@ -0,0 +1,151 @@
+package transport
+
+import (
+	"errors"
+	"net"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+	"github.com/nickolajgrishuk/overproto-go/optimize"
+)
+
+// EnableStreamCompression включает потоковую компрессию на соединении
+// Режим должен быть включён на обеих сторонах (договорённость вне протокола)
+//
+// В потоковом режиме пакеты без FlagEncrypted, отправленные через TCPSendStream,
+// сжимаются одним deflate потоком на всё соединение: payload каждого пакета -
+// это самостоятельный сегмент, завершённый Z_SYNC_FLUSH, а флаг FlagCompressed
+// означает сегмент потока. TCPRecv распаковывает такие пакеты автоматически,
+// строго в порядке прихода. Зашифрованные пакеты в общий словарь не попадают
+// и, как и раньше, сжимаются поштучно через zlib
+func (conn *TCPConnection) EnableStreamCompression() error {
+	compressor, err := optimize.NewStreamCompressor()
+	if err != nil {
+		return err
+	}
+
+	conn.sendMu.Lock()
+	conn.compressor = compressor
+	conn.sendMu.Unlock()
+
+	conn.mu.Lock()
+	conn.decompressor = optimize.NewStreamDecompressor()
+	conn.mu.Unlock()
+
+	return nil
+}
+
+// ResetCompression сбрасывает словарь потоковой компрессии соединения
+// Удалённой стороне отправляется ControlCompressReset, после которого
+// обе стороны начинают новый deflate поток: данные, отправленные до сброса,
+// больше не влияют на сжатие. Освобождает память истории и ограничивает
+// утечку содержимого через степень сжатия (атаки типа CRIME), например
+// при смене контекста или перед данными из другого источника
+// Приняв ControlCompressReset, TCPRecv сбрасывает распаковщик и не
+// возвращает этот пакет
+func (conn *TCPConnection) ResetCompression() error {
+	payload, err := core.EncodeControl(core.NewCompressReset())
+	if err != nil {
+		return err
+	}
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpControl
+	hdr.Proto = core.ProtoTCP
+	hdr.PayloadLen = uint16(len(payload))
+
+	conn.sendMu.Lock()
+	defer conn.sendMu.Unlock()
+
+	if conn.compressor == nil {
+		return errors.New("stream compression not enabled")
+	}
+	// Сброс и отправка под одной блокировкой: сегменты нового потока
+	// не могут опередить сообщение о сбросе
+	conn.compressor.Reset()
+	_, err = TCPSend(conn.activity, hdr, payload)
+	return wrapConnError(conn.id, err)
+}
+
+// StreamCompressionEnabled проверяет, включена ли потоковая компрессия
+func (conn *TCPConnection) StreamCompressionEnabled() bool {
+	conn.sendMu.Lock()
+	defer conn.sendMu.Unlock()
+	return conn.compressor != nil
+}
+
+// Conn возвращает исходное сетевое соединение
+// Запись напрямую в него не учитывается в LastActivity
+func (conn *TCPConnection) Conn() net.Conn {
+	return conn.fd
+}
+
+// TCPSendStream отправляет пакет через соединение с потоковой компрессией
+// Payload сжимается общим компрессором соединения; сжатие и запись выполняются
+// под одной блокировкой, чтобы порядок сегментов на проводе совпадал с порядком сжатия
+// Пустой payload и пакеты с FlagEncrypted или FlagCompressed отправляются как есть
+func TCPSendStream(conn *TCPConnection, hdr *core.PacketHeader, payload []byte) (int, error) {
+	conn.sendMu.Lock()
+	defer conn.sendMu.Unlock()
+
+	if conn.compressor == nil {
+		return 0, errors.New("stream compression not enabled")
+	}
+
+	pktHdr := *hdr
+	if len(payload) > 0 && pktHdr.Flags&(core.FlagEncrypted|core.FlagCompressed|core.FlagAuthenticated) == 0 {
+		segment, err := conn.compressor.Compress(payload)
+		if err != nil {
+			return 0, err
+		}
+		payloadLen, err := core.SafeIntToUint16(len(segment))
+		if err != nil {
+			return 0, errors.New("payload too large")
+		}
+		payload = segment
+		pktHdr.Flags |= core.FlagCompressed
+		pktHdr.PayloadLen = payloadLen
+	}
+
+	n, err := TCPSend(conn.activity, &pktHdr, payload)
+	return n, wrapConnError(conn.id, err)
+}
+
+// errCompressReset - принятый пакет был ControlCompressReset и обработан
+// внутри; вызывающему его не возвращают (см. recvPacketLocked)
+var errCompressReset = errors.New("compression reset consumed")
+
+// compressResetLocked сбрасывает распаковщик, если пакет - ControlCompressReset
+// потоковой компрессии; true - пакет обработан и не выдаётся приложению
+// Вызывается с захваченным conn.mu
+func (conn *TCPConnection) compressResetLocked(hdr *core.PacketHeader, payload []byte) bool {
+	if conn.decompressor == nil || hdr.Opcode != core.OpControl || hdr.Flags != 0 {
+		return false
+	}
+	msg, err := core.DecodeControl(payload)
+	if err != nil || msg.Type != core.ControlCompressReset {
+		return false
+	}
+	conn.decompressor.Reset()
+	return true
+}
+
+// inflateStream распаковывает сегмент потока для принятого пакета
+// Вызывается с захваченным conn.mu
+func (conn *TCPConnection) inflateStream(hdr *core.PacketHeader, payload []byte) ([]byte, error) {
+	if conn.decompressor == nil || len(payload) == 0 {
+		return payload, nil
+	}
+	if hdr.Flags&core.FlagCompressed == 0 || hdr.Flags&core.FlagEncrypted != 0 {
+		return payload, nil
+	}
+
+	data, err := conn.decompressor.Decompress(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	hdr.Flags &^= core.FlagCompressed
+	if payloadLen, err := core.SafeIntToUint16(len(data)); err == nil {
+		hdr.PayloadLen = payloadLen
+	}
+	return data, nil
+}
@@ -0,0 +1,83 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+var (
+	// transportConfig - конфигурация транспортного уровня
+	transportConfig = core.NewConfig()
+	// configMu - мьютекс для transportConfig
+	configMu sync.RWMutex
+)
+
+// SetConfig устанавливает конфигурацию транспортного уровня
+// Конфигурация копируется; если cfg == nil, используются значения по умолчанию
+// Thread-safe
+func SetConfig(cfg *core.Config) {
+	c := core.NewConfig()
+	if cfg != nil {
+		*c = *cfg
+		// Ключ маски копируется вместе с конфигурацией
+		if cfg.ObfuscationKey != nil {
+			c.ObfuscationKey = append([]byte(nil), cfg.ObfuscationKey...)
+		}
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	transportConfig = c
+}
+
+// currentConfig возвращает текущую конфигурацию транспортного уровня
+func currentConfig() *core.Config {
+	configMu.RLock()
+	defer configMu.RUnlock()
+	return transportConfig
+}
+
+// ErrBindInterfaceUnsupported - привязка к интерфейсу (Config.BindInterface)
+// не поддерживается на этой платформе
+var ErrBindInterfaceUnsupported = errors.New("binding to an interface is not supported on this platform (Linux only)")
+
+// listenControl настраивает слушающий сокет перед bind согласно конфигурации
+// Используется как net.ListenConfig.Control в TCPListen и UDPBind
+func listenControl(network, address string, c syscall.RawConn) error {
+	cfg := currentConfig()
+	if cfg.DisableReuseAddr && cfg.BindInterface == "" && cfg.DSCP == 0 {
+		return nil
+	}
+
+	// Несуществующий интерфейс даёт понятную ошибку вместо ENODEV
+	if cfg.BindInterface != "" {
+		if _, err := net.InterfaceByName(cfg.BindInterface); err != nil {
+			return fmt.Errorf("bind interface %q: %w", cfg.BindInterface, err)
+		}
+	}
+
+	var err error
+	ctrlErr := c.Control(func(fd uintptr) {
+		// Устанавливаем SO_REUSEADDR
+		if !cfg.DisableReuseAddr {
+			err = setSockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+		}
+		// Привязываем к интерфейсу
+		if err == nil && cfg.BindInterface != "" {
+			err = bindToDevice(fd, cfg.BindInterface)
+		}
+		// Маркируем исходящие пакеты (принятые TCP соединения наследуют значение)
+		if err == nil && cfg.DSCP != 0 {
+			err = setDSCP(fd, network, cfg.DSCP)
+		}
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
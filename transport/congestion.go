@@ -0,0 +1,160 @@
+package transport
+
+import (
+	"errors"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// AckEvent - данные о подтверждённом пакете для congestion control
+type AckEvent struct {
+	Now          time.Time // Момент обработки ACK
+	AckedBytes   int       // Размер подтверждённого пакета (заголовок, payload, CRC32)
+	RTT          uint32    // Измеренный RTT в миллисекундах (если RTTSampled)
+	RTTSampled   bool      // false для ретранслированных пакетов (алгоритм Karn)
+	DeliveryRate uint64    // Образец скорости доставки (байт/с), 0 если нет образца
+	InFlight     uint32    // Пакеты в полёте после подтверждения
+}
+
+// CongestionState - текущее состояние congestion control
+type CongestionState struct {
+	Cwnd        uint32 // Congestion window (пакеты)
+	Ssthresh    uint32 // Порог slow start (пакеты), 0 если алгоритм его не использует
+	InSlowStart bool   // Фаза экспоненциального роста (slow start, startup в BBR)
+	PacingRate  uint64 // Рекомендуемая скорость отправки (байт/с), 0 - без ограничения
+}
+
+// CongestionController - алгоритм управления окном надёжной сессии
+// Методы вызываются с захваченной блокировкой сессии и не должны блокироваться
+type CongestionController interface {
+	// OnACK вызывается для каждого нового (не дублирующего) ACK
+	OnACK(ack AckEvent)
+	// OnRetransmitTimeout вызывается при ретрансмиссии по таймауту
+	OnRetransmitTimeout()
+	// State возвращает текущее состояние; Cwnd ограничивает количество пакетов в полёте
+	State() CongestionState
+}
+
+// NewCongestionController создаёт контроллер для указанного алгоритма
+// Неизвестный алгоритм заменяется Reno
+func NewCongestionController(algo core.CongestionAlgorithm) CongestionController {
+	switch algo {
+	case core.CongestionBBR:
+		return newBBRController()
+	default:
+		return newRenoController()
+	}
+}
+
+// SetCongestionController заменяет алгоритм congestion control сессии
+// Позволяет подключить собственную реализацию CongestionController
+func (ctx *ReliableContext) SetCongestionController(cc CongestionController) {
+	if cc == nil {
+		cc = newRenoController()
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.cc = cc
+	ctx.notifySpaceLocked()
+}
+
+// ErrInitialWindowUnsupported - контроллер сессии, заданный через
+// SetCongestionController, не поддерживает настройку начального окна
+var ErrInitialWindowUnsupported = errors.New("congestion controller does not support initial window")
+
+// initialWindowSetter - контроллер с настраиваемым начальным окном (Reno, BBR)
+type initialWindowSetter interface {
+	setInitialWindow(cwnd, ssthresh uint32)
+}
+
+// SetInitialWindow устанавливает начальный congestion window (пакеты) и порог
+// slow start; ssthresh == 0 - MaxCwnd. Окно после таймаута ретрансмиссии
+// также сбрасывается к cwnd. Вызывается до начала передачи
+// cwnd и ssthresh должны быть от 1 до размера окна отправки
+// BBR порог slow start не использует
+func (ctx *ReliableContext) SetInitialWindow(cwnd, ssthresh uint32) error {
+	if ssthresh == 0 {
+		ssthresh = MaxCwnd
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if cwnd < 1 || cwnd > ctx.windowSize || ssthresh > ctx.windowSize {
+		return errors.New("invalid initial window (must be between 1 and the window size)")
+	}
+	cc, ok := ctx.cc.(initialWindowSetter)
+	if !ok {
+		return ErrInitialWindowUnsupported
+	}
+	cc.setInitialWindow(cwnd, ssthresh)
+	ctx.notifySpaceLocked()
+	return nil
+}
+
+// renoController - Reno-подобный алгоритм: slow start, AIMD, сброс окна при таймауте
+type renoController struct {
+	cwnd        uint32
+	ssthresh    uint32
+	inSlowStart bool
+	initCwnd    uint32 // Начальное окно и окно после таймаута
+}
+
+// newRenoController создаёт контроллер Reno с начальным окном InitialCwnd
+func newRenoController() *renoController {
+	return &renoController{
+		cwnd:        InitialCwnd,
+		ssthresh:    MaxCwnd,
+		inSlowStart: true,
+		initCwnd:    InitialCwnd,
+	}
+}
+
+// setInitialWindow задаёт начальное окно и порог slow start
+func (r *renoController) setInitialWindow(cwnd, ssthresh uint32) {
+	r.initCwnd = cwnd
+	r.cwnd = cwnd
+	r.ssthresh = ssthresh
+	r.inSlowStart = cwnd < ssthresh
+}
+
+// OnACK обновляет congestion window
+func (r *renoController) OnACK(ack AckEvent) {
+	if r.inSlowStart {
+		// Slow Start: экспоненциальный рост
+		r.cwnd++
+		if r.cwnd >= r.ssthresh {
+			r.inSlowStart = false
+		}
+		if r.cwnd > MaxCwnd {
+			r.cwnd = MaxCwnd
+		}
+	} else {
+		// Congestion Avoidance: линейный рост
+		r.cwnd += 1 / r.cwnd // Упрощённая версия
+		if r.cwnd > MaxCwnd {
+			r.cwnd = MaxCwnd
+		}
+	}
+}
+
+// OnRetransmitTimeout уменьшает congestion window
+func (r *renoController) OnRetransmitTimeout() {
+	r.ssthresh = r.cwnd / 2
+	if r.ssthresh < 2 {
+		r.ssthresh = 2
+	}
+	r.cwnd = r.initCwnd
+	r.inSlowStart = true
+}
+
+// State возвращает состояние Reno
+func (r *renoController) State() CongestionState {
+	return CongestionState{
+		Cwnd:        r.cwnd,
+		Ssthresh:    r.ssthresh,
+		InSlowStart: r.inSlowStart,
+	}
+}
@@ -0,0 +1,240 @@
+package transport
+
+import "time"
+
+const (
+	// bbrHighGain - усиление в фазе startup (2/ln2), удваивает скорость каждый RTT
+	bbrHighGain = 2.885
+	// bbrCwndGain - усиление окна в фазе probe bandwidth
+	bbrCwndGain = 2.0
+	// bbrBwWindowRounds - количество раундов, по которым берётся максимум скорости
+	bbrBwWindowRounds = 10
+	// bbrMinRTTWindow - время жизни оценки минимального RTT
+	bbrMinRTTWindow = 10 * time.Second
+	// bbrFullBwGrowth - рост скорости, при котором канал ещё не считается заполненным (25%)
+	bbrFullBwGrowth = 1.25
+	// bbrFullBwRounds - раунды без роста скорости до выхода из startup
+	bbrFullBwRounds = 3
+)
+
+// bbrPacingGainCycle - циклические усиления фазы probe bandwidth:
+// проба (1.25), сброс очереди (0.75) и шесть раундов на оценённой скорости
+var bbrPacingGainCycle = [8]float64{1.25, 0.75, 1, 1, 1, 1, 1, 1}
+
+// bbrPhase - фаза алгоритма BBR
+type bbrPhase uint8
+
+const (
+	bbrStartup bbrPhase = iota // Экспоненциальный поиск пропускной способности
+	bbrDrain                   // Сброс очереди, накопленной в startup
+	bbrProbeBW                 // Работа на оценённой скорости с периодическими пробами
+)
+
+// bbrController - упрощённая модель BBR
+// Окно и скорость отправки определяются оценкой пропускной способности узкого места
+// (максимум образцов скорости доставки за bbrBwWindowRounds раундов) и минимальным RTT
+// Раундом считается интервал длиной в минимальный RTT
+// Потери по таймауту не уменьшают оценку модели, а только временно сбрасывают окно
+type bbrController struct {
+	phase    bbrPhase
+	cwnd     uint32
+	initCwnd uint32 // Начальное окно и окно после таймаута
+
+	// Максимум скорости доставки по раундам (байт/с)
+	bwRounds   [bbrBwWindowRounds]uint64
+	roundIdx   int
+	roundStart time.Time
+
+	// Минимальный RTT (мс) и момент его измерения
+	minRTT      uint32
+	minRTTStamp time.Time
+
+	// avgPacket - сглаженный размер пакета (байт) для перевода BDP в пакеты
+	avgPacket uint64
+
+	// Определение заполнения канала в startup
+	fullBw      uint64
+	fullBwCount int
+
+	pacingGain float64
+	cwndGain   float64
+	cycleIdx   int
+	cycleStart time.Time
+}
+
+// newBBRController создаёт контроллер BBR в фазе startup
+func newBBRController() *bbrController {
+	return &bbrController{
+		phase:      bbrStartup,
+		cwnd:       InitialCwnd,
+		initCwnd:   InitialCwnd,
+		pacingGain: bbrHighGain,
+		cwndGain:   bbrHighGain,
+	}
+}
+
+// OnACK обновляет модель и окно
+func (b *bbrController) OnACK(ack AckEvent) {
+	b.updateModel(ack)
+	roundEnded := b.updateRound(ack.Now)
+
+	switch b.phase {
+	case bbrStartup:
+		if roundEnded && b.checkFullPipe() {
+			// Очередь сбрасывается и пониженной скоростью, и окном в один BDP,
+			// чтобы drain завершался и без pacing
+			b.phase = bbrDrain
+			b.pacingGain = 1 / bbrHighGain
+			b.cwndGain = 1
+		}
+	case bbrDrain:
+		if ack.InFlight <= b.bdpPackets() {
+			b.enterProbeBW(ack.Now)
+		}
+	case bbrProbeBW:
+		if ack.Now.Sub(b.cycleStart) >= b.roundLength() {
+			b.cycleIdx = (b.cycleIdx + 1) % len(bbrPacingGainCycle)
+			b.cycleStart = ack.Now
+			b.pacingGain = bbrPacingGainCycle[b.cycleIdx]
+		}
+	}
+
+	b.updateCwnd()
+}
+
+// OnRetransmitTimeout сбрасывает окно; модель сохраняется, и окно
+// быстро возвращается к целевому значению
+func (b *bbrController) OnRetransmitTimeout() {
+	b.cwnd = b.initCwnd
+}
+
+// setInitialWindow задаёт начальное окно; порог slow start BBR не использует
+func (b *bbrController) setInitialWindow(cwnd, _ uint32) {
+	b.initCwnd = cwnd
+	b.cwnd = cwnd
+}
+
+// State возвращает состояние BBR
+func (b *bbrController) State() CongestionState {
+	return CongestionState{
+		Cwnd:        b.cwnd,
+		InSlowStart: b.phase == bbrStartup,
+		PacingRate:  uint64(b.pacingGain * float64(b.maxBw())),
+	}
+}
+
+// updateModel учитывает образцы RTT, скорости доставки и размер пакета
+func (b *bbrController) updateModel(ack AckEvent) {
+	if ack.RTTSampled {
+		// RTT измеряется в миллисекундах; 0 означает "нет оценки", поэтому минимум 1 мс
+		rtt := ack.RTT
+		if rtt == 0 {
+			rtt = 1
+		}
+		if b.minRTT == 0 || rtt <= b.minRTT || ack.Now.Sub(b.minRTTStamp) > bbrMinRTTWindow {
+			b.minRTT = rtt
+			b.minRTTStamp = ack.Now
+		}
+	}
+
+	if ack.DeliveryRate > b.bwRounds[b.roundIdx] {
+		b.bwRounds[b.roundIdx] = ack.DeliveryRate
+	}
+
+	if ack.AckedBytes > 0 {
+		if b.avgPacket == 0 {
+			b.avgPacket = uint64(ack.AckedBytes)
+		} else {
+			b.avgPacket = (7*b.avgPacket + uint64(ack.AckedBytes)) / 8
+		}
+	}
+}
+
+// updateRound начинает новый раунд, если прошёл минимальный RTT
+// Возвращает true, если раунд завершён
+func (b *bbrController) updateRound(now time.Time) bool {
+	if b.roundStart.IsZero() {
+		b.roundStart = now
+		return false
+	}
+	if now.Sub(b.roundStart) < b.roundLength() {
+		return false
+	}
+
+	b.roundStart = now
+	b.roundIdx = (b.roundIdx + 1) % bbrBwWindowRounds
+	b.bwRounds[b.roundIdx] = 0
+	return true
+}
+
+// checkFullPipe проверяет, перестала ли расти скорость доставки
+func (b *bbrController) checkFullPipe() bool {
+	bw := b.maxBw()
+	if float64(bw) >= float64(b.fullBw)*bbrFullBwGrowth {
+		b.fullBw = bw
+		b.fullBwCount = 0
+		return false
+	}
+	b.fullBwCount++
+	return b.fullBwCount >= bbrFullBwRounds
+}
+
+// enterProbeBW переходит в фазу probe bandwidth
+func (b *bbrController) enterProbeBW(now time.Time) {
+	b.phase = bbrProbeBW
+	b.cwndGain = bbrCwndGain
+	b.cycleIdx = 0
+	b.cycleStart = now
+	b.pacingGain = bbrPacingGainCycle[b.cycleIdx]
+}
+
+// updateCwnd приближает окно к cwndGain * BDP
+func (b *bbrController) updateCwnd() {
+	target := uint32(b.cwndGain * float64(b.bdpPackets()))
+
+	if b.phase == bbrStartup || b.cwnd < target {
+		// Рост на один пакет за ACK, как в slow start
+		b.cwnd++
+	} else if b.cwnd > target {
+		b.cwnd = target
+	}
+
+	// Нижняя граница - InitialCwnd или меньшее начальное окно
+	if floor := min(b.initCwnd, InitialCwnd); b.cwnd < floor {
+		b.cwnd = floor
+	}
+	if b.cwnd > MaxCwnd {
+		b.cwnd = MaxCwnd
+	}
+}
+
+// maxBw возвращает оценку пропускной способности узкого места (байт/с)
+func (b *bbrController) maxBw() uint64 {
+	var bw uint64
+	for _, sample := range b.bwRounds {
+		if sample > bw {
+			bw = sample
+		}
+	}
+	return bw
+}
+
+// bdpPackets возвращает произведение пропускной способности на минимальный RTT в пакетах
+func (b *bbrController) bdpPackets() uint32 {
+	if b.avgPacket == 0 || b.minRTT == 0 {
+		return 0
+	}
+	bdp := b.maxBw() * uint64(b.minRTT) / 1000 / b.avgPacket
+	if bdp > MaxCwnd {
+		return MaxCwnd
+	}
+	return uint32(bdp)
+}
+
+// roundLength возвращает длительность раунда (минимальный RTT)
+func (b *bbrController) roundLength() time.Duration {
+	if b.minRTT == 0 {
+		return InitialRTT * time.Millisecond
+	}
+	return time.Duration(b.minRTT) * time.Millisecond
+}
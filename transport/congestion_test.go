@@ -0,0 +1,75 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBBRConvergesToBDP(t *testing.T) {
+	b := newBBRController()
+
+	// Канал 100 KB/s, RTT 100 мс, пакеты по 1000 байт: BDP = 10 пакетов
+	now := time.Now()
+	for i := 0; i < 500; i++ {
+		now = now.Add(10 * time.Millisecond)
+		b.OnACK(AckEvent{
+			Now:          now,
+			AckedBytes:   1000,
+			RTT:          100,
+			RTTSampled:   true,
+			DeliveryRate: 100000,
+			InFlight:     b.State().Cwnd,
+		})
+	}
+
+	if b.phase != bbrProbeBW {
+		t.Fatalf("expected probe bandwidth phase, got %d", b.phase)
+	}
+	state := b.State()
+	if state.Cwnd != 20 {
+		t.Fatalf("expected cwnd = 2*BDP = 20, got %d", state.Cwnd)
+	}
+	if state.InSlowStart || state.PacingRate < 75000 || state.PacingRate > 125000 {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+}
+
+func TestSetInitialWindow(t *testing.T) {
+	ctx, err := NewReliableContext(nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ctx.Close()
+
+	for _, cwnd := range []uint32{0, WindowSize + 1} {
+		if err := ctx.SetInitialWindow(cwnd, 0); err == nil {
+			t.Fatalf("expected error for cwnd %d", cwnd)
+		}
+	}
+	if err := ctx.SetInitialWindow(10, 16); err != nil {
+		t.Fatal(err)
+	}
+	if state := ctx.cc.State(); state.Cwnd != 10 || state.Ssthresh != 16 || !state.InSlowStart {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+
+	// После таймаута окно возвращается к начальному
+	ctx.cc.OnACK(AckEvent{})
+	ctx.cc.OnRetransmitTimeout()
+	if cwnd := ctx.cc.State().Cwnd; cwnd != 10 {
+		t.Fatalf("cwnd after timeout = %d, want 10", cwnd)
+	}
+
+	ctx.SetCongestionController(customController{})
+	if err := ctx.SetInitialWindow(10, 0); !errors.Is(err, ErrInitialWindowUnsupported) {
+		t.Fatalf("expected ErrInitialWindowUnsupported, got %v", err)
+	}
+}
+
+// customController - контроллер пользователя без настройки начального окна
+type customController struct{}
+
+func (customController) OnACK(AckEvent)         {}
+func (customController) OnRetransmitTimeout()   {}
+func (customController) State() CongestionState { return CongestionState{Cwnd: 1} }
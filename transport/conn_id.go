@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"sync/atomic"
+)
+
+// connIDFallback - счётчик идентификаторов на случай отказа источника случайных байт
+var connIDFallback atomic.Uint32
+
+// ConnError - ошибка соединения или сессии с её идентификатором (см. ID)
+// Позволяет связать строки журнала одного соединения
+type ConnError struct {
+	ID  string
+	Err error
+}
+
+// Error реализует интерфейс error
+func (e *ConnError) Error() string {
+	return "conn " + e.ID + ": " + e.Err.Error()
+}
+
+// Unwrap возвращает исходную ошибку
+func (e *ConnError) Unwrap() error {
+	return e.Err
+}
+
+// newConnID генерирует короткий идентификатор соединения: 8 hex символов
+// Идентификатор служит только для журналов и не передаётся по сети
+func newConnID() string {
+	var id [4]byte
+	if err := readRandom(id[:]); err != nil {
+		binary.BigEndian.PutUint32(id[:], connIDFallback.Add(1))
+	}
+	return hex.EncodeToString(id[:])
+}
+
+// wrapConnError оборачивает err в ConnError с идентификатором id
+// io.EOF не оборачивается: это штатное закрытие соединения, которое
+// вызывающие сравнивают через ==
+func wrapConnError(id string, err error) error {
+	if err == nil || err == io.EOF {
+		return err
+	}
+	return &ConnError{ID: id, Err: err}
+}
@@ -0,0 +1,118 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// activityConn - сетевое соединение TCPConnection, запоминающее время
+// последнего успешного чтения или записи (см. CloseIdle)
+// Через него идёт только ввод-вывод библиотеки; Conn возвращает исходное соединение
+type activityConn struct {
+	net.Conn
+	last atomic.Int64 // UnixNano
+}
+
+// newActivityConn оборачивает conn; активность отсчитывается от создания
+func newActivityConn(conn net.Conn) *activityConn {
+	c := &activityConn{Conn: conn}
+	c.touch()
+	return c
+}
+
+// Read читает из соединения и отмечает активность, если данные получены
+func (c *activityConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+// Write пишет в соединение и отмечает активность, если данные отправлены
+func (c *activityConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.touch()
+	}
+	return n, err
+}
+
+// SyscallConn даёт доступ к дескриптору исходного соединения
+func (c *activityConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := c.Conn.(syscallConner)
+	if !ok {
+		return nil, errors.New("connection does not expose a file descriptor")
+	}
+	return sc.SyscallConn()
+}
+
+// touch запоминает текущее время как время последней активности
+func (c *activityConn) touch() {
+	c.last.Store(time.Now().UnixNano())
+}
+
+// lastActivity возвращает время последней активности
+func (c *activityConn) lastActivity() time.Time {
+	return time.Unix(0, c.last.Load())
+}
+
+// LastActivity возвращает время последнего приёма или отправки данных
+// через TCPConnection; до первого обмена - время создания TCPConnection
+// Запись напрямую в Conn не учитывается
+func (conn *TCPConnection) LastActivity() time.Time {
+	return conn.activity.lastActivity()
+}
+
+// TCPSendConn отправляет пакет через TCPConnection (как TCPSend) и отмечает
+// активность соединения; ошибки оборачиваются в ConnError
+func TCPSendConn(conn *TCPConnection, hdr *core.PacketHeader, payload []byte) (int, error) {
+	n, err := TCPSend(conn.activity, hdr, payload)
+	return n, wrapConnError(conn.id, err)
+}
+
+// TCPSendRawConn отправляет сериализованный пакет через TCPConnection
+// (как TCPSendRaw) и отмечает активность соединения
+func TCPSendRawConn(conn *TCPConnection, data []byte) (int, error) {
+	n, err := TCPSendRaw(conn.activity, data)
+	return n, wrapConnError(conn.id, err)
+}
+
+// CloseIdle закрывает TCP соединения, через которые ничего не принималось
+// и не отправлялось дольше threshold, и возвращает их количество
+// Активностью считается только обмен через TCPConnection (TCPRecv, Send
+// с *TCPConnection); сервер, который пишет в исходный net.Conn, выглядит
+// простаивающим
+// Учитываются только соединения NewTCPConnection, ещё не закрытые;
+// ожидающий TCPRecv закрытого соединения возвращает ошибку
+// Предназначена для периодического вызова сервером
+// Thread-safe
+func CloseIdle(threshold time.Duration) int {
+	registryMu.Lock()
+	conns := make([]*TCPConnection, 0, len(tcpConns))
+	for conn := range tcpConns {
+		conns = append(conns, conn)
+	}
+	registryMu.Unlock()
+
+	closed := 0
+	now := time.Now()
+	for _, conn := range conns {
+		if now.Sub(conn.LastActivity()) <= threshold {
+			continue
+		}
+		// Соединение могли закрыть параллельно: считаем только удалённые здесь
+		if !untrackTCPConnection(conn) {
+			continue
+		}
+		conn.closed.Store(true)
+		_ = conn.fd.Close()
+		closed++
+	}
+	return closed
+}
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+const (
+	// ConnLimitCloseCode - код ControlClose, с которым закрывается соединение
+	// сверх Config.MaxConnections (как 1013 "Try Again Later" в WebSocket)
+	ConnLimitCloseCode uint16 = 1013
+	// connRefuseTimeout - предельное время отправки отказа перед закрытием
+	connRefuseTimeout = 100 * time.Millisecond
+)
+
+var (
+	// acceptedConns - открытые соединения, принятые TCPAccept при Config.MaxConnections > 0
+	acceptedConns atomic.Int64
+	// refusedConns - соединения, закрытые TCPAccept из-за Config.MaxConnections
+	refusedConns atomic.Uint64
+)
+
+// limitedConn - принятое соединение, занимающее место в лимите
+// Config.MaxConnections до первого Close
+type limitedConn struct {
+	net.Conn
+	released atomic.Bool
+}
+
+// Close закрывает соединение и освобождает место в лимите
+func (c *limitedConn) Close() error {
+	if c.released.CompareAndSwap(false, true) {
+		acceptedConns.Add(-1)
+	}
+	return c.Conn.Close()
+}
+
+// SyscallConn даёт доступ к дескриптору исходного соединения
+func (c *limitedConn) SyscallConn() (syscall.RawConn, error) {
+	sc, ok := c.Conn.(syscallConner)
+	if !ok {
+		return nil, errors.New("connection does not expose a file descriptor")
+	}
+	return sc.SyscallConn()
+}
+
+// admitConn учитывает принятое соединение в лимите Config.MaxConnections
+// Возвращает обёртку, освобождающую место при Close, или nil, если лимит
+// исчерпан или идёт Drain - тогда соединение закрыто с ControlClose
+func admitConn(conn net.Conn) net.Conn {
+	if draining.Load() {
+		refusedConns.Add(1)
+		refuseConn(conn, GoingAwayCloseCode, drainReason())
+		return nil
+	}
+
+	limit := currentConfig().MaxConnections
+	if limit <= 0 {
+		return conn
+	}
+	if acceptedConns.Add(1) > int64(limit) {
+		acceptedConns.Add(-1)
+		refusedConns.Add(1)
+		refuseConn(conn, ConnLimitCloseCode, "connection limit reached")
+		return nil
+	}
+	return &limitedConn{Conn: conn}
+}
+
+// refuseConn отправляет ControlClose с кодом и причиной отказа и закрывает соединение
+func refuseConn(conn net.Conn, code uint16, reason string) {
+	defer conn.Close()
+	_ = sendCloseMessage(conn, code, reason)
+}
+
+// sendCloseMessage отправляет ControlClose, ожидая не дольше connRefuseTimeout:
+// медленный клиент не должен задерживать приём и других клиентов
+func sendCloseMessage(conn net.Conn, code uint16, reason string) error {
+	payload, err := core.EncodeControl(core.NewCloseMessage(code, reason))
+	if err != nil {
+		return err
+	}
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpControl
+	hdr.Proto = core.ProtoTCP
+	hdr.PayloadLen = uint16(len(payload))
+	data, err := core.Serialize(hdr, payload)
+	if err != nil {
+		return err
+	}
+	maskHeader(data, currentConfig().ObfuscationKey)
+
+	if err := conn.SetWriteDeadline(time.Now().Add(connRefuseTimeout)); err != nil {
+		return err
+	}
+	n, err := conn.Write(data)
+	addBytesOut(n)
+	_ = conn.SetWriteDeadline(time.Time{})
+	return err
+}
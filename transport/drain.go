@@ -0,0 +1,72 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// GoingAwayCloseCode - код ControlClose, которым Drain сообщает клиентам
+// о выводе сервера из работы (как 1001 "Going Away" в WebSocket)
+const GoingAwayCloseCode uint16 = 1001
+
+var (
+	// draining - включён режим Drain
+	draining atomic.Bool
+	// drainMsg - причина, передаваемая клиентам в ControlClose
+	drainMsg string
+	// drainMu - мьютекс для drainMsg
+	drainMu sync.Mutex
+)
+
+// Drain переводит процесс в режим вывода из работы перед остановкой:
+// TCPAccept закрывает новые соединения с ControlClose(GoingAwayCloseCode,
+// reason), а всем открытым TCPConnection (в том числе исходящим) отправляется
+// такое же сообщение, чтобы клиенты переподключились к другому серверу
+// Открытые соединения
+// и надёжные сессии продолжают работать до закрытия или Shutdown
+// Повторный вызов снова уведомляет открытые соединения
+// Возвращает объединённую ошибку отправки уведомлений
+// Thread-safe
+func Drain(reason string) error {
+	drainMu.Lock()
+	drainMsg = reason
+	drainMu.Unlock()
+	draining.Store(true)
+
+	registryMu.Lock()
+	conns := make([]*TCPConnection, 0, len(tcpConns))
+	for conn := range tcpConns {
+		conns = append(conns, conn)
+	}
+	registryMu.Unlock()
+
+	var errs []error
+	for _, conn := range conns {
+		conn.sendMu.Lock()
+		err := sendCloseMessage(conn.activity, GoingAwayCloseCode, reason)
+		conn.sendMu.Unlock()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, wrapConnError(conn.id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsDraining проверяет, включён ли режим Drain
+func IsDraining() bool {
+	return draining.Load()
+}
+
+// drainReason возвращает причину, переданную в Drain
+func drainReason() string {
+	drainMu.Lock()
+	defer drainMu.Unlock()
+	return drainMsg
+}
+
+// stopDrain выключает режим Drain (см. CloseAll)
+func stopDrain() {
+	draining.Store(false)
+}
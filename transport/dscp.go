@@ -0,0 +1,39 @@
+package transport
+
+import (
+	"strings"
+	"syscall"
+)
+
+// MaxDSCP - максимальное значение DSCP (6 бит)
+const MaxDSCP = 63
+
+// setDSCP устанавливает DSCP исходящих пакетов сокета (IP_TOS / IPV6_TCLASS)
+// DSCP занимает старшие 6 бит байта ToS/Traffic Class, младшие 2 бита (ECN) - нули
+func setDSCP(fd uintptr, network string, dscp uint8) error {
+	tos := int(dscp) << 2
+	if strings.HasSuffix(network, "6") {
+		// Сокет IPv6 может передавать и IPv4 (dual-stack) - IP_TOS ставим без проверки
+		_ = setSockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+		return setSockoptInt(fd, syscall.IPPROTO_IPV6, ipv6TClass, tos)
+	}
+	return setSockoptInt(fd, syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+}
+
+// dialControl настраивает исходящий сокет перед connect согласно конфигурации
+// Используется как net.Dialer.Control в TCPConnect и UDPConnect
+func dialControl(network, address string, c syscall.RawConn) error {
+	dscp := currentConfig().DSCP
+	if dscp == 0 {
+		return nil
+	}
+
+	var err error
+	ctrlErr := c.Control(func(fd uintptr) {
+		err = setDSCP(fd, network, dscp)
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return err
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package transport
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+func TestUDPConnectSetsDSCP(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.DSCP = 46 // EF
+	SetConfig(cfg)
+
+	conn, err := UDPConnect("127.0.0.1", 9)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tos int
+	var getErr error
+	if err := raw.Control(func(fd uintptr) {
+		tos, getErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if getErr != nil {
+		t.Fatal(getErr)
+	}
+	if tos != 46<<2 {
+		t.Fatalf("IP_TOS = %#x, want %#x", tos, 46<<2)
+	}
+}
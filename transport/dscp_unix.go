@@ -0,0 +1,8 @@
+//go:build !windows
+
+package transport
+
+import "syscall"
+
+// ipv6TClass - опция IPV6_TCLASS
+const ipv6TClass = syscall.IPV6_TCLASS
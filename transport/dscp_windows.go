@@ -0,0 +1,7 @@
+//go:build windows
+
+package transport
+
+// ipv6TClass - опция IPV6_TCLASS (в пакете syscall для Windows отсутствует)
+// Windows применяет ToS только при разрешающей QoS политике, иначе значение игнорируется
+const ipv6TClass = 39
@@ -0,0 +1,105 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"syscall"
+	"time"
+)
+
+// ErrKeepAliveFailed - удалённая сторона перестала отвечать на TCP keepalive
+// пробы или повторные передачи (сеть пропала без FIN/RST); соединение мёртвое
+var ErrKeepAliveFailed = errors.New("tcp keepalive failed: peer unreachable")
+
+// ErrKeepAliveUnsupported - Config.KeepAliveInterval и Config.KeepAliveCount
+// не поддерживаются на этой платформе (поддерживаются Linux, macOS и Windows)
+var ErrKeepAliveUnsupported = errors.New("keepalive probe interval and count are not supported on this platform")
+
+// KeepAliveFailFunc вызывается один раз, когда соединение признано мёртвым
+// err обёрнута в ErrKeepAliveFailed
+// Вызывается из TCPRecv до возврата ошибки, поэтому не должна вызывать
+// TCPRecv для этого же соединения; Close вызывать можно
+type KeepAliveFailFunc func(conn *TCPConnection, err error)
+
+// SetKeepAliveFailFunc задаёт обработчик обрыва соединения, обнаруженного
+// TCP keepalive (см. Config.KeepAliveIdle); nil отключает вызов
+// Thread-safe
+func (conn *TCPConnection) SetKeepAliveFailFunc(fn KeepAliveFailFunc) {
+	if fn == nil {
+		conn.keepAliveFn.Store(nil)
+		return
+	}
+	conn.keepAliveFn.Store(&fn)
+}
+
+// keepAliveError оборачивает ошибку чтения, вызванную неответившими
+// keepalive пробами, в ErrKeepAliveFailed и вызывает KeepAliveFailFunc
+// Остальные ошибки возвращаются без изменений
+func (conn *TCPConnection) keepAliveError(err error) error {
+	if !errors.Is(err, keepAliveTimeoutErrno) {
+		return err
+	}
+	untrackTCPConnection(conn)
+
+	err = fmt.Errorf("%w: %w", ErrKeepAliveFailed, err)
+	if conn.keepAliveFailed.CompareAndSwap(false, true) {
+		if fn := conn.keepAliveFn.Load(); fn != nil {
+			(*fn)(conn, err)
+		}
+	}
+	return err
+}
+
+// applyKeepAlive включает TCP keepalive с параметрами из конфигурации
+// Вызывается для соединений из TCPAccept и TCPConnect
+func applyKeepAlive(c net.Conn) error {
+	cfg := currentConfig()
+	if cfg.KeepAliveIdle == 0 && cfg.KeepAliveInterval == 0 && cfg.KeepAliveCount == 0 {
+		return nil
+	}
+	tc, ok := c.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+
+	if err := tc.SetKeepAlive(true); err != nil {
+		return err
+	}
+	// SetKeepAlivePeriod задаёт и интервал проб, поэтому вызывается первым
+	if cfg.KeepAliveIdle > 0 {
+		if err := tc.SetKeepAlivePeriod(cfg.KeepAliveIdle); err != nil {
+			return err
+		}
+	}
+	if cfg.KeepAliveInterval == 0 && cfg.KeepAliveCount == 0 {
+		return nil
+	}
+	if !keepAliveProbesSupported {
+		return ErrKeepAliveUnsupported
+	}
+
+	raw, err := tc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		if cfg.KeepAliveInterval > 0 {
+			sockErr = setSockoptInt(fd, syscall.IPPROTO_TCP, tcpKeepIntvl, keepAliveSeconds(cfg.KeepAliveInterval))
+		}
+		if sockErr == nil && cfg.KeepAliveCount > 0 {
+			sockErr = setSockoptInt(fd, syscall.IPPROTO_TCP, tcpKeepCnt, cfg.KeepAliveCount)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// keepAliveSeconds переводит длительность в секунды с округлением вверх
+// (опции сокета задаются в целых секундах)
+func keepAliveSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,12 @@
+//go:build darwin
+
+package transport
+
+const (
+	// keepAliveProbesSupported - интервал и число проб настраиваются
+	keepAliveProbesSupported = true
+	// tcpKeepIntvl - TCP_KEEPINTVL (нет в пакете syscall)
+	tcpKeepIntvl = 0x101
+	// tcpKeepCnt - TCP_KEEPCNT (нет в пакете syscall)
+	tcpKeepCnt = 0x102
+)
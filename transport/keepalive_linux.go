@@ -0,0 +1,14 @@
+//go:build linux
+
+package transport
+
+import "syscall"
+
+const (
+	// keepAliveProbesSupported - интервал и число проб настраиваются
+	keepAliveProbesSupported = true
+	// tcpKeepIntvl - TCP_KEEPINTVL
+	tcpKeepIntvl = syscall.TCP_KEEPINTVL
+	// tcpKeepCnt - TCP_KEEPCNT
+	tcpKeepCnt = syscall.TCP_KEEPCNT
+)
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !windows
+
+package transport
+
+const (
+	// keepAliveProbesSupported - интервал и число проб не настраиваются
+	keepAliveProbesSupported = false
+	tcpKeepIntvl             = 0
+	tcpKeepCnt               = 0
+)
@@ -0,0 +1,115 @@
+//go:build linux
+
+package transport
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+func TestTCPConnectAppliesKeepAlive(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.KeepAliveIdle = 30 * time.Second
+	cfg.KeepAliveInterval = 5 * time.Second
+	cfg.KeepAliveCount = 3
+	SetConfig(cfg)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	conn, err := TCPConnect("127.0.0.1", port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{
+		syscall.TCP_KEEPIDLE:  30,
+		syscall.TCP_KEEPINTVL: 5,
+		syscall.TCP_KEEPCNT:   3,
+	}
+	if err := raw.Control(func(fd uintptr) {
+		for opt, value := range want {
+			if got, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, opt); err != nil || got != value {
+				t.Errorf("option %d = %d (%v), want %d", opt, got, err, value)
+			}
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// timeoutConn возвращает заданную ошибку при чтении
+type timeoutConn struct {
+	net.Conn
+	err error
+}
+
+func (c *timeoutConn) Read([]byte) (int, error) {
+	return 0, c.err
+}
+
+func TestKeepAliveFailureCallback(t *testing.T) {
+	deadErr := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ETIMEDOUT)}
+	conn := NewTCPConnection(&timeoutConn{err: deadErr})
+
+	calls := 0
+	conn.SetKeepAliveFailFunc(func(c *TCPConnection, err error) {
+		calls++
+		if c != conn || !errors.Is(err, ErrKeepAliveFailed) {
+			t.Errorf("unexpected callback arguments: %v", err)
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := TCPRecv(conn); !errors.Is(err, ErrKeepAliveFailed) || !errors.Is(err, syscall.ETIMEDOUT) {
+			t.Fatalf("expected ErrKeepAliveFailed, got %v", err)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("callback called %d times, want 1", calls)
+	}
+
+	// Таймаут дедлайна чтения не считается обрывом
+	conn = NewTCPConnection(&timeoutConn{err: os.ErrDeadlineExceeded})
+	defer untrackTCPConnection(conn)
+	if _, _, err := TCPRecv(conn); errors.Is(err, ErrKeepAliveFailed) {
+		t.Fatal("read deadline reported as keepalive failure")
+	}
+}
+
+func TestTCPRecvErrorUntracksConnection(t *testing.T) {
+	resetErr := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+	conn := NewTCPConnection(&timeoutConn{err: resetErr})
+	if _, _, err := TCPRecv(conn); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("expected ECONNRESET, got %v", err)
+	}
+	if isTracked(conn) {
+		t.Fatal("connection still tracked after ECONNRESET")
+	}
+
+	// Таймаут временный: соединение остаётся в статистике
+	conn = NewTCPConnection(&timeoutConn{err: os.ErrDeadlineExceeded})
+	defer untrackTCPConnection(conn)
+	if _, _, err := TCPRecv(conn); !errors.Is(err, ErrRecvTimeout) {
+		t.Fatalf("expected ErrRecvTimeout, got %v", err)
+	}
+	if !isTracked(conn) {
+		t.Fatal("connection untracked after read timeout")
+	}
+}
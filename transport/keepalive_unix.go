@@ -0,0 +1,8 @@
+//go:build !windows
+
+package transport
+
+import "syscall"
+
+// keepAliveTimeoutErrno - ошибка чтения после неответивших keepalive проб
+var keepAliveTimeoutErrno = syscall.ETIMEDOUT
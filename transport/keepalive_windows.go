@@ -0,0 +1,17 @@
+//go:build windows
+
+package transport
+
+import "syscall"
+
+const (
+	// keepAliveProbesSupported - интервал и число проб настраиваются (Windows 10 1709+)
+	keepAliveProbesSupported = true
+	// tcpKeepIntvl - TCP_KEEPINTVL (нет в пакете syscall)
+	tcpKeepIntvl = 17
+	// tcpKeepCnt - TCP_KEEPCNT (нет в пакете syscall)
+	tcpKeepCnt = 16
+)
+
+// keepAliveTimeoutErrno - WSAETIMEDOUT: ошибка чтения после неответивших keepalive проб
+var keepAliveTimeoutErrno = syscall.Errno(10060)
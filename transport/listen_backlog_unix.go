@@ -0,0 +1,11 @@
+//go:build !windows
+
+package transport
+
+import "syscall"
+
+// relisten повторно вызывает listen на слушающем сокете, меняя размер очереди
+// Linux и BSD обновляют backlog уже слушающего сокета
+func relisten(fd uintptr, backlog int) error {
+	return syscall.Listen(int(fd), backlog)
+}
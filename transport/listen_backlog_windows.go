@@ -0,0 +1,11 @@
+//go:build windows
+
+package transport
+
+import "syscall"
+
+// relisten повторно вызывает listen на слушающем сокете
+// Windows принимает вызов, но оставляет backlog, заданный при первом listen
+func relisten(fd uintptr, backlog int) error {
+	return syscall.Listen(syscall.Handle(fd), backlog)
+}
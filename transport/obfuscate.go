@@ -0,0 +1,28 @@
+package transport
+
+import "github.com/nickolajgrishuk/overproto-go/core"
+
+// maskHeader накладывает на заголовок пакета в начале data XOR-маску key
+// (ключ повторяется циклически); повторный вызов снимает маску
+// Пустой key ничего не меняет
+func maskHeader(data []byte, key []byte) {
+	if len(key) == 0 {
+		return
+	}
+	n := min(len(data), core.HeaderSize)
+	for i := 0; i < n; i++ {
+		data[i] ^= key[i%len(key)]
+	}
+}
+
+// maskedHeaderCopy возвращает копию data с маскированным заголовком,
+// не изменяя data; без ключа возвращает data как есть
+// Используется для буферов, которые отправляются повторно (ретрансмиссии)
+func maskedHeaderCopy(data []byte, key []byte) []byte {
+	if len(key) == 0 {
+		return data
+	}
+	masked := append([]byte(nil), data...)
+	maskHeader(masked, key)
+	return masked
+}
@@ -0,0 +1,33 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// ErrProtoMismatch - поле Proto принятого пакета не соответствует транспорту,
+// по которому он пришёл (проверяется при Config.ValidateProto)
+var ErrProtoMismatch = errors.New("packet proto does not match transport")
+
+// checkProto проверяет hdr.Proto для пакета, принятого по транспорту transport
+// (core.ProtoTCP или core.ProtoUDP), если включён Config.ValidateProto
+// По TCP также допускается ProtoHTTP
+func checkProto(hdr *core.PacketHeader, transport uint8) error {
+	if !currentConfig().ValidateProto || hdr.Proto == transport {
+		return nil
+	}
+	if transport == core.ProtoTCP && hdr.Proto == core.ProtoHTTP {
+		return nil
+	}
+	return fmt.Errorf("%w: proto %#x received over %s", ErrProtoMismatch, hdr.Proto, protoName(transport))
+}
+
+// protoName возвращает название транспорта для сообщений об ошибках
+func protoName(proto uint8) string {
+	if proto == core.ProtoUDP {
+		return "UDP"
+	}
+	return "TCP"
+}
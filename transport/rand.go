@@ -0,0 +1,59 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	mathrand "math/rand"
+	"sync"
+)
+
+var (
+	// randSource - источник случайных байт вместо crypto/rand и math/rand,
+	// nil - стандартные генераторы
+	randSource io.Reader
+	// randMutex - мьютекс randSource
+	randMutex sync.Mutex
+)
+
+// SetRandSource задаёт источник случайных байт пакета: идентификаторы
+// соединений, идентификаторы миграции, токены проверки адреса и разброс
+// RTO ретрансмиссий; nil возвращает crypto/rand (и math/rand для разброса)
+// Только для тестов: предсказуемые токены позволяют подделать проверку адреса
+// Thread-safe
+func SetRandSource(r io.Reader) {
+	randMutex.Lock()
+	defer randMutex.Unlock()
+	randSource = r
+}
+
+// currentRandSource возвращает источник SetRandSource или nil
+func currentRandSource() io.Reader {
+	randMutex.Lock()
+	defer randMutex.Unlock()
+	return randSource
+}
+
+// readRandom заполняет buf из текущего источника
+func readRandom(buf []byte) error {
+	src := currentRandSource()
+	if src == nil {
+		src = rand.Reader
+	}
+	_, err := io.ReadFull(src, buf)
+	return err
+}
+
+// randInt63n возвращает случайное число из [0, n) для n > 0
+// Не криптостойкое: используется только для разброса таймеров
+func randInt63n(n int64) int64 {
+	src := currentRandSource()
+	if src == nil {
+		return mathrand.Int63n(n) //nolint:gosec // разброс не требует криптостойкости
+	}
+	var buf [8]byte
+	if _, err := io.ReadFull(src, buf[:]); err != nil {
+		return mathrand.Int63n(n) //nolint:gosec // разброс не требует криптостойкости
+	}
+	return int64(binary.BigEndian.Uint64(buf[:]) % uint64(n))
+}
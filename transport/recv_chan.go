@@ -0,0 +1,43 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// RecvChan запускает цикл приёма (TCPRecv) и передаёт пакеты в канал
+// с буфером size
+// Когда канал заполнен, горутина не читает из сокета: окно TCP закрывается
+// и отправитель замедляется (backpressure)
+// При закрытии соединения (удалённой стороной или через Close) оба канала
+// закрываются без ошибки. При другой ошибке приёма она передаётся в канал
+// ошибок, после чего оба канала закрываются
+// Параллельно с RecvChan вызывать TCPRecv для этого соединения нельзя
+func RecvChan(conn *TCPConnection, size int) (<-chan core.Packet, <-chan error) {
+	if size < 0 {
+		size = 0
+	}
+	packets := make(chan core.Packet, size)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(packets)
+		defer close(errCh)
+
+		for {
+			hdr, payload, err := TCPRecv(conn)
+			if err != nil {
+				if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+					errCh <- err
+				}
+				return
+			}
+			packets <- core.Packet{Header: hdr, Payload: payload}
+		}
+	}()
+
+	return packets, errCh
+}
@@ -0,0 +1,114 @@
+package transport
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"syscall"
+)
+
+const (
+	// ownedPruneThreshold - начальный размер реестра, после которого из него
+	// удаляются сокеты, уже закрытые вызывающим
+	ownedPruneThreshold = 64
+)
+
+var (
+	// ownedSockets - сокеты, открытые библиотекой (слушатели, соединения, UDP сокеты)
+	// Закрываются в CloseAll, если вызывающий не закрыл их сам
+	ownedSockets = make(map[io.Closer]struct{})
+	// ownedPruneAt - размер реестра, при котором выполняется следующая очистка
+	ownedPruneAt = ownedPruneThreshold
+	// ownedMu - мьютекс для ownedSockets
+	ownedMu sync.Mutex
+)
+
+// syscallConner - сокет с доступом к дескриптору (net.TCPConn, net.UDPConn, слушатели)
+type syscallConner interface {
+	SyscallConn() (syscall.RawConn, error)
+}
+
+// trackOwned регистрирует сокет, открытый библиотекой
+func trackOwned(c io.Closer) {
+	ownedMu.Lock()
+	defer ownedMu.Unlock()
+
+	ownedSockets[c] = struct{}{}
+	if len(ownedSockets) >= ownedPruneAt {
+		pruneOwnedLocked()
+		ownedPruneAt = 2 * len(ownedSockets)
+		if ownedPruneAt < ownedPruneThreshold {
+			ownedPruneAt = ownedPruneThreshold
+		}
+	}
+}
+
+// pruneOwnedLocked удаляет из реестра сокеты, закрытые вызывающим
+// Вызывается с захваченным ownedMu
+func pruneOwnedLocked() {
+	for c := range ownedSockets {
+		if isClosedSocket(c) {
+			delete(ownedSockets, c)
+		}
+	}
+}
+
+// isClosedSocket проверяет, закрыт ли сокет
+// Control на закрытом сокете возвращает net.ErrClosed
+func isClosedSocket(c io.Closer) bool {
+	sc, ok := c.(syscallConner)
+	if !ok {
+		return false
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return true
+	}
+	return raw.Control(func(uintptr) {}) != nil
+}
+
+// CloseAll закрывает все сокеты, открытые библиотекой, TCP соединения и надёжные сессии
+// и выключает режим Drain
+// Уже закрытые вызывающим сокеты пропускаются
+// Возвращает объединённую ошибку закрытия
+// Thread-safe
+func CloseAll() error {
+	ownedMu.Lock()
+	sockets := make([]io.Closer, 0, len(ownedSockets))
+	for c := range ownedSockets {
+		sockets = append(sockets, c)
+	}
+	ownedSockets = make(map[io.Closer]struct{})
+	ownedPruneAt = ownedPruneThreshold
+	ownedMu.Unlock()
+	stopDrain()
+
+	registryMu.Lock()
+	conns := make([]*TCPConnection, 0, len(tcpConns))
+	for conn := range tcpConns {
+		conns = append(conns, conn)
+	}
+	sessions := make([]*ReliableContext, 0, len(reliableSessions))
+	for ctx := range reliableSessions {
+		sessions = append(sessions, ctx)
+	}
+	registryMu.Unlock()
+
+	var errs []error
+	for _, ctx := range sessions {
+		ctx.Close()
+	}
+	for _, conn := range conns {
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+	for _, c := range sockets {
+		if err := c.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,35 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestCloseAllClosesOwnedSockets(t *testing.T) {
+	listener, err := TCPListen(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpConn, err := UDPBind(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Уже закрытый вызывающим сокет не должен давать ошибку
+	closed, err := UDPBind(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = closed.Close()
+
+	if err := CloseAll(); err != nil {
+		t.Fatalf("CloseAll: %v", err)
+	}
+
+	if _, err := listener.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("listener not closed: %v", err)
+	}
+	if _, err := udpConn.WriteToUDP([]byte{0}, &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9}); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("udp socket not closed: %v", err)
+	}
+}
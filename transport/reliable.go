@@ -2,6 +2,7 @@ package transport
 
 import (
 	"errors"
+	"math"
 	"net"
 	"sync"
 	"time"
@@ -22,8 +23,29 @@ const (
 	MaxRetries = 5
 	// FastRetransmitThreshold - порог для Fast Retransmit (дубликаты ACK)
 	FastRetransmitThreshold = 3
+	// DefaultMinRTO - нижняя граница RTO по умолчанию в миллисекундах
+	DefaultMinRTO = 200
+	// DefaultMaxRTO - верхняя граница RTO по умолчанию в миллисекундах
+	DefaultMaxRTO = 60000
+	// RTOJitterPercent - случайный разброс таймера ретрансмиссии (±25%)
+	RTOJitterPercent = 25
+	// DeadPeerThreshold - количество подряд недоставленных пакетов,
+	// после которого удалённая сторона считается недоступной
+	DeadPeerThreshold = 3
 )
 
+// ErrPeerDead - удалённая сторона считается недоступной
+var ErrPeerDead = errors.New("peer considered dead")
+
+// ErrSendWindowFull - в окне отправки нет места (см. SendBlocking, WaitForSpace)
+var ErrSendWindowFull = errors.New("send window full")
+
+// ErrSessionClosed - надёжная сессия закрыта
+var ErrSessionClosed = errors.New("reliable session closed")
+
+// DeliveryFailureFunc - callback для пакета, исчерпавшего попытки ретрансмиссии
+type DeliveryFailureFunc func(seq uint32, hdr *core.PacketHeader, payload []byte)
+
 // PacketState - состояние пакета в окне
 type PacketState int
 
@@ -46,6 +68,13 @@ type WindowSlot struct {
 	State      PacketState
 	SentAt     time.Time
 	RetryCount uint32
+	RTO        uint32 // Timeout ожидания ACK для текущей передачи (мс, с jitter)
+	// Retransmitted - пакет отправлялся повторно хотя бы раз (timeout или Fast Retransmit)
+	// По алгоритму Karn такие пакеты не используются для измерения RTT
+	Retransmitted bool
+	// Состояние доставки на момент отправки (для оценки пропускной способности)
+	DeliveredAtSend     uint64
+	DeliveredTimeAtSend time.Time
 }
 
 // RTTStats - статистика RTT
@@ -58,7 +87,8 @@ type RTTStats struct {
 
 // ReliableContext - контекст надёжной передачи через UDP
 type ReliableContext struct {
-	conn *net.UDPConn
+	id   string // Короткий идентификатор для журналов (см. ID)
+	conn net.PacketConn
 	addr *net.UDPAddr
 
 	// Sliding window для отправки
@@ -72,40 +102,252 @@ type ReliableContext struct {
 	recvWindow [WindowSize]bool // Bitmap полученных пакетов
 
 	// RTT
-	rtt RTTStats
+	rtt    RTTStats
+	minRTO uint32 // Нижняя граница RTO (мс)
+	maxRTO uint32 // Верхняя граница RTO (мс)
 
 	// Congestion control
-	cwnd        uint32
-	ssthresh    uint32
+	cc          CongestionController // Алгоритм управления окном (Reno по умолчанию)
 	dupACKCount uint32
 	lastACKSeq  uint32
-	inSlowStart bool
+	hasLastACK  bool // Получен ли хотя бы один ACK (иначе lastACKSeq не определён)
+
+	// Обнаружение недоставки
+	maxRetries          uint32
+	deadPeerThreshold   uint32
+	consecutiveFailures uint32
+	peerDead            bool
+	onDeliveryFailure   DeliveryFailureFunc
+
+	// reliableKeepalive - передавать OpPing/OpPong через окно (по умолчанию нет)
+	reliableKeepalive bool
+
+	// Оценка пропускной способности (см. BandwidthEstimate)
+	delivered     uint64    // Всего подтверждено байт
+	deliveredTime time.Time // Момент последнего подтверждения
+	deliveryRate  uint64    // Сглаженная скорость доставки (байт/с)
+
+	// Pacing (см. SetPacing)
+	pacing     bool
+	nextSendAt time.Time // Самое раннее время следующей отправки
+
+	// NACK (см. SetNACK)
+	nack        bool
+	recvHighest uint32 // Номер, следующий за наибольшим принятым
+
+	// Упорядоченная доставка (см. SetOrdered)
+	ordered     bool
+	reorder     [WindowSize]*orderedPacket // Надёжные пакеты, ожидающие пропущенных
+	held        []orderedPacket            // Ненадёжные пакеты, ожидающие пропущенных
+	ready       []orderedPacket            // Пакеты, готовые к выдаче из Recv
+	lateDropped uint64                     // Отброшено опоздавших ненадёжных пакетов
+	maxReorder  int                        // Предел байт в reorder, held и ready (0 - нет)
+	reorderSize int                        // Байт payload в reorder, held и ready
+
+	// onMetrics - callback метрик congestion control (см. SetCongestionMetricsHook)
+	onMetrics CongestionMetricsFunc
+
+	// userData - данные пользователя (см. SetUserData)
+	userData userData
+	// auth - проверка первого пакета (см. SetAuthFunc)
+	auth authGate
+
+	// Миграция адреса (см. EnableMigration)
+	connID     uint64 // Идентификатор этой стороны
+	peerConnID uint64 // Идентификатор удалённой стороны
+	migrations uint64 // Количество смен адреса удалённой стороны
+
+	// Проверка нового адреса (см. PathState)
+	pendingAddr      *net.UDPAddr // Адрес, ожидающий ответа на проверку
+	pathToken        uint64       // Токен ControlPathChallenge
+	pathChallengedAt time.Time    // Время начала проверки
+
+	// closed - сессия закрыта через Close
+	closed bool
+	// spaceCh закрывается при каждом изменении окна отправки и пересоздаётся;
+	// на нём ожидают блокирующие операции (см. WaitForSpace)
+	spaceCh chan struct{}
 
 	mu sync.Mutex
 }
 
 // NewReliableContext инициализирует контекст надёжной передачи
-func NewReliableContext(conn *net.UDPConn, addr *net.UDPAddr) (*ReliableContext, error) {
+// conn - любой net.PacketConn, например *net.UDPConn или обёртка над ним
+func NewReliableContext(conn net.PacketConn, addr *net.UDPAddr) (*ReliableContext, error) {
 	ctx := &ReliableContext{
+		id:          newConnID(),
 		conn:        conn,
 		addr:        addr,
 		sendBase:    0,
 		nextSeq:     0,
 		windowSize:  WindowSize,
 		recvBase:    0,
-		cwnd:        InitialCwnd,
-		ssthresh:    MaxCwnd,
-		inSlowStart: true,
+		cc:          NewCongestionController(currentConfig().CongestionControl),
+		pacing:      currentConfig().Pacing,
+		nack:        currentConfig().NACK,
+		ordered:     currentConfig().OrderedDelivery,
+		maxReorder:  currentConfig().MaxReorderBuffer,
+
+		maxRetries:        MaxRetries,
+		deadPeerThreshold: DeadPeerThreshold,
+		minRTO:            DefaultMinRTO,
+		maxRTO:            DefaultMaxRTO,
+
+		spaceCh: make(chan struct{}),
 	}
 
 	// Инициализируем RTT статистику
 	ctx.rtt.SRTT = InitialRTT
 	ctx.rtt.RTTVar = InitialRTT / 2
-	ctx.rtt.RTO = ctx.rtt.SRTT + 4*ctx.rtt.RTTVar
+	ctx.rtt.RTO = ctx.clampRTO(ctx.rtt.SRTT + 4*ctx.rtt.RTTVar)
+
+	trackReliableSession(ctx)
 
 	return ctx, nil
 }
 
+// Close завершает надёжную сессию и удаляет её из статистики
+// UDP сокет не закрывается, так как может использоваться другими сессиями
+// Операции, ожидающие места в окне, завершаются с ErrSessionClosed
+func (ctx *ReliableContext) Close() {
+	ctx.mu.Lock()
+	if !ctx.closed {
+		ctx.closed = true
+		ctx.notifySpaceLocked()
+	}
+	ctx.mu.Unlock()
+
+	untrackReliableSession(ctx)
+}
+
+// Stats возвращает снимок состояния сессии
+func (ctx *ReliableContext) Stats() SessionStats {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	pathState, pendingAddr := ctx.pathStateLocked()
+	return SessionStats{
+		ID:           ctx.id,
+		RemoteAddr:   ctx.addr.String(),
+		Migrations:   ctx.migrations,
+		PathState:    pathState,
+		PendingAddr:  pendingAddr,
+		InFlight:     ctx.nextSeq - ctx.sendBase,
+		DeliveryRate: ctx.deliveryRate,
+		LateDropped:  ctx.lateDropped,
+		ReorderBytes: ctx.reorderSize,
+	}
+}
+
+// ID возвращает короткий идентификатор сессии (8 hex символов) для журналов
+// В отличие от ConnectionID не передаётся удалённой стороне
+func (ctx *ReliableContext) ID() string {
+	return ctx.id
+}
+
+// SetRTOBounds устанавливает границы RTO в миллисекундах
+// Без нижней границы RTO на быстром канале стремится к нулю и вызывает
+// ложные ретрансмиссии, без верхней - растёт неограниченно
+func (ctx *ReliableContext) SetRTOBounds(minRTO, maxRTO uint32) error {
+	if minRTO == 0 || minRTO > maxRTO {
+		return errors.New("invalid RTO bounds")
+	}
+
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.minRTO = minRTO
+	ctx.maxRTO = maxRTO
+	ctx.rtt.RTO = ctx.clampRTO(ctx.rtt.RTO)
+	return nil
+}
+
+// clampRTO ограничивает значение RTO границами [minRTO, maxRTO]
+func (ctx *ReliableContext) clampRTO(rto uint32) uint32 {
+	if rto < ctx.minRTO {
+		return ctx.minRTO
+	}
+	if rto > ctx.maxRTO {
+		return ctx.maxRTO
+	}
+	return rto
+}
+
+// SetMaxRetries устанавливает максимум попыток ретрансмиссии одного пакета
+func (ctx *ReliableContext) SetMaxRetries(n uint32) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.maxRetries = n
+}
+
+// SetDeadPeerThreshold устанавливает количество подряд недоставленных пакетов,
+// после которого удалённая сторона считается недоступной (0 - не отслеживать)
+func (ctx *ReliableContext) SetDeadPeerThreshold(n uint32) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.deadPeerThreshold = n
+}
+
+// SetDeliveryFailureHandler устанавливает callback, вызываемый для каждого
+// пакета, исчерпавшего попытки ретрансмиссии
+// Callback вызывается из ProcessTimeouts без удержания внутренних блокировок
+func (ctx *ReliableContext) SetDeliveryFailureHandler(fn DeliveryFailureFunc) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.onDeliveryFailure = fn
+}
+
+// SetReliableKeepalive определяет, проходят ли OpPing/OpPong через окно отправки
+// По умолчанию (false) keepalive пакеты отправляются без FlagReliable:
+// они не занимают sequence number, не ретранслируются и не влияют на окно
+func (ctx *ReliableContext) SetReliableKeepalive(enabled bool) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.reliableKeepalive = enabled
+}
+
+// isKeepalive проверяет, является ли пакет keepalive (OpPing/OpPong)
+func isKeepalive(hdr *core.PacketHeader) bool {
+	return hdr.Opcode == core.OpPing || hdr.Opcode == core.OpPong
+}
+
+// sendUnreliable отправляет пакет вне окна: без sequence number и FlagReliable
+func (ctx *ReliableContext) sendUnreliable(hdr *core.PacketHeader, payload []byte) error {
+	pktHdr := *hdr
+	pktHdr.Seq = 0
+	pktHdr.Flags &^= core.FlagReliable
+
+	serialized, err := core.Serialize(&pktHdr, payload)
+	if err != nil {
+		return err
+	}
+	return ctx.writePacket(serialized)
+}
+
+// IsPeerDead проверяет, признана ли удалённая сторона недоступной
+func (ctx *ReliableContext) IsPeerDead() bool {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.peerDead
+}
+
+// writePacket отправляет сериализованный пакет удалённой стороне
+func (ctx *ReliableContext) writePacket(data []byte) error {
+	// Буфер окна отправляется повторно при ретрансмиссиях: маскируем копию
+	n, err := ctx.conn.WriteTo(maskedHeaderCopy(data, currentConfig().ObfuscationKey), ctx.addr)
+	addBytesOut(n)
+	return wrapPeerError(err)
+}
+
+// checkUnreachableLocked признаёт peer недоступным, если ОС сообщила,
+// что на его порту никто не слушает - ретрансмиссии бесполезны
+// Возвращает err без изменений
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) checkUnreachableLocked(err error) error {
+	if errors.Is(err, ErrPeerUnreachable) {
+		ctx.peerDead = true
+	}
+	return err
+}
+
 // getWindowIndex возвращает индекс в окне для sequence number
 func (ctx *ReliableContext) getWindowIndex(seq uint32) uint32 {
 	return seq % WindowSize
@@ -113,47 +355,74 @@ func (ctx *ReliableContext) getWindowIndex(seq uint32) uint32 {
 
 // isInSendWindow проверяет, находится ли sequence number в окне отправки
 func (ctx *ReliableContext) isInSendWindow(seq uint32) bool {
-	if ctx.sendBase <= seq && seq < ctx.sendBase+ctx.windowSize {
-		return true
-	}
-	// Обработка переполнения (для uint32 максимальное значение 0xFFFFFFFF)
-	if ctx.sendBase+ctx.windowSize < ctx.sendBase {
-		return seq >= ctx.sendBase || seq < ctx.sendBase+ctx.windowSize
-	}
-	return false
+	return inWindow(seq, ctx.sendBase, ctx.windowSize)
 }
 
 // isInRecvWindow проверяет, находится ли sequence number в окне приёма
 func (ctx *ReliableContext) isInRecvWindow(seq uint32) bool {
-	if ctx.recvBase <= seq && seq < ctx.recvBase+ctx.windowSize {
-		return true
+	return inWindow(seq, ctx.recvBase, ctx.windowSize)
+}
+
+// inWindow проверяет, что seq лежит в [base, base+size)
+// Разность uint32 берётся по модулю 2^32, поэтому переход номеров
+// через 0xFFFFFFFF обрабатывается без отдельных ветвей
+func inWindow(seq, base, size uint32) bool {
+	return seq-base < size
+}
+
+// isPriority проверяет, установлен ли у пакета флаг FlagPriority
+func isPriority(hdr *core.PacketHeader) bool {
+	return hdr != nil && hdr.Flags&core.FlagPriority != 0
+}
+
+// hasSpaceLocked проверяет, есть ли место в окне для пакета (с учётом congestion window)
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) hasSpaceLocked(hdr *core.PacketHeader) bool {
+	availableSlots := ctx.windowSize - (ctx.nextSeq - ctx.sendBase)
+	if availableSlots > ctx.windowSize {
+		availableSlots = ctx.windowSize
+	}
+
+	cwnd := ctx.cc.State().Cwnd
+	if availableSlots == 0 || availableSlots > cwnd {
+		availableSlots = cwnd
 	}
-	// Обработка переполнения (для uint32 максимальное значение 0xFFFFFFFF)
-	if ctx.recvBase+ctx.windowSize < ctx.recvBase {
-		return seq >= ctx.recvBase || seq < ctx.recvBase+ctx.windowSize
+
+	// Приоритетные пакеты ограничены только размером окна, но не cwnd
+	if isPriority(hdr) {
+		availableSlots = ctx.windowSize
 	}
-	return false
+
+	return ctx.nextSeq-ctx.sendBase < availableSlots
 }
 
 // Send отправляет пакет с надёжностью
 // Добавляет в sliding window
 // Устанавливает sequence number и флаг FlagReliable
+// Пакеты с FlagPriority не ограничиваются congestion window и первыми
+// рассматриваются при ретрансмиссии. Sequence number присваивается в общем
+// порядке, поэтому приоритет не меняет нумерацию. Без SetOrdered Recv выдаёт
+// пакеты по мере прихода, и приоритетный пакет не ждёт более ранних;
+// с SetOrdered порядок отправки важнее приоритета: пакет ждёт пропущенные
+// Keepalive пакеты (OpPing/OpPong) по умолчанию отправляются вне окна,
+// см. SetReliableKeepalive
 func (ctx *ReliableContext) Send(hdr *core.PacketHeader, payload []byte) error {
 	ctx.mu.Lock()
 	defer ctx.mu.Unlock()
 
-	// Проверяем, есть ли место в окне (с учётом congestion window)
-	availableSlots := ctx.windowSize - (ctx.nextSeq - ctx.sendBase)
-	if availableSlots > ctx.windowSize {
-		availableSlots = ctx.windowSize
+	if ctx.closed {
+		return ErrSessionClosed
+	}
+	if ctx.peerDead {
+		return ErrPeerDead
 	}
 
-	if availableSlots == 0 || availableSlots > ctx.cwnd {
-		availableSlots = ctx.cwnd
+	if isKeepalive(hdr) && !ctx.reliableKeepalive {
+		return ctx.sendUnreliable(hdr, payload)
 	}
 
-	if ctx.nextSeq-ctx.sendBase >= availableSlots {
-		return errors.New("send window full")
+	if !ctx.hasSpaceLocked(hdr) {
+		return ErrSendWindowFull
 	}
 
 	// Присваиваем sequence number
@@ -180,36 +449,79 @@ func (ctx *ReliableContext) Send(hdr *core.PacketHeader, payload []byte) error {
 		State:      StateSent,
 		SentAt:     time.Now(),
 		RetryCount: 0,
+		RTO:        ctx.jitteredRTO(ctx.rtt.RTO),
 	}
+	ctx.stampDeliveryLocked(&ctx.sendWindow[idx], ctx.sendWindow[idx].SentAt)
 
-	// Отправляем пакет
-	_, err = ctx.conn.WriteToUDP(serialized, ctx.addr)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	// Отправляем пакет (с pacing - не раньше назначенного времени)
+	slot := &ctx.sendWindow[idx]
+	sentAt, err := ctx.paceLocked(serialized, slot.SentAt)
+	slot.SentAt = sentAt
+	return ctx.checkUnreachableLocked(err)
 }
 
 // Recv принимает пакет с надёжностью
 // Отправляет ACK
 // Обрабатывает дубликаты
+// Принятый ACK (FlagACK) сразу передаётся в ProcessACK
+// С SetOrdered пакеты выдаются в порядке отправки: пакет, пришедший раньше
+// пропущенных, возвращается позже вместе с ними
 func (ctx *ReliableContext) Recv() (*core.PacketHeader, []byte, error) {
+	// Сначала выдаём пакеты, освобождённые заполнением пропуска
+	if hdr, payload, ok := ctx.popReady(); ok {
+		return hdr, payload, nil
+	}
+
 	// Принимаем пакет через UDP
 	hdr, payload, addr, err := UDPRecv(ctx.conn)
 	if err != nil {
+		ctx.mu.Lock()
+		err = ctx.checkUnreachableLocked(err)
+		ctx.mu.Unlock()
 		return nil, nil, err
 	}
+	return ctx.handlePacket(hdr, payload, addr)
+}
 
-	// Проверяем адрес
-	if addr.String() != ctx.addr.String() {
+// handlePacket обрабатывает принятый пакет удалённой стороны как Recv
+// Пакеты, которые SetOrdered освободил вместе с этим, выдаёт popReady
+func (ctx *ReliableContext) handlePacket(hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr) (*core.PacketHeader, []byte, error) {
+	// Проверяем адрес (с учётом миграции, см. EnableMigration)
+	ctx.mu.Lock()
+	accepted := ctx.acceptSourceLocked(hdr, payload, addr)
+	ctx.mu.Unlock()
+	if !accepted {
 		// Игнорируем пакеты от других адресов
 		return nil, nil, errors.New("packet from wrong address")
 	}
 
+	// NACK обрабатывается как ACK: сразу и без аутентификации
+	if seqs, ok := nackControl(hdr, payload); ok {
+		_, err := ctx.ProcessNACK(seqs)
+		return hdr, payload, err
+	}
+
+	// Первый пакет данных проходит аутентификацию, иначе сессия закрывается
+	if hdr.Flags&core.FlagACK == 0 {
+		if err := ctx.auth.check(hdr.StreamID, payload); err != nil {
+			ctx.Close()
+			return nil, nil, err
+		}
+	}
+
+	// ACK обрабатывается сразу и не подтверждается
+	// Возвращается вызывающему, повторный ProcessACK для него ничего не меняет
+	if hdr.Flags&core.FlagACK != 0 {
+		_ = ctx.ProcessACK(hdr.Seq)
+		return hdr, payload, nil
+	}
+
 	// Проверяем флаг надёжности
 	if hdr.Flags&core.FlagReliable == 0 {
 		// Не надёжный пакет - возвращаем как есть
+		if hdr.Flags&core.FlagOrdered != 0 {
+			return ctx.recvOrderedUnreliable(hdr, payload)
+		}
 		return hdr, payload, nil
 	}
 
@@ -237,6 +549,21 @@ func (ctx *ReliableContext) Recv() (*core.PacketHeader, []byte, error) {
 
 	// Сохраняем пакет
 	ctx.recvWindow[idx] = true
+	ctx.nackGapLocked(seq)
+
+	if ctx.ordered {
+		if err := ctx.bufferOrderedLocked(idx, hdr, payload); err != nil {
+			// Удалённая сторона не восполняет пропуск: сессия завершается,
+			// а не накапливает память
+			ctx.closed = true
+			ctx.notifySpaceLocked()
+			untrackReliableSession(ctx)
+			return nil, nil, err
+		}
+		ctx.deliverInOrderLocked()
+		ctx.sendACK(seq)
+		return ctx.popReadyLocked()
+	}
 
 	// Если это ожидаемый пакет (recvBase), сдвигаем окно
 	if seq == ctx.recvBase {
@@ -257,6 +584,7 @@ func (ctx *ReliableContext) Recv() (*core.PacketHeader, []byte, error) {
 func (ctx *ReliableContext) sendACK(ackSeq uint32) {
 	ackHdr := core.NewPacketHeader()
 	ackHdr.Opcode = core.OpACK
+	ackHdr.Proto = core.ProtoUDP
 	ackHdr.Flags = core.FlagACK | core.FlagReliable
 	ackHdr.Seq = ackSeq
 
@@ -266,7 +594,7 @@ func (ctx *ReliableContext) sendACK(ackSeq uint32) {
 		return
 	}
 
-	_, _ = ctx.conn.WriteToUDP(serialized, ctx.addr)
+	_ = ctx.writePacket(serialized)
 }
 
 // ProcessACK обрабатывает входящий ACK
@@ -275,12 +603,30 @@ func (ctx *ReliableContext) sendACK(ackSeq uint32) {
 // Управляет congestion control
 func (ctx *ReliableContext) ProcessACK(ackSeq uint32) error {
 	ctx.mu.Lock()
-	defer ctx.mu.Unlock()
+	updated := ctx.processACKLocked(ackSeq)
+	onMetrics := ctx.onMetrics
+	var sample CongestionSample
+	if updated && onMetrics != nil {
+		sample = ctx.congestionSampleLocked()
+	}
+	ctx.mu.Unlock()
+
+	// Метрики передаются вне блокировки
+	if updated && onMetrics != nil {
+		onMetrics(sample)
+	}
+
+	return nil
+}
 
+// processACKLocked обрабатывает ACK
+// Возвращает true, если ACK новый и RTT/cwnd могли измениться
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) processACKLocked(ackSeq uint32) bool {
 	// Проверяем, находится ли ACK в окне отправки
 	if !ctx.isInSendWindow(ackSeq) {
 		// Вне окна - игнорируем
-		return nil
+		return false
 	}
 
 	idx := ctx.getWindowIndex(ackSeq)
@@ -289,54 +635,76 @@ func (ctx *ReliableContext) ProcessACK(ackSeq uint32) error {
 	// Проверяем состояние слота
 	if slot.State == StateEmpty || slot.State == StateACKed {
 		// Уже обработан или пуст
-		return nil
+		return false
 	}
 
 	// Проверяем, является ли это дубликатом ACK
-	if ackSeq == ctx.lastACKSeq {
+	if ctx.hasLastACK && ackSeq == ctx.lastACKSeq {
 		ctx.dupACKCount++
 		if ctx.dupACKCount == FastRetransmitThreshold {
 			// Fast Retransmit
 			if slot.State == StateSent {
 				slot.State = StateRetransmit
+				slot.Retransmitted = true
 				// Ретранслируем немедленно
-				_, _ = ctx.conn.WriteToUDP(slot.Serialized, ctx.addr)
+				_ = ctx.writePacket(slot.Serialized)
 			}
 		}
-		return nil
+		return false
 	}
 
 	// Новый ACK
 	ctx.dupACKCount = 0
 	ctx.lastACKSeq = ackSeq
+	ctx.hasLastACK = true
 
-	// Обновляем RTT статистику (только для первого ACK, не для ретрансмиссий)
-	if slot.RetryCount == 0 && slot.State == StateSent {
-		rttMillis := time.Since(slot.SentAt).Milliseconds()
+	// Обновляем RTT статистику (Karn's algorithm): ACK ретранслированного пакета
+	// неоднозначен - неизвестно, какой из передач он соответствует
+	now := time.Now()
+	ack := AckEvent{Now: now, AckedBytes: len(slot.Serialized)}
+	if !slot.Retransmitted && slot.State == StateSent {
+		rttMillis := now.Sub(slot.SentAt).Milliseconds()
 		rtt, err := core.SafeInt64ToUint32(rttMillis)
 		if err == nil {
 			ctx.updateRTT(rtt)
+			ack.RTT = rtt
+			ack.RTTSampled = true
 		}
 	}
 
+	// Учитываем доставленные байты для оценки пропускной способности
+	ack.DeliveryRate = ctx.onDeliveredLocked(slot, now)
+
 	// Помечаем пакет как подтверждённый
 	slot.State = StateACKed
+	ctx.consecutiveFailures = 0
 
 	// Обновляем congestion window
-	ctx.updateCongestionWindow()
+	ack.InFlight = ctx.nextSeq - ctx.sendBase - 1
+	ctx.cc.OnACK(ack)
 
 	// Сдвигаем окно отправки, если возможно
-	for ctx.sendBase < ctx.nextSeq {
+	ctx.advanceSendBase()
+
+	return true
+}
+
+// advanceSendBase сдвигает начало окна отправки через подтверждённые
+// и брошенные (исчерпавшие попытки) пакеты
+func (ctx *ReliableContext) advanceSendBase() {
+	// Сравнение на неравенство: после 0xFFFFFFFF nextSeq меньше sendBase
+	for ctx.sendBase != ctx.nextSeq {
 		baseIdx := ctx.getWindowIndex(ctx.sendBase)
-		if ctx.sendWindow[baseIdx].State == StateACKed {
-			ctx.sendWindow[baseIdx] = WindowSlot{} // Очищаем слот
-			ctx.sendBase++
-		} else {
+		state := ctx.sendWindow[baseIdx].State
+		if state != StateACKed && state != StateEmpty {
 			break
 		}
+		ctx.sendWindow[baseIdx] = WindowSlot{} // Очищаем слот
+		ctx.sendBase++
 	}
 
-	return nil
+	// Окно или cwnd могли измениться - будим ожидающих
+	ctx.notifySpaceLocked()
 }
 
 // updateRTT обновляет RTT статистику (Karn's algorithm)
@@ -357,98 +725,163 @@ func (ctx *ReliableContext) updateRTT(rtt uint32) {
 		ctx.rtt.SRTT = (7*ctx.rtt.SRTT + rtt) / 8
 	}
 
-	ctx.rtt.RTO = ctx.rtt.SRTT + 4*ctx.rtt.RTTVar
+	ctx.rtt.RTO = ctx.clampRTO(ctx.rtt.SRTT + 4*ctx.rtt.RTTVar)
 	ctx.rtt.SamplesCount++
 }
 
-// updateCongestionWindow обновляет congestion window
-func (ctx *ReliableContext) updateCongestionWindow() {
-	if ctx.inSlowStart {
-		// Slow Start: экспоненциальный рост
-		ctx.cwnd++
-		if ctx.cwnd >= ctx.ssthresh {
-			ctx.inSlowStart = false
-		}
-		if ctx.cwnd > MaxCwnd {
-			ctx.cwnd = MaxCwnd
-		}
-	} else {
-		// Congestion Avoidance: линейный рост
-		ctx.cwnd += 1 / ctx.cwnd // Упрощённая версия
-		if ctx.cwnd > MaxCwnd {
-			ctx.cwnd = MaxCwnd
-		}
-	}
-}
-
 // ProcessTimeouts обрабатывает таймеры
 // Ретранслирует пакеты при timeout
 // Возвращает количество ретранслированных пакетов
+// Для пакетов, исчерпавших попытки, вызывается DeliveryFailureFunc;
+// если подряд не доставлено DeadPeerThreshold пакетов, возвращается ErrPeerDead
 func (ctx *ReliableContext) ProcessTimeouts() (int, error) {
 	ctx.mu.Lock()
-	defer ctx.mu.Unlock()
+	retransmitted, failed, err := ctx.processTimeoutsLocked()
+	onFailure := ctx.onDeliveryFailure
+	if err == nil && ctx.peerDead && len(failed) > 0 {
+		err = ErrPeerDead
+	}
+	// Ретрансмиссия сбрасывает cwnd и ssthresh
+	onMetrics := ctx.onMetrics
+	var sample CongestionSample
+	if retransmitted > 0 && onMetrics != nil {
+		sample = ctx.congestionSampleLocked()
+	}
+	ctx.mu.Unlock()
 
-	retransmitted := 0
-	now := time.Now()
+	if retransmitted > 0 && onMetrics != nil {
+		onMetrics(sample)
+	}
 
-	// Проверяем все пакеты в окне отправки
-	for i := uint32(0); i < ctx.windowSize; i++ {
-		seq := ctx.sendBase + i
-		if seq >= ctx.nextSeq {
-			break
+	// Уведомляем о недоставленных пакетах вне блокировки
+	if onFailure != nil {
+		for _, slot := range failed {
+			onFailure(slot.Header.Seq, slot.Header, slot.Data)
 		}
+	}
 
-		idx := ctx.getWindowIndex(seq)
-		slot := &ctx.sendWindow[idx]
+	return retransmitted, err
+}
 
-		if slot.State == StateEmpty || slot.State == StateACKed {
-			continue
-		}
+// processTimeoutsLocked обходит окно отправки и ретранслирует просроченные пакеты
+// Возвращает количество ретрансмиссий и слоты, исчерпавшие попытки
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) processTimeoutsLocked() (int, []WindowSlot, error) {
+	retransmitted := 0
+	var failed []WindowSlot
+	now := time.Now()
 
-		// Проверяем timeout
-		elapsedMillis := now.Sub(slot.SentAt).Milliseconds()
-		elapsed, err := core.SafeInt64ToUint32(elapsedMillis)
-		if err != nil {
-			// Если конвертация не удалась, считаем что timeout произошел
-			elapsed = ctx.rtt.RTO + 1
-		}
-		if elapsed > ctx.rtt.RTO {
-			// Timeout
-			if slot.RetryCount >= MaxRetries {
-				// Превышен лимит попыток - удаляем из окна
-				slot.State = StateEmpty
+	// Проверяем все пакеты в окне отправки
+	// Приоритетные пакеты (FlagPriority) рассматриваются первыми
+	for _, priority := range [2]bool{true, false} {
+		inFlight := ctx.nextSeq - ctx.sendBase
+		for i := uint32(0); i < ctx.windowSize && i < inFlight; i++ {
+			seq := ctx.sendBase + i
+
+			slot := &ctx.sendWindow[ctx.getWindowIndex(seq)]
+			if slot.State == StateEmpty || slot.State == StateACKed {
 				continue
 			}
-
-			// Ретранслируем пакет
-			slot.RetryCount++
-			slot.SentAt = now
-			slot.State = StateRetransmit
-
-			// Применяем exponential backoff
-			backoffRTO := ctx.rtt.RTO
-			for j := uint32(0); j < slot.RetryCount; j++ {
-				backoffRTO *= 2
+			if isPriority(slot.Header) != priority {
+				continue
 			}
 
-			// Уменьшаем congestion window
-			ctx.ssthresh = ctx.cwnd / 2
-			if ctx.ssthresh < 2 {
-				ctx.ssthresh = 2
+			// Превышен лимит попыток - пакет считается недоставленным
+			if slot.RetryCount >= ctx.maxRetries && ctx.isExpired(slot, now) {
+				failed = append(failed, *slot)
+				ctx.markDeliveryFailed(slot)
+				continue
 			}
-			ctx.cwnd = InitialCwnd
-			ctx.inSlowStart = true
 
-			// Отправляем пакет
-			_, err := ctx.conn.WriteToUDP(slot.Serialized, ctx.addr)
+			sent, err := ctx.retransmitIfExpired(slot, now)
 			if err != nil {
-				return retransmitted, err
+				return retransmitted, failed, err
+			}
+			if sent {
+				retransmitted++
 			}
-
-			retransmitted++
 		}
 	}
 
-	return retransmitted, nil
+	// Брошенные пакеты освобождают место в окне
+	ctx.advanceSendBase()
+
+	return retransmitted, failed, nil
+}
+
+// markDeliveryFailed освобождает слот недоставленного пакета
+// и обновляет счётчик подряд недоставленных пакетов
+func (ctx *ReliableContext) markDeliveryFailed(slot *WindowSlot) {
+	slot.State = StateEmpty
+	ctx.consecutiveFailures++
+	if ctx.deadPeerThreshold > 0 && ctx.consecutiveFailures >= ctx.deadPeerThreshold {
+		ctx.peerDead = true
+	}
+}
+
+// isExpired проверяет, истёк ли timeout ожидания ACK для слота
+func (ctx *ReliableContext) isExpired(slot *WindowSlot, now time.Time) bool {
+	elapsedMillis := now.Sub(slot.SentAt).Milliseconds()
+	elapsed, err := core.SafeInt64ToUint32(elapsedMillis)
+	if err != nil {
+		// Если конвертация не удалась, считаем что timeout произошел
+		return true
+	}
+	return elapsed > slot.RTO
+}
+
+// jitterRTO добавляет к таймеру случайный разброс ±RTOJitterPercent,
+// чтобы потоки, потерявшие пакеты одновременно, не ретранслировали синхронно
+func jitterRTO(rto uint32) uint32 {
+	spread := int64(rto) * RTOJitterPercent / 100
+	if spread == 0 {
+		return rto
+	}
+	jittered := int64(rto) - spread + randInt63n(2*spread+1)
+	result, err := core.SafeInt64ToUint32(jittered)
+	if err != nil {
+		return rto
+	}
+	return result
+}
+
+// jitteredRTO добавляет к rto разброс jitterRTO и ограничивает результат
+// границами SetRTOBounds: разброс не выводит таймер за minRTO и maxRTO
+func (ctx *ReliableContext) jitteredRTO(rto uint32) uint32 {
+	return ctx.clampRTO(jitterRTO(ctx.clampRTO(rto)))
 }
 
+// retransmitIfExpired ретранслирует пакет из слота, если истёк его timeout
+// Возвращает true, если пакет был отправлен повторно
+func (ctx *ReliableContext) retransmitIfExpired(slot *WindowSlot, now time.Time) (bool, error) {
+	// Проверяем timeout
+	if !ctx.isExpired(slot, now) {
+		return false, nil
+	}
+
+	// Ретранслируем пакет
+	slot.RetryCount++
+	slot.SentAt = now
+	slot.State = StateRetransmit
+	slot.Retransmitted = true
+	ctx.stampDeliveryLocked(slot, now)
+
+	// Применяем exponential backoff: следующая ретрансмиссия этого пакета
+	// разрешена не раньше чем через RTO * 2^RetryCount
+	backoffRTO := ctx.rtt.RTO
+	// Удвоение свыше math.MaxUint32/2 переполнило бы uint32 (maxRTO не ограничен)
+	for j := uint32(0); j < slot.RetryCount && backoffRTO < ctx.maxRTO && backoffRTO <= math.MaxUint32/2; j++ {
+		backoffRTO *= 2
+	}
+	slot.RTO = ctx.jitteredRTO(backoffRTO)
+
+	// Уменьшаем congestion window
+	ctx.cc.OnRetransmitTimeout()
+
+	// Отправляем пакет
+	if err := ctx.writePacket(slot.Serialized); err != nil {
+		return false, ctx.checkUnreachableLocked(err)
+	}
+
+	return true, nil
+}
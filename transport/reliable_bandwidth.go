@@ -0,0 +1,56 @@
+package transport
+
+import "time"
+
+const (
+	// deliveryRateGain - вес нового образца в сглаженной скорости доставки (1/8, как для SRTT)
+	deliveryRateGain = 8
+)
+
+// stampDeliveryLocked запоминает состояние доставки в момент (ре)трансмиссии пакета
+// Если в полёте нет других пакетов, отсчёт интервала начинается с момента отправки,
+// чтобы простой канала не занижал оценку
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) stampDeliveryLocked(slot *WindowSlot, now time.Time) {
+	if ctx.deliveredTime.IsZero() || ctx.nextSeq-ctx.sendBase <= 1 {
+		ctx.deliveredTime = now
+	}
+	slot.DeliveredAtSend = ctx.delivered
+	slot.DeliveredTimeAtSend = ctx.deliveredTime
+}
+
+// onDeliveredLocked учитывает подтверждённый пакет и обновляет оценку скорости
+// Образец скорости (как delivery rate в BBR) - байты, подтверждённые с момента
+// отправки пакета, делённые на время между подтверждением, предшествовавшим
+// отправке, и текущим подтверждением
+// Возвращает образец скорости (байт/с) или 0, если он не получен
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) onDeliveredLocked(slot *WindowSlot, now time.Time) uint64 {
+	ctx.delivered += uint64(len(slot.Serialized))
+	ctx.deliveredTime = now
+
+	interval := now.Sub(slot.DeliveredTimeAtSend)
+	if interval <= 0 {
+		return 0
+	}
+
+	sample := (ctx.delivered - slot.DeliveredAtSend) * uint64(time.Second) / uint64(interval)
+	if ctx.deliveryRate == 0 {
+		ctx.deliveryRate = sample
+		return sample
+	}
+	// EWMA: rate = 7/8 * rate + 1/8 * sample
+	ctx.deliveryRate = ((deliveryRateGain-1)*ctx.deliveryRate + sample) / deliveryRateGain
+	return sample
+}
+
+// BandwidthEstimate возвращает оценку скорости доставки сессии в байтах в секунду
+// Каждый ACK даёт образец скорости (байты, подтверждённые за время полёта пакета),
+// образцы сглаживаются EWMA с весом 1/8
+// Учитываются полные размеры пакетов (заголовок, payload и CRC32)
+// Возвращает 0, пока не получено ни одного ACK
+func (ctx *ReliableContext) BandwidthEstimate() uint64 {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.deliveryRate
+}
@@ -0,0 +1,117 @@
+package transport
+
+import (
+	"context"
+	"errors"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// notifySpaceLocked будит все операции, ожидающие изменения окна отправки
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) notifySpaceLocked() {
+	close(ctx.spaceCh)
+	ctx.spaceCh = make(chan struct{})
+}
+
+// WaitForSpace блокируется, пока в окне отправки не появится место для пакета
+// с заголовком hdr (nil - обычный пакет без FlagPriority)
+// Место освобождается только при обработке ACK (ProcessACK) или брошенных
+// пакетов (ProcessTimeouts), поэтому их должна вызывать другая горутина
+// Возвращает ошибку контекста (context.DeadlineExceeded, context.Canceled),
+// ErrPeerDead или ErrSessionClosed
+func (ctx *ReliableContext) WaitForSpace(c context.Context, hdr *core.PacketHeader) error {
+	if hdr == nil {
+		hdr = &core.PacketHeader{}
+	}
+
+	for {
+		ctx.mu.Lock()
+		switch {
+		case ctx.closed:
+			ctx.mu.Unlock()
+			return ErrSessionClosed
+		case ctx.peerDead:
+			ctx.mu.Unlock()
+			return ErrPeerDead
+		case ctx.hasSpaceLocked(hdr):
+			ctx.mu.Unlock()
+			return nil
+		}
+		spaceCh := ctx.spaceCh
+		ctx.mu.Unlock()
+
+		select {
+		case <-spaceCh:
+		case <-c.Done():
+			return c.Err()
+		}
+	}
+}
+
+// SendBlocking отправляет пакет с надёжностью, ожидая места в окне
+// Завершается по истечении дедлайна или отмене контекста с его ошибкой,
+// чтобы зависшая удалённая сторона не блокировала отправителя бесконечно
+func (ctx *ReliableContext) SendBlocking(c context.Context, hdr *core.PacketHeader, payload []byte) error {
+	for {
+		err := ctx.Send(hdr, payload)
+		if !errors.Is(err, ErrSendWindowFull) {
+			return err
+		}
+		if err := ctx.WaitForSpace(c, hdr); err != nil {
+			return err
+		}
+	}
+}
+
+// Flush блокируется, пока все отправленные пакеты (в том числе отложенные
+// pacing) не будут подтверждены: sendBase == nextSeq
+// Пакеты, исчерпавшие попытки ретрансмиссии, также освобождают окно и
+// сообщаются через SetDeliveryFailureHandler
+// ACK обрабатываются другой горутиной (Recv/ProcessACK и ProcessTimeouts)
+// При дедлайне или отмене c, ErrPeerDead или ErrSessionClosed возвращает
+// Seq пакетов, оставшихся неподтверждёнными, вместе с ошибкой
+func (ctx *ReliableContext) Flush(c context.Context) ([]uint32, error) {
+	for {
+		ctx.mu.Lock()
+		var err error
+		switch {
+		case ctx.sendBase == ctx.nextSeq:
+			ctx.mu.Unlock()
+			return nil, nil
+		case ctx.closed:
+			err = ErrSessionClosed
+		case ctx.peerDead:
+			err = ErrPeerDead
+		}
+		if err != nil {
+			unacked := ctx.unackedLocked()
+			ctx.mu.Unlock()
+			return unacked, err
+		}
+		spaceCh := ctx.spaceCh
+		ctx.mu.Unlock()
+
+		select {
+		case <-spaceCh:
+		case <-c.Done():
+			ctx.mu.Lock()
+			unacked := ctx.unackedLocked()
+			ctx.mu.Unlock()
+			return unacked, c.Err()
+		}
+	}
+}
+
+// unackedLocked возвращает Seq неподтверждённых пакетов окна отправки
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) unackedLocked() []uint32 {
+	var unacked []uint32
+	for seq := ctx.sendBase; seq != ctx.nextSeq; seq++ {
+		state := ctx.sendWindow[ctx.getWindowIndex(seq)].State
+		if state != StateACKed && state != StateEmpty {
+			unacked = append(unacked, seq)
+		}
+	}
+	return unacked
+}
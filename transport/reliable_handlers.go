@@ -0,0 +1,67 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// SessionHandler - обработчик пакетов одного опкода в ReliableSession
+// Вызывается в горутине сессии в порядке выдачи пакетов. Пока обработчик
+// выполняется, сессия не принимает пакеты и не обрабатывает ACK, поэтому
+// он не должен блокироваться, в том числе на Send той же сессии
+type SessionHandler func(hdr *core.PacketHeader, payload []byte)
+
+// Handle регистрирует обработчик fn пакетов с опкодом opcode; nil удаляет его
+// Пакеты с обработчиком не передаются в Recv
+// По умолчанию сессия сама отвечает на OpPing пакетом OpPong с тем же
+// payload и поглощает OpPong; Handle для этих опкодов заменяет встроенную
+// обработку, а nil возвращает их в Recv
+func (s *ReliableSession) Handle(opcode uint8, fn SessionHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	if fn == nil {
+		delete(s.handlers, opcode)
+		return
+	}
+	s.handlers[opcode] = fn
+}
+
+// SendOpcode отправляет data с опкодом opcode, как SendContext отправляет OpData
+// OpPing и OpPong передаются вне окна (см. SetReliableKeepalive)
+func (s *ReliableSession) SendOpcode(c context.Context, opcode uint8, data []byte) error {
+	hdr, err := s.header(opcode, data)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ctx.SendBlocking(c, hdr, data); err != nil {
+		return s.sessionError(err)
+	}
+	return nil
+}
+
+// handler возвращает обработчик опкода или nil
+func (s *ReliableSession) handler(opcode uint8) SessionHandler {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	return s.handlers[opcode]
+}
+
+// defaultHandlers возвращает встроенные обработчики keepalive
+func (s *ReliableSession) defaultHandlers() map[uint8]SessionHandler {
+	return map[uint8]SessionHandler{
+		core.OpPing: s.replyPong,
+		core.OpPong: func(*core.PacketHeader, []byte) {},
+	}
+}
+
+// replyPong отвечает на OpPing пакетом OpPong с тем же StreamID и payload
+// Ответ не ждёт места в окне: при полном окне он теряется, как потерянный ping
+func (s *ReliableSession) replyPong(hdr *core.PacketHeader, payload []byte) {
+	pong := *hdr
+	pong.Opcode = core.OpPong
+	pong.Flags = 0
+	pong.Seq = 0
+	_ = s.ctx.Send(&pong, payload)
+}
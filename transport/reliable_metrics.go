@@ -0,0 +1,50 @@
+package transport
+
+import "time"
+
+// CongestionSample - значения congestion control и RTT после обработки ACK
+// или ретрансмиссии по таймауту
+type CongestionSample struct {
+	Time        time.Time // Момент снятия значений
+	Cwnd        uint32    // Congestion window (пакеты)
+	Ssthresh    uint32    // Порог slow start (пакеты)
+	InSlowStart bool      // Находится ли сессия в slow start
+	SRTT        uint32    // Smoothed RTT в миллисекундах
+	RTTVar      uint32    // RTT variance в миллисекундах
+	RTO         uint32    // Retransmission timeout в миллисекундах
+	InFlight    uint32    // Отправленные, но не подтверждённые пакеты
+	// DeliveryRate - оценка скорости доставки (байт/с), см. BandwidthEstimate
+	DeliveryRate uint64
+}
+
+// CongestionMetricsFunc - callback метрик congestion control
+// Вызывается без удержания внутренних блокировок, поэтому может
+// обращаться к методам сессии; должен быть быстрым
+type CongestionMetricsFunc func(sample CongestionSample)
+
+// SetCongestionMetricsHook устанавливает callback, получающий cwnd, ssthresh,
+// SRTT и RTO после каждого нового ACK и после ретрансмиссий по таймауту
+// nil отключает callback; без callback значения не собираются
+func (ctx *ReliableContext) SetCongestionMetricsHook(fn CongestionMetricsFunc) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.onMetrics = fn
+}
+
+// congestionSampleLocked снимает текущие значения congestion control
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) congestionSampleLocked() CongestionSample {
+	state := ctx.cc.State()
+	return CongestionSample{
+		Time:        time.Now(),
+		Cwnd:        state.Cwnd,
+		Ssthresh:    state.Ssthresh,
+		InSlowStart: state.InSlowStart,
+		SRTT:        ctx.rtt.SRTT,
+		RTTVar:      ctx.rtt.RTTVar,
+		RTO:         ctx.rtt.RTO,
+		InFlight:    ctx.nextSeq - ctx.sendBase,
+
+		DeliveryRate: ctx.deliveryRate,
+	}
+}
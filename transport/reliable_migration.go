@@ -0,0 +1,210 @@
+package transport
+
+import (
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// PathValidationTimeout - время ожидания ответа на проверку нового адреса
+const PathValidationTimeout = 3 * time.Second
+
+// PathState - состояние проверки адреса удалённой стороны
+type PathState uint8
+
+const (
+	// PathValidated - пакеты отправляются на проверенный адрес, проверки нет
+	PathValidated PathState = iota
+	// PathValidating - с нового адреса пришёл известный идентификатор соединения,
+	// ожидается ответ на ControlPathChallenge
+	PathValidating
+)
+
+// EnableMigration создаёт случайный идентификатор соединения и сообщает его
+// удалённой стороне (OpControl с ControlConnectionID)
+// После этого удалённая сторона продолжает сессию, когда сообщение с тем же
+// идентификатором приходит с нового адреса (смена сети, NAT rebinding)
+// и новый адрес подтверждает получение ControlPathChallenge
+// Возвращает идентификатор; повторный вызов возвращает прежний
+func (ctx *ReliableContext) EnableMigration() (uint64, error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.connID == 0 {
+		var buf [8]byte
+		for ctx.connID == 0 {
+			if err := readRandom(buf[:]); err != nil {
+				return 0, err
+			}
+			ctx.connID = binary.BigEndian.Uint64(buf[:])
+		}
+	}
+	return ctx.connID, ctx.announceConnectionIDLocked()
+}
+
+// AnnounceConnectionID повторно отправляет идентификатор соединения
+// Вызывается после смены сети, а также периодически: сообщение отправляется
+// без подтверждения и может потеряться
+func (ctx *ReliableContext) AnnounceConnectionID() error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.connID == 0 {
+		return nil
+	}
+	return ctx.announceConnectionIDLocked()
+}
+
+// ConnectionID возвращает идентификатор соединения этой стороны (0 - миграция не включена)
+func (ctx *ReliableContext) ConnectionID() uint64 {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.connID
+}
+
+// PeerConnectionID возвращает идентификатор соединения удалённой стороны (0 - не получен)
+func (ctx *ReliableContext) PeerConnectionID() uint64 {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.peerConnID
+}
+
+// RemoteAddr возвращает текущий адрес удалённой стороны
+func (ctx *ReliableContext) RemoteAddr() *net.UDPAddr {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	return ctx.addr
+}
+
+// announceConnectionIDLocked отправляет ControlConnectionID вне окна
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) announceConnectionIDLocked() error {
+	return ctx.sendControlLocked(core.NewConnectionIDMessage(ctx.connID), ctx.addr)
+}
+
+// migrationControl разбирает управляющие сообщения миграции
+// (ControlConnectionID, ControlPathChallenge, ControlPathResponse)
+// Возвращает nil для остальных пакетов
+func migrationControl(hdr *core.PacketHeader, payload []byte) *core.ControlMessage {
+	if hdr.Opcode != core.OpControl || hdr.Flags&core.FlagReliable != 0 {
+		return nil
+	}
+	msg, err := core.DecodeControl(payload)
+	if err != nil {
+		return nil
+	}
+	switch msg.Type {
+	case core.ControlConnectionID, core.ControlPathChallenge, core.ControlPathResponse:
+		return msg
+	}
+	return nil
+}
+
+// acceptSourceLocked проверяет адрес отправителя принятого пакета
+// Пакет с текущего адреса принимается; ControlConnectionID с него задаёт
+// идентификатор удалённой стороны, а на ControlPathChallenge отправляется ответ
+// С другого адреса принимаются только сообщения миграции: известный
+// идентификатор запускает проверку адреса, верный ответ на неё переводит
+// сессию на новый адрес
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) acceptSourceLocked(hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr) bool {
+	msg := migrationControl(hdr, payload)
+	if addr.String() == ctx.addr.String() {
+		if msg != nil {
+			ctx.handleControlLocked(msg)
+		}
+		return true
+	}
+
+	if msg == nil || ctx.peerConnID == 0 {
+		return false
+	}
+	switch msg.Type {
+	case core.ControlConnectionID:
+		id, err := msg.Uint64(core.TagConnID)
+		if err != nil || id != ctx.peerConnID {
+			return false
+		}
+		ctx.challengePathLocked(addr)
+		return true
+	case core.ControlPathResponse:
+		token, err := msg.Uint64(core.TagToken)
+		if err != nil || ctx.pendingAddr == nil || token != ctx.pathToken ||
+			addr.String() != ctx.pendingAddr.String() {
+			return false
+		}
+		ctx.addr = addr
+		ctx.pendingAddr = nil
+		ctx.migrations++
+		return true
+	}
+	return false
+}
+
+// handleControlLocked обрабатывает сообщение миграции с текущего адреса
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) handleControlLocked(msg *core.ControlMessage) {
+	switch msg.Type {
+	case core.ControlConnectionID:
+		if id, err := msg.Uint64(core.TagConnID); err == nil && id != 0 {
+			ctx.peerConnID = id
+		}
+	case core.ControlPathChallenge:
+		if token, err := msg.Uint64(core.TagToken); err == nil {
+			_ = ctx.sendControlLocked(core.NewPathResponse(token), ctx.addr)
+		}
+	}
+}
+
+// challengePathLocked отправляет на новый адрес запрос проверки
+// До ответа пакеты по-прежнему отправляются на текущий адрес
+// Повторный ControlConnectionID с того же адреса повторяет запрос с прежним
+// токеном, если проверка ещё не истекла
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) challengePathLocked(addr *net.UDPAddr) {
+	now := time.Now()
+	if ctx.pendingAddr == nil || addr.String() != ctx.pendingAddr.String() ||
+		now.Sub(ctx.pathChallengedAt) > PathValidationTimeout {
+		var buf [8]byte
+		if err := readRandom(buf[:]); err != nil {
+			return
+		}
+		ctx.pendingAddr = addr
+		ctx.pathToken = binary.BigEndian.Uint64(buf[:])
+		ctx.pathChallengedAt = now
+	}
+	_ = ctx.sendControlLocked(core.NewPathChallenge(ctx.pathToken), addr)
+}
+
+// sendControlLocked отправляет управляющее сообщение вне окна на адрес addr
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) sendControlLocked(msg *core.ControlMessage, addr *net.UDPAddr) error {
+	payload, err := core.EncodeControl(msg)
+	if err != nil {
+		return err
+	}
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpControl
+	hdr.Proto = core.ProtoUDP
+	hdr.PayloadLen = uint16(len(payload))
+
+	serialized, err := core.Serialize(hdr, payload)
+	if err != nil {
+		return err
+	}
+	maskHeader(serialized, currentConfig().ObfuscationKey)
+	n, err := ctx.conn.WriteTo(serialized, addr)
+	addBytesOut(n)
+	return wrapPeerError(err)
+}
+
+// pathStateLocked возвращает состояние проверки адреса для статистики
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) pathStateLocked() (PathState, string) {
+	if ctx.pendingAddr == nil || time.Since(ctx.pathChallengedAt) > PathValidationTimeout {
+		return PathValidated, ""
+	}
+	return PathValidating, ctx.pendingAddr.String()
+}
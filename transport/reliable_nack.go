@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// SetNACK включает или выключает отправку NACK на этой стороне
+// Получив пакет с номером больше ожидаемого, сессия сразу отправляет
+// ControlNACK со списком пропущенных номеров, и отправитель повторяет их,
+// не дожидаясь таймаута или трёх дубликатов ACK. Каждый пропуск
+// запрашивается один раз; потерянный NACK покрывается обычной ретрансмиссией
+// Обработка входящих NACK включена всегда
+func (ctx *ReliableContext) SetNACK(enabled bool) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.nack = enabled
+}
+
+// ProcessNACK немедленно ретранслирует перечисленные пакеты, ещё не
+// подтверждённые получателем; номера вне окна отправки пропускаются
+// Как и Fast Retransmit, не уменьшает congestion window и не расходует
+// попытки ретрансмиссии. Возвращает количество ретранслированных пакетов
+func (ctx *ReliableContext) ProcessNACK(seqs []uint32) (int, error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	retransmitted := 0
+	now := time.Now()
+	for _, seq := range seqs {
+		if !ctx.isInSendWindow(seq) {
+			continue
+		}
+		slot := &ctx.sendWindow[ctx.getWindowIndex(seq)]
+		// Пакет, ожидающий отправки по pacing, ещё не мог потеряться
+		if slot.State == StateEmpty || slot.State == StateACKed || slot.SentAt.After(now) {
+			continue
+		}
+
+		slot.SentAt = now
+		slot.State = StateRetransmit
+		slot.Retransmitted = true
+		ctx.stampDeliveryLocked(slot, now)
+		if err := ctx.writePacket(slot.Serialized); err != nil {
+			return retransmitted, ctx.checkUnreachableLocked(err)
+		}
+		retransmitted++
+	}
+	return retransmitted, nil
+}
+
+// nackControl разбирает ControlNACK; ok == false для остальных пакетов
+func nackControl(hdr *core.PacketHeader, payload []byte) ([]uint32, bool) {
+	if hdr.Opcode != core.OpControl || hdr.Flags&core.FlagReliable != 0 {
+		return nil, false
+	}
+	msg, err := core.DecodeControl(payload)
+	if err != nil || msg.Type != core.ControlNACK {
+		return nil, false
+	}
+	seqs, err := msg.Uint32s(core.TagSeqs)
+	if err != nil {
+		return nil, false
+	}
+	return seqs, true
+}
+
+// nackGapLocked запрашивает пакеты, пропущенные перед принятым seq
+// Пропуск - номера от наибольшего ранее принятого до seq; номера ниже
+// recvBase уже доставлены
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) nackGapLocked(seq uint32) {
+	from := ctx.recvHighest
+	if int32(from-ctx.recvBase) < 0 {
+		from = ctx.recvBase
+	}
+	if int32(seq-from) < 0 {
+		// Пакет заполнил уже запрошенный пропуск
+		return
+	}
+	ctx.recvHighest = seq + 1
+	if !ctx.nack || seq == from {
+		return
+	}
+
+	missing := make([]uint32, 0, seq-from)
+	for s := from; s != seq; s++ {
+		if !ctx.recvWindow[ctx.getWindowIndex(s)] {
+			missing = append(missing, s)
+		}
+	}
+	if len(missing) > 0 {
+		_ = ctx.sendControlLocked(core.NewNACK(missing), ctx.addr)
+	}
+}
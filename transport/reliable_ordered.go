@@ -0,0 +1,183 @@
+package transport
+
+import (
+	"errors"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// maxHeldUnreliable - предел ненадёжных пакетов, ожидающих пропущенные надёжные;
+// сверх него пакеты отбрасываются как опоздавшие
+const maxHeldUnreliable = 256
+
+var (
+	// ErrReorderBufferFull - пакеты, ожидающие пропущенный, превысили
+	// предел SetMaxReorderBuffer; сессия завершается
+	ErrReorderBufferFull = errors.New("reorder buffer limit exceeded")
+	// errPacketHeld - пакет отложен до прихода пропущенных (не ошибка сессии)
+	errPacketHeld = errors.New("packet held until earlier packets arrive")
+	// errPacketLate - ненадёжный пакет опоздал: более поздний уже выдан
+	errPacketLate = errors.New("late unreliable packet dropped")
+)
+
+// orderedPacket - принятый пакет, ожидающий выдачи в порядке отправки
+type orderedPacket struct {
+	hdr     *core.PacketHeader
+	payload []byte
+}
+
+// SetOrdered включает или выключает выдачу пакетов в порядке отправки
+// Надёжные пакеты выдаются по возрастанию Seq: пакет, пришедший раньше
+// пропущенного, ждёт его ретрансмиссии. Ненадёжный пакет SendUnreliable
+// выдаётся после всех надёжных, отправленных до него, и до всех надёжных,
+// отправленных после; если более поздний надёжный уже выдан, пакет
+// отбрасывается (SessionStats.LateDropped). Пакеты с FlagPriority
+// упорядочиваются так же. Без упорядочивания все пакеты выдаются по мере прихода
+// Вызывается до начала обмена; достаточно включить на принимающей стороне
+func (ctx *ReliableContext) SetOrdered(enabled bool) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.ordered = enabled
+}
+
+// SetMaxReorderBuffer ограничивает объём payload (в байтах), который
+// упорядоченная доставка держит в ожидании пропущенных пакетов
+// Надёжный пакет сверх предела завершает сессию с ErrReorderBufferFull,
+// ненадёжный отбрасывается как опоздавший. Пакет, выдаваемый сразу,
+// не ограничивается. 0 - без ограничения
+func (ctx *ReliableContext) SetMaxReorderBuffer(n int) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.maxReorder = n
+}
+
+// SendUnreliable отправляет пакет вне окна: без подтверждения и ретрансмиссии,
+// не дожидаясь места в окне и congestion window
+// Пакет получает FlagOrdered и Seq следующего надёжного пакета, по которому
+// получатель с SetOrdered ставит его между соседними надёжными пакетами
+func (ctx *ReliableContext) SendUnreliable(hdr *core.PacketHeader, payload []byte) error {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if ctx.closed {
+		return ErrSessionClosed
+	}
+	if ctx.peerDead {
+		return ErrPeerDead
+	}
+
+	pktHdr := *hdr
+	pktHdr.Seq = ctx.nextSeq
+	pktHdr.Flags = (pktHdr.Flags | core.FlagOrdered) &^ core.FlagReliable
+
+	serialized, err := core.Serialize(&pktHdr, payload)
+	if err != nil {
+		return err
+	}
+	return ctx.checkUnreachableLocked(ctx.writePacket(serialized))
+}
+
+// recvOrderedUnreliable обрабатывает принятый ненадёжный пакет с FlagOrdered
+// Seq пакета - номер первого надёжного пакета, отправленного после него
+func (ctx *ReliableContext) recvOrderedUnreliable(hdr *core.PacketHeader, payload []byte) (*core.PacketHeader, []byte, error) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	if !ctx.ordered {
+		return hdr, payload, nil
+	}
+
+	// Расстояние до recvBase с учётом переполнения uint32
+	switch ahead := hdr.Seq - ctx.recvBase; {
+	case ahead == 0:
+		// Все предшествующие надёжные выданы, последующие - ещё нет
+		return hdr, payload, nil
+	case ahead <= ctx.windowSize && len(ctx.held) < maxHeldUnreliable && ctx.reorderFitsLocked(len(payload)):
+		ctx.held = append(ctx.held, orderedPacket{hdr: hdr, payload: payload})
+		ctx.reorderSize += len(payload)
+		return nil, nil, errPacketHeld
+	default:
+		ctx.lateDropped++
+		return nil, nil, errPacketLate
+	}
+}
+
+// bufferOrderedLocked сохраняет принятый надёжный пакет в слот idx до выдачи
+// Возвращает ErrReorderBufferFull, если пакет ждёт пропущенных и не
+// помещается в предел SetMaxReorderBuffer
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) bufferOrderedLocked(idx uint32, hdr *core.PacketHeader, payload []byte) error {
+	if hdr.Seq != ctx.recvBase && !ctx.reorderFitsLocked(len(payload)) {
+		return ErrReorderBufferFull
+	}
+	ctx.reorder[idx] = &orderedPacket{hdr: hdr, payload: payload}
+	ctx.reorderSize += len(payload)
+	return nil
+}
+
+// reorderFitsLocked проверяет, помещаются ли ещё n байт в предел
+// SetMaxReorderBuffer
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) reorderFitsLocked(n int) bool {
+	return ctx.maxReorder <= 0 || ctx.reorderSize+n <= ctx.maxReorder
+}
+
+// deliverInOrderLocked переносит в очередь выдачи непрерывную последовательность
+// надёжных пакетов от recvBase и ненадёжные пакеты, стоящие перед ними,
+// сдвигая окно приёма
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) deliverInOrderLocked() {
+	for {
+		ctx.releaseHeldLocked(ctx.recvBase)
+
+		idx := ctx.getWindowIndex(ctx.recvBase)
+		if !ctx.recvWindow[idx] {
+			return
+		}
+		ctx.ready = append(ctx.ready, *ctx.reorder[idx])
+		ctx.reorder[idx] = nil
+		ctx.recvWindow[idx] = false
+		ctx.recvBase++
+	}
+}
+
+// releaseHeldLocked переносит в очередь выдачи отложенные ненадёжные пакеты
+// с Seq == seq в порядке их прихода
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) releaseHeldLocked(seq uint32) {
+	kept := ctx.held[:0]
+	for _, pkt := range ctx.held {
+		if pkt.hdr.Seq == seq {
+			ctx.ready = append(ctx.ready, pkt)
+		} else {
+			kept = append(kept, pkt)
+		}
+	}
+	for i := len(kept); i < len(ctx.held); i++ {
+		ctx.held[i] = orderedPacket{}
+	}
+	ctx.held = kept
+}
+
+// popReady извлекает следующий пакет из очереди выдачи
+func (ctx *ReliableContext) popReady() (*core.PacketHeader, []byte, bool) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+
+	hdr, payload, err := ctx.popReadyLocked()
+	return hdr, payload, err == nil
+}
+
+// popReadyLocked извлекает следующий пакет из очереди выдачи;
+// errPacketHeld, если очередь пуста
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) popReadyLocked() (*core.PacketHeader, []byte, error) {
+	if len(ctx.ready) == 0 {
+		return nil, nil, errPacketHeld
+	}
+	pkt := ctx.ready[0]
+	ctx.ready[0] = orderedPacket{}
+	ctx.ready = ctx.ready[1:]
+	ctx.reorderSize -= len(pkt.payload)
+	return pkt.hdr, pkt.payload, nil
+}
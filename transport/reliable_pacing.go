@@ -0,0 +1,59 @@
+package transport
+
+import "time"
+
+// SetPacing включает или выключает pacing отправки
+// С pacing новые пакеты отправляются не подряд, а с интервалом: размер пакета,
+// делённый на PacingRate контроллера, или SRTT/cwnd, если контроллер скорость не задаёт
+// Это убирает micro-burst'ы, вызывающие потери на путях с малыми буферами
+// Send по-прежнему не блокируется: отложенные пакеты отправляются таймером
+// Ретрансмиссии отправляются немедленно
+func (ctx *ReliableContext) SetPacing(enabled bool) {
+	ctx.mu.Lock()
+	defer ctx.mu.Unlock()
+	ctx.pacing = enabled
+	ctx.nextSendAt = time.Time{}
+}
+
+// pacingIntervalLocked возвращает интервал между пакетами размера size
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) pacingIntervalLocked(size int) time.Duration {
+	state := ctx.cc.State()
+	if state.PacingRate > 0 {
+		return time.Duration(uint64(size) * uint64(time.Second) / state.PacingRate)
+	}
+	if state.Cwnd == 0 {
+		return 0
+	}
+	return time.Duration(ctx.rtt.SRTT) * time.Millisecond / time.Duration(state.Cwnd)
+}
+
+// paceLocked отправляет пакет сразу или планирует его отправку таймером
+// Возвращает время фактической (или запланированной) отправки
+// Вызывается с захваченным ctx.mu
+func (ctx *ReliableContext) paceLocked(data []byte, now time.Time) (time.Time, error) {
+	if !ctx.pacing {
+		return now, ctx.writePacket(data)
+	}
+
+	interval := ctx.pacingIntervalLocked(len(data))
+	if !ctx.nextSendAt.After(now) {
+		ctx.nextSendAt = now.Add(interval)
+		return now, ctx.writePacket(data)
+	}
+
+	sendAt := ctx.nextSendAt
+	ctx.nextSendAt = sendAt.Add(interval)
+
+	// Количество отложенных пакетов ограничено cwnd, поэтому задержка не превышает ~SRTT
+	time.AfterFunc(sendAt.Sub(now), func() {
+		// Адрес может смениться при миграции, поэтому отправка под блокировкой
+		ctx.mu.Lock()
+		defer ctx.mu.Unlock()
+		if !ctx.closed {
+			_ = ctx.writePacket(data)
+		}
+	})
+
+	return sendAt, nil
+}
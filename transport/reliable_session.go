@@ -0,0 +1,233 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// SessionTickInterval - период обработки таймеров ретрансмиссии ReliableSession
+const SessionTickInterval = 20 * time.Millisecond
+
+// ReliableSession - надёжная UDP сессия, сама обрабатывающая ACK и ретрансмиссии
+// Внутренняя горутина принимает пакеты, вызывает ProcessACK и ProcessTimeouts
+// и передаёт payload принятых пакетов в Recv
+// Сессия владеет чтением из conn: вызывать UDPRecv на этом сокете параллельно нельзя
+type ReliableSession struct {
+	ctx      *ReliableContext
+	conn     net.PacketConn
+	streamID uint32
+
+	recvCh chan []byte
+
+	// Обработчики опкодов (см. Handle)
+	handlersMu sync.Mutex
+	handlers   map[uint8]SessionHandler
+	done       chan struct{}
+	wg         sync.WaitGroup
+
+	closeOnce sync.Once
+	errMu     sync.Mutex
+	err       error // Причина завершения сессии
+}
+
+// NewReliableSession создаёт надёжную сессию с удалённой стороной addr и
+// запускает горутину обработки; пакеты отправляются в поток streamID
+// Сессия завершается вызовом Close или при ошибке (например, ErrPeerDead)
+func NewReliableSession(conn net.PacketConn, addr *net.UDPAddr, streamID uint32) (*ReliableSession, error) {
+	ctx, err := NewReliableContext(conn, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ReliableSession{
+		ctx:      ctx,
+		conn:     conn,
+		streamID: streamID,
+		recvCh:   make(chan []byte, WindowSize),
+		done:     make(chan struct{}),
+	}
+	s.handlers = s.defaultHandlers()
+	s.wg.Add(1)
+	go s.loop()
+	return s, nil
+}
+
+// ID возвращает короткий идентификатор сессии (см. ReliableContext.ID)
+// Ошибки сессии оборачиваются в ConnError с этим ID
+func (s *ReliableSession) ID() string {
+	return s.ctx.ID()
+}
+
+// Context возвращает контекст надёжной передачи сессии
+// для настройки (SetMaxRetries, SetRTOBounds, SetAuthFunc) и статистики
+func (s *ReliableSession) Context() *ReliableContext {
+	return s.ctx
+}
+
+// Send отправляет data с надёжностью, ожидая места в окне отправки
+// Возвращает ErrSessionClosed после Close или причину завершения сессии
+func (s *ReliableSession) Send(data []byte) error {
+	return s.SendContext(context.Background(), data)
+}
+
+// SendContext отправляет data как Send, но ожидание места в окне
+// ограничено контекстом c
+func (s *ReliableSession) SendContext(c context.Context, data []byte) error {
+	return s.SendOpcode(c, core.OpData, data)
+}
+
+// SendUnreliable отправляет data без подтверждения и ретрансмиссии
+// (см. ReliableContext.SendUnreliable); не блокируется на окне отправки
+// Получатель с Config.OrderedDelivery выдаёт пакет между надёжными,
+// отправленными до и после него, или отбрасывает, если он опоздал
+func (s *ReliableSession) SendUnreliable(data []byte) error {
+	hdr, err := s.header(core.OpData, data)
+	if err != nil {
+		return err
+	}
+
+	if err := s.ctx.SendUnreliable(hdr, data); err != nil {
+		return s.sessionError(err)
+	}
+	return nil
+}
+
+// header создаёт заголовок пакета сессии с опкодом opcode для data
+func (s *ReliableSession) header(opcode uint8, data []byte) (*core.PacketHeader, error) {
+	payloadLen, err := core.SafeIntToUint16(len(data))
+	if err != nil {
+		return nil, errors.New("payload too large (max 65535 bytes)")
+	}
+
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = opcode
+	hdr.Proto = core.ProtoUDP
+	hdr.StreamID = s.streamID
+	hdr.PayloadLen = payloadLen
+	return hdr, nil
+}
+
+// Flush ожидает подтверждения всех отправленных пакетов (см. ReliableContext.Flush)
+// Вызывается перед Close, чтобы не потерять неподтверждённые данные
+func (s *ReliableSession) Flush(c context.Context) ([]uint32, error) {
+	unacked, err := s.ctx.Flush(c)
+	if err != nil {
+		return unacked, s.sessionError(err)
+	}
+	return nil, nil
+}
+
+// Recv возвращает payload следующего принятого пакета
+// Пакеты выдаются в порядке прихода (в порядке отправки с
+// Config.OrderedDelivery), дубликаты отбрасываются; пакеты опкодов
+// с обработчиком (см. Handle) сюда не попадают
+// После завершения сессии возвращает оставшиеся пакеты, затем причину
+// завершения (ErrSessionClosed после Close)
+func (s *ReliableSession) Recv() ([]byte, error) {
+	data, ok := <-s.recvCh
+	if !ok {
+		return nil, s.Err()
+	}
+	return data, nil
+}
+
+// Err возвращает причину завершения сессии или nil, если она активна
+func (s *ReliableSession) Err() error {
+	s.errMu.Lock()
+	defer s.errMu.Unlock()
+	return s.err
+}
+
+// Close завершает сессию и дожидается остановки горутины обработки
+// UDP сокет не закрывается
+func (s *ReliableSession) Close() error {
+	s.shutdown(ErrSessionClosed)
+	// Прерываем ожидание пакета в горутине обработки
+	_ = s.conn.SetReadDeadline(time.Now())
+	s.wg.Wait()
+	_ = s.conn.SetReadDeadline(time.Time{})
+	return nil
+}
+
+// shutdown завершает сессию с причиной err (учитывается первая)
+func (s *ReliableSession) shutdown(err error) {
+	s.closeOnce.Do(func() {
+		s.errMu.Lock()
+		s.err = wrapConnError(s.ctx.ID(), err)
+		s.errMu.Unlock()
+		close(s.done)
+		s.ctx.Close()
+	})
+}
+
+// sessionError заменяет ErrSessionClosed причиной завершения сессии
+// и добавляет к ошибке идентификатор сессии
+func (s *ReliableSession) sessionError(err error) error {
+	if errors.Is(err, ErrSessionClosed) {
+		if cause := s.Err(); cause != nil {
+			return cause
+		}
+	}
+	return wrapConnError(s.ctx.ID(), err)
+}
+
+// loop принимает пакеты и обрабатывает таймеры до завершения сессии
+func (s *ReliableSession) loop() {
+	defer s.wg.Done()
+	defer close(s.recvCh)
+
+	nextTick := time.Now().Add(SessionTickInterval)
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		if now := time.Now(); !now.Before(nextTick) {
+			nextTick = now.Add(SessionTickInterval)
+			if _, err := s.ctx.ProcessTimeouts(); err != nil {
+				s.shutdown(err)
+				return
+			}
+		}
+
+		_ = s.conn.SetReadDeadline(nextTick)
+		hdr, payload, err := s.ctx.Recv()
+		if err != nil {
+			if isSessionFatal(err) {
+				s.shutdown(err)
+				return
+			}
+			// Таймаут чтения, дубликат или пакет от другого адреса
+			continue
+		}
+		// ACK, NACK и сообщения миграции обработаны контекстом
+		if isSessionControl(hdr, payload) {
+			continue
+		}
+		// Пакеты с обработчиком опкода (см. Handle) не попадают в Recv
+		if fn := s.handler(hdr.Opcode); fn != nil {
+			fn(hdr, payload)
+			continue
+		}
+
+		select {
+		case s.recvCh <- payload:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// isSessionFatal проверяет, завершает ли ошибка приёма сессию
+func isSessionFatal(err error) bool {
+	return errors.Is(err, ErrPeerDead) || errors.Is(err, ErrPeerUnreachable) ||
+		errors.Is(err, ErrSessionClosed) || errors.Is(err, ErrAuthFailed) ||
+		errors.Is(err, ErrReorderBufferFull) || errors.Is(err, net.ErrClosed)
+}
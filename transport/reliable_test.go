@@ -0,0 +1,1049 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// newLoopbackContext создаёт надёжный контекст поверх пары loopback UDP сокетов
+func newLoopbackContext(t *testing.T) (*ReliableContext, *net.UDPConn) {
+	t.Helper()
+
+	local, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	t.Cleanup(func() { _ = local.Close() })
+
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP failed: %v", err)
+	}
+	t.Cleanup(func() { _ = peer.Close() })
+
+	peerAddr, ok := peer.LocalAddr().(*net.UDPAddr)
+	if !ok {
+		t.Fatal("unexpected peer address type")
+	}
+
+	ctx, err := NewReliableContext(local, peerAddr)
+	if err != nil {
+		t.Fatalf("NewReliableContext failed: %v", err)
+	}
+	t.Cleanup(ctx.Close)
+
+	return ctx, peer
+}
+
+// TestKarnSkipsRetransmittedPackets проверяет, что ACK ретранслированного
+// пакета не используется для оценки RTT
+func TestKarnSkipsRetransmittedPackets(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+
+	if err := ctx.Send(core.NewPacketHeader(), []byte("data")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	// Имитируем истёкший timeout и ретрансмиссию
+	slot := &ctx.sendWindow[ctx.getWindowIndex(0)]
+	slot.SentAt = time.Now().Add(-time.Hour)
+	retransmitted, err := ctx.ProcessTimeouts()
+	if err != nil {
+		t.Fatalf("ProcessTimeouts failed: %v", err)
+	}
+	if retransmitted != 1 {
+		t.Fatalf("expected 1 retransmission, got %d", retransmitted)
+	}
+
+	// ACK приходит "через 10 секунд" после отправки - такой образец исказил бы SRTT
+	slot.SentAt = time.Now().Add(-10 * time.Second)
+	slot.State = StateSent
+	if err := ctx.ProcessACK(0); err != nil {
+		t.Fatalf("ProcessACK failed: %v", err)
+	}
+
+	if ctx.rtt.SamplesCount != 0 {
+		t.Errorf("RTT sampled for retransmitted packet: %d samples", ctx.rtt.SamplesCount)
+	}
+	if ctx.rtt.SRTT != InitialRTT {
+		t.Errorf("SRTT polluted by retransmitted packet: got %d, expected %d", ctx.rtt.SRTT, InitialRTT)
+	}
+}
+
+// TestRetransmitBackoffNoOverflow проверяет, что exponential backoff при
+// maxRTO > 2^31 не переполняет uint32 и не сбрасывает RTO к minRTO
+func TestRetransmitBackoffNoOverflow(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+	if err := ctx.SetRTOBounds(100, math.MaxUint32); err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.Send(core.NewPacketHeader(), []byte("data")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	const rto = 3_000_000_000
+	ctx.mu.Lock()
+	ctx.rtt.RTO = rto
+	ctx.mu.Unlock()
+	slot := &ctx.sendWindow[ctx.getWindowIndex(0)]
+	slot.SentAt = time.Now().Add(-100 * 24 * time.Hour)
+	if _, err := ctx.ProcessTimeouts(); err != nil {
+		t.Fatalf("ProcessTimeouts failed: %v", err)
+	}
+	if lower := uint32(rto - rto*RTOJitterPercent/100); slot.RTO < lower {
+		t.Fatalf("backoff RTO overflowed: got %d ms, want at least %d ms", slot.RTO, lower)
+	}
+}
+
+// TestRTTSampledForFirstTransmission проверяет, что ACK первой передачи учитывается в RTT
+func TestRTTSampledForFirstTransmission(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+
+	if err := ctx.Send(core.NewPacketHeader(), []byte("data")); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := ctx.ProcessACK(0); err != nil {
+		t.Fatalf("ProcessACK failed: %v", err)
+	}
+
+	if ctx.rtt.SamplesCount != 1 {
+		t.Errorf("expected 1 RTT sample, got %d", ctx.rtt.SamplesCount)
+	}
+}
+
+func TestSendBlockingRespectsDeadline(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+
+	hdr := core.NewPacketHeader()
+	payload := []byte("data")
+	hdr.PayloadLen = uint16(len(payload))
+	for i := 0; i < InitialCwnd; i++ {
+		if err := ctx.Send(hdr, payload); err != nil {
+			t.Fatalf("Send %d failed: %v", i, err)
+		}
+	}
+	if err := ctx.Send(hdr, payload); !errors.Is(err, ErrSendWindowFull) {
+		t.Fatalf("expected ErrSendWindowFull, got %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := ctx.SendBlocking(timeout, hdr, payload); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected DeadlineExceeded, got %v", err)
+	}
+
+	// ACK первого пакета освобождает место и будит отправителя
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = ctx.ProcessACK(0)
+	}()
+	wait, cancelWait := context.WithTimeout(context.Background(), time.Second)
+	defer cancelWait()
+	if err := ctx.SendBlocking(wait, hdr, payload); err != nil {
+		t.Fatalf("SendBlocking after ACK failed: %v", err)
+	}
+}
+
+func TestCongestionMetricsHookOnACK(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+
+	var samples []CongestionSample
+	ctx.SetCongestionMetricsHook(func(sample CongestionSample) {
+		// Callback вызывается без блокировки: обращение к сессии допустимо
+		_ = ctx.Stats()
+		samples = append(samples, sample)
+	})
+
+	hdr := core.NewPacketHeader()
+	if err := ctx.Send(hdr, nil); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if err := ctx.ProcessACK(0); err != nil {
+		t.Fatalf("ProcessACK failed: %v", err)
+	}
+	// Повторный ACK уже подтверждённого пакета не порождает выборку
+	_ = ctx.ProcessACK(0)
+
+	if len(samples) != 1 {
+		t.Fatalf("expected 1 sample, got %d", len(samples))
+	}
+	if samples[0].Cwnd != InitialCwnd+1 || samples[0].InFlight != 0 || samples[0].RTO == 0 {
+		t.Fatalf("unexpected sample: %+v", samples[0])
+	}
+}
+
+func TestBandwidthEstimateFromACK(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+
+	payload := make([]byte, 1000)
+	hdr := core.NewPacketHeader()
+	hdr.PayloadLen = uint16(len(payload))
+	if err := ctx.Send(hdr, payload); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := ctx.ProcessACK(0); err != nil {
+		t.Fatalf("ProcessACK failed: %v", err)
+	}
+
+	// 1028 байт за ~20 мс: не больше 1028 / 0.02 = 51400 байт/с
+	rate := ctx.BandwidthEstimate()
+	if rate == 0 || rate > 51400 {
+		t.Fatalf("unexpected bandwidth estimate: %d", rate)
+	}
+	if got := ctx.Stats().DeliveryRate; got != rate {
+		t.Fatalf("Stats().DeliveryRate = %d, want %d", got, rate)
+	}
+}
+
+func TestPacingSpacesSends(t *testing.T) {
+	ctx, peer := newLoopbackContext(t)
+	ctx.SetPacing(true)
+
+	// SRTT 100 мс и cwnd 4: интервал 25 мс, четыре пакета - не меньше 75 мс
+	hdr := core.NewPacketHeader()
+	start := time.Now()
+	for i := 0; i < InitialCwnd; i++ {
+		if err := ctx.Send(hdr, nil); err != nil {
+			t.Fatalf("Send %d failed: %v", i, err)
+		}
+	}
+	if time.Since(start) > 20*time.Millisecond {
+		t.Fatal("Send blocked while pacing")
+	}
+
+	buf := make([]byte, 64)
+	_ = peer.SetReadDeadline(time.Now().Add(time.Second))
+	for i := 0; i < InitialCwnd; i++ {
+		if _, _, err := peer.ReadFromUDP(buf); err != nil {
+			t.Fatalf("read %d failed: %v", i, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Fatalf("packets not paced: all received in %v", elapsed)
+	}
+}
+
+// lossyConn теряет каждую третью исходящую датаграмму
+type lossyConn struct {
+	net.PacketConn
+	writes int
+}
+
+func (c *lossyConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.writes++
+	if c.writes%3 == 0 {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func TestReliableSessionDeliversWithLoss(t *testing.T) {
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+	connA, connB := listen(), listen()
+
+	sender, err := NewReliableSession(&lossyConn{PacketConn: connA}, connB.LocalAddr().(*net.UDPAddr), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewReliableSession(connB, connA.LocalAddr().(*net.UDPAddr), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sender.Context().SetRTOBounds(20, 200); err != nil {
+		t.Fatal(err)
+	}
+
+	const count = 100
+	go func() {
+		for i := 0; i < count; i++ {
+			if err := sender.Send([]byte{byte(i)}); err != nil {
+				t.Errorf("Send %d: %v", i, err)
+				return
+			}
+		}
+	}()
+
+	received := make(map[byte]bool)
+	for len(received) < count {
+		data, err := receiver.Recv()
+		if err != nil {
+			t.Fatalf("Recv after %d packets: %v", len(received), err)
+		}
+		received[data[0]] = true
+	}
+
+	if err := receiver.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := receiver.Recv(); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("expected ErrSessionClosed, got %v", err)
+	}
+	_ = sender.Close()
+}
+
+func TestReliableMigrationValidatesPath(t *testing.T) {
+	server, client := newLoopbackContext(t)
+
+	// Клиент сообщает идентификатор со своего исходного адреса
+	clientCtx, err := NewReliableContext(client, server.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientCtx.Close()
+	id, err := clientCtx.EnableMigration()
+	if err != nil || id == 0 {
+		t.Fatalf("EnableMigration: id=%d err=%v", id, err)
+	}
+	if _, _, err := server.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	if server.PeerConnectionID() != id {
+		t.Fatal("peer connection ID was not learned")
+	}
+
+	// Клиент сменил адрес: тот же идентификатор приходит с нового сокета
+	moved, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer moved.Close()
+	payload, err := core.EncodeControl(core.NewConnectionIDMessage(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpControl
+	hdr.PayloadLen = uint16(len(payload))
+	if _, err := UDPSend(moved, hdr, payload, server.conn.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.Recv(); err != nil {
+		t.Fatal(err)
+	}
+
+	// До ответа на проверку сессия остаётся на прежнем адресе
+	stats := server.Stats()
+	if stats.PathState != PathValidating || stats.PendingAddr != moved.LocalAddr().String() ||
+		server.RemoteAddr().String() != client.LocalAddr().String() {
+		t.Fatalf("unexpected state before validation: %+v", stats)
+	}
+
+	// Новый адрес получает токен и возвращает его
+	_, challenge, _, err := UDPRecv(moved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := core.DecodeControl(challenge)
+	if err != nil || msg.Type != core.ControlPathChallenge {
+		t.Fatalf("expected path challenge, got %v %v", msg, err)
+	}
+	token, _ := msg.Uint64(core.TagToken)
+	payload, _ = core.EncodeControl(core.NewPathResponse(token))
+	hdr.PayloadLen = uint16(len(payload))
+	if _, err := UDPSend(moved, hdr, payload, server.conn.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	stats = server.Stats()
+	if server.RemoteAddr().String() != moved.LocalAddr().String() || stats.Migrations != 1 || stats.PathState != PathValidated {
+		t.Fatalf("session did not migrate: %+v", stats)
+	}
+
+	// Неизвестный идентификатор с чужого адреса не принимается
+	payload, _ = core.EncodeControl(core.NewConnectionIDMessage(id + 1))
+	hdr.PayloadLen = uint16(len(payload))
+	if _, err := UDPSend(client, hdr, payload, server.conn.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := server.Recv(); err == nil {
+		t.Fatal("packet with unknown connection ID was accepted")
+	}
+}
+
+func TestFlushWaitsForACKs(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+
+	hdr := core.NewPacketHeader()
+	payload := []byte("data")
+	hdr.PayloadLen = uint16(len(payload))
+	for i := 0; i < 3; i++ {
+		if err := ctx.Send(hdr, payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = ctx.ProcessACK(1)
+
+	timeout, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	unacked, err := ctx.Flush(timeout)
+	if !errors.Is(err, context.DeadlineExceeded) || len(unacked) != 2 || unacked[0] != 0 || unacked[1] != 2 {
+		t.Fatalf("expected seq 0 and 2 unacked, got %v %v", unacked, err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		_ = ctx.ProcessACK(0)
+		_ = ctx.ProcessACK(2)
+	}()
+	wait, cancelWait := context.WithTimeout(context.Background(), time.Second)
+	defer cancelWait()
+	if unacked, err := ctx.Flush(wait); err != nil || unacked != nil {
+		t.Fatalf("Flush after ACKs: %v %v", unacked, err)
+	}
+}
+
+// dropConn теряет исходящую датаграмму с номером drop (с 1)
+type dropConn struct {
+	net.PacketConn
+	writes, drop int
+}
+
+func (c *dropConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.writes++
+	if c.writes == c.drop {
+		return len(p), nil
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func TestNACKRetransmitsGap(t *testing.T) {
+	sender, peer := newLoopbackContext(t)
+	local := sender.conn
+	sender.conn = &dropConn{PacketConn: local, drop: 2}
+
+	receiver, err := NewReliableContext(peer, local.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	receiver.SetNACK(true)
+
+	for i := 0; i < 3; i++ {
+		hdr := core.NewPacketHeader()
+		hdr.Proto = core.ProtoUDP
+		hdr.PayloadLen = 1
+		if err := sender.Send(hdr, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_ = local.SetReadDeadline(time.Now().Add(2 * time.Second))
+	recv := func() uint32 {
+		hdr, _, err := receiver.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hdr.Seq
+	}
+	if seq := recv(); seq != 0 {
+		t.Fatalf("first packet seq %d", seq)
+	}
+	if seq := recv(); seq != 2 {
+		t.Fatalf("second packet seq %d", seq)
+	}
+
+	// Отправитель получает NACK и сразу повторяет пакет 1, без ProcessTimeouts
+	for {
+		hdr, payload, err := sender.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := nackControl(hdr, payload); ok {
+			break
+		}
+	}
+	if seq := recv(); seq != 1 {
+		t.Fatalf("retransmitted packet seq %d", seq)
+	}
+}
+
+func TestOrderedPartialReliability(t *testing.T) {
+	sender, peer := newLoopbackContext(t)
+	local := sender.conn
+	// Теряется надёжный пакет 1 (третья датаграмма)
+	sender.conn = &dropConn{PacketConn: local, drop: 3}
+
+	receiver, err := NewReliableContext(peer, local.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	receiver.SetOrdered(true)
+
+	send := func(reliable bool, data string) {
+		hdr := core.NewPacketHeader()
+		hdr.Proto = core.ProtoUDP
+		hdr.PayloadLen = uint16(len(data))
+		if reliable {
+			err = sender.Send(hdr, []byte(data))
+		} else {
+			err = sender.SendUnreliable(hdr, []byte(data))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	send(true, "r0")
+	send(false, "u0")
+	send(true, "r1")
+	send(false, "u1")
+	send(true, "r2")
+
+	_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	recv := func() string {
+		for {
+			_, payload, err := receiver.Recv()
+			if errors.Is(err, errPacketHeld) {
+				continue
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(payload)
+		}
+	}
+	if got := recv(); got != "r0" {
+		t.Fatalf("first payload %q", got)
+	}
+	if got := recv(); got != "u0" {
+		t.Fatalf("second payload %q", got)
+	}
+	// u1 и r2 ждут ретрансмиссии r1
+	if _, _, err := receiver.Recv(); !errors.Is(err, errPacketHeld) {
+		t.Fatalf("expected held packet, got %v", err)
+	}
+	if _, _, err := receiver.Recv(); !errors.Is(err, errPacketHeld) {
+		t.Fatalf("expected held packet, got %v", err)
+	}
+
+	sender.sendWindow[sender.getWindowIndex(1)].SentAt = time.Now().Add(-time.Hour)
+	if n, err := sender.ProcessTimeouts(); err != nil || n != 1 {
+		t.Fatalf("ProcessTimeouts: %d %v", n, err)
+	}
+	for _, want := range []string{"r1", "u1", "r2"} {
+		if got := recv(); got != want {
+			t.Fatalf("expected %q, got %q", want, got)
+		}
+	}
+
+	// Ненадёжный пакет, отправленный до r2, опоздал
+	hdr := core.NewPacketHeader()
+	hdr.Proto = core.ProtoUDP
+	hdr.Flags = core.FlagOrdered
+	hdr.Seq = 2
+	hdr.PayloadLen = 4
+	late, err := core.Serialize(hdr, []byte("late"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := local.WriteTo(late, peer.LocalAddr()); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := receiver.Recv(); !errors.Is(err, errPacketLate) {
+		t.Fatalf("expected late packet, got %v", err)
+	}
+	if stats := receiver.Stats(); stats.LateDropped != 1 {
+		t.Fatalf("LateDropped = %d", stats.LateDropped)
+	}
+}
+
+// TestSequenceWraparound проводит номера пакетов через 0xFFFFFFFF
+func TestSequenceWraparound(t *testing.T) {
+	const start = uint32(0xFFFFFFFE)
+
+	sender, peer := newLoopbackContext(t)
+	sender.sendBase, sender.nextSeq = start, start
+
+	receiver, err := NewReliableContext(peer, sender.conn.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	receiver.recvBase, receiver.recvHighest = start, start
+
+	for i := 0; i < 3; i++ {
+		hdr := core.NewPacketHeader()
+		hdr.Proto = core.ProtoUDP
+		hdr.PayloadLen = 1
+		if err := sender.Send(hdr, []byte{byte(i)}); err != nil {
+			t.Fatalf("Send %d failed: %v", i, err)
+		}
+	}
+	if sender.nextSeq != 1 {
+		t.Fatalf("nextSeq = %#x, expected 1", sender.nextSeq)
+	}
+	for _, seq := range []uint32{start, 0xFFFFFFFF, 0} {
+		if !sender.isInSendWindow(seq) {
+			t.Fatalf("seq %#x outside send window", seq)
+		}
+	}
+
+	_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for _, want := range []uint32{start, 0xFFFFFFFF, 0} {
+		hdr, _, err := receiver.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.Seq != want {
+			t.Fatalf("received seq %#x, expected %#x", hdr.Seq, want)
+		}
+	}
+	if receiver.recvBase != 1 {
+		t.Fatalf("recvBase = %#x, expected 1", receiver.recvBase)
+	}
+
+	// Все три пакета ретранслируются, включая номера по обе стороны от 0
+	for seq := start; seq != 1; seq++ {
+		sender.sendWindow[sender.getWindowIndex(seq)].SentAt = time.Now().Add(-time.Hour)
+	}
+	if n, err := sender.ProcessTimeouts(); err != nil || n != 3 {
+		t.Fatalf("ProcessTimeouts: %d %v", n, err)
+	}
+	// Повторы уже доставлены и лежат вне окна приёма
+	for i := 0; i < 3; i++ {
+		if _, _, err := receiver.Recv(); err == nil {
+			t.Fatal("retransmitted packet delivered twice")
+		}
+	}
+
+	for seq := start; seq != 1; seq++ {
+		if err := sender.ProcessACK(seq); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sender.sendBase != 1 || sender.Stats().InFlight != 0 {
+		t.Fatalf("send window not advanced: sendBase %#x, in flight %d",
+			sender.sendBase, sender.Stats().InFlight)
+	}
+}
+
+func TestMaxReorderBufferClosesSession(t *testing.T) {
+	sender, peer := newLoopbackContext(t)
+	local := sender.conn
+	// Пакет 0 теряется, последующие ждут его у получателя
+	sender.conn = &dropConn{PacketConn: local, drop: 1}
+
+	receiver, err := NewReliableContext(peer, local.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer receiver.Close()
+	receiver.SetOrdered(true)
+	receiver.SetMaxReorderBuffer(15)
+
+	for i := 0; i < 3; i++ {
+		hdr := core.NewPacketHeader()
+		hdr.Proto = core.ProtoUDP
+		hdr.PayloadLen = 10
+		if err := sender.Send(hdr, make([]byte, 10)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := receiver.Recv(); !errors.Is(err, errPacketHeld) {
+		t.Fatalf("expected held packet, got %v", err)
+	}
+	if stats := receiver.Stats(); stats.ReorderBytes != 10 {
+		t.Fatalf("ReorderBytes = %d", stats.ReorderBytes)
+	}
+	if _, _, err := receiver.Recv(); !errors.Is(err, ErrReorderBufferFull) {
+		t.Fatalf("expected ErrReorderBufferFull, got %v", err)
+	}
+	if err := receiver.Send(core.NewPacketHeader(), nil); !errors.Is(err, ErrSessionClosed) {
+		t.Fatalf("session not closed: %v", err)
+	}
+}
+
+func TestReliableSessionOpcodeHandlers(t *testing.T) {
+	listen := func() *net.UDPConn {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+	connA, connB := listen(), listen()
+
+	a, err := NewReliableSession(connA, connB.LocalAddr().(*net.UDPAddr), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := NewReliableSession(connB, connA.LocalAddr().(*net.UDPAddr), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	const opStatus = 0x20
+	status := make(chan string, 1)
+	b.Handle(opStatus, func(hdr *core.PacketHeader, payload []byte) {
+		status <- string(payload)
+	})
+	pong := make(chan string, 1)
+	a.Handle(core.OpPong, func(hdr *core.PacketHeader, payload []byte) {
+		pong <- string(payload)
+	})
+
+	c, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := a.SendOpcode(c, opStatus, []byte("status")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SendOpcode(c, core.OpPing, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Send([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Recv получает только данные: статус и ping обработаны сессией
+	data, err := b.Recv()
+	if err != nil || string(data) != "data" {
+		t.Fatalf("Recv: %q %v", data, err)
+	}
+	for _, ch := range []chan string{status, pong} {
+		select {
+		case got := <-ch:
+			if got != "status" && got != "ping" {
+				t.Fatalf("handler got %q", got)
+			}
+		case <-c.Done():
+			t.Fatal("handler was not called")
+		}
+	}
+}
+
+// blackholeConn теряет все исходящие датаграммы
+type blackholeConn struct {
+	net.PacketConn
+}
+
+func (c *blackholeConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	return len(p), nil
+}
+
+func TestDeliveryFailureMarksPeerDead(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+	ctx.conn = &blackholeConn{PacketConn: ctx.conn}
+	ctx.SetMaxRetries(1)
+	ctx.SetDeadPeerThreshold(2)
+
+	var failed []uint32
+	ctx.SetDeliveryFailureHandler(func(seq uint32, hdr *core.PacketHeader, payload []byte) {
+		if hdr.Seq != seq || len(payload) != 1 || payload[0] != byte(seq) {
+			t.Errorf("failure %d: header seq %d, payload %v", seq, hdr.Seq, payload)
+		}
+		failed = append(failed, seq)
+	})
+
+	for i := 0; i < 2; i++ {
+		hdr := core.NewPacketHeader()
+		hdr.Proto = core.ProtoUDP
+		hdr.PayloadLen = 1
+		if err := ctx.Send(hdr, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expire := func() {
+		for seq := uint32(0); seq < 2; seq++ {
+			ctx.sendWindow[ctx.getWindowIndex(seq)].SentAt = time.Now().Add(-time.Hour)
+		}
+	}
+
+	// Первый timeout - ретрансмиссия, второй исчерпывает попытки
+	expire()
+	if n, err := ctx.ProcessTimeouts(); err != nil || n != 2 {
+		t.Fatalf("ProcessTimeouts: %d %v", n, err)
+	}
+	if len(failed) != 0 || ctx.IsPeerDead() {
+		t.Fatalf("delivery failed before retries were exhausted: %v", failed)
+	}
+	expire()
+	if _, err := ctx.ProcessTimeouts(); !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("ProcessTimeouts: expected ErrPeerDead, got %v", err)
+	}
+	if len(failed) != 2 || failed[0] != 0 || failed[1] != 1 {
+		t.Fatalf("delivery failures for seqs %v, expected [0 1]", failed)
+	}
+	if !ctx.IsPeerDead() {
+		t.Fatal("peer not marked dead")
+	}
+	if err := ctx.Send(core.NewPacketHeader(), nil); !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("Send: expected ErrPeerDead, got %v", err)
+	}
+	if stats := ctx.Stats(); stats.InFlight != 0 {
+		t.Fatalf("failed packets still in flight: %d", stats.InFlight)
+	}
+}
+
+func TestReliableSessionShutsDownOnDeadPeer(t *testing.T) {
+	local, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	peer, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer peer.Close()
+
+	s, err := NewReliableSession(&blackholeConn{PacketConn: local}, peer.LocalAddr().(*net.UDPAddr), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if err := s.Context().SetRTOBounds(10, 20); err != nil {
+		t.Fatal(err)
+	}
+	s.Context().SetMaxRetries(2)
+	s.Context().SetDeadPeerThreshold(1)
+
+	if err := s.Send([]byte("lost")); err != nil {
+		t.Fatal(err)
+	}
+
+	recvErr := make(chan error, 1)
+	go func() {
+		_, err := s.Recv()
+		recvErr <- err
+	}()
+	select {
+	case err := <-recvErr:
+		if !errors.Is(err, ErrPeerDead) {
+			t.Fatalf("Recv: expected ErrPeerDead, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("session not closed after retries were exhausted")
+	}
+	if err := s.Err(); !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("Err: expected ErrPeerDead, got %v", err)
+	}
+	if err := s.Send([]byte("more")); !errors.Is(err, ErrPeerDead) {
+		t.Fatalf("Send after shutdown: expected ErrPeerDead, got %v", err)
+	}
+}
+
+// TestOrderedDeliveryHoldsPriorityPackets проверяет, что с SetOrdered
+// приоритетный пакет ждёт пропущенный, а без него выдаётся сразу
+func TestOrderedDeliveryHoldsPriorityPackets(t *testing.T) {
+	for _, ordered := range []bool{true, false} {
+		sender, peer := newLoopbackContext(t)
+		local := sender.conn
+		// Обычный пакет 0 теряется
+		sender.conn = &dropConn{PacketConn: local, drop: 1}
+
+		receiver, err := NewReliableContext(peer, local.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		receiver.SetOrdered(ordered)
+
+		for i, flags := range []uint8{0, core.FlagPriority} {
+			hdr := core.NewPacketHeader()
+			hdr.Proto = core.ProtoUDP
+			hdr.Flags = flags
+			hdr.PayloadLen = 1
+			if err := sender.Send(hdr, []byte{byte(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+		hdr, _, err := receiver.Recv()
+		if !ordered {
+			if err != nil || hdr.Seq != 1 || hdr.Flags&core.FlagPriority == 0 {
+				t.Fatalf("unordered: priority packet not delivered first: %+v %v", hdr, err)
+			}
+			receiver.Close()
+			continue
+		}
+		if !errors.Is(err, errPacketHeld) {
+			t.Fatalf("ordered: expected held priority packet, got %+v %v", hdr, err)
+		}
+
+		sender.sendWindow[sender.getWindowIndex(0)].SentAt = time.Now().Add(-time.Hour)
+		if n, err := sender.ProcessTimeouts(); err != nil || n != 1 {
+			t.Fatalf("ProcessTimeouts: %d %v", n, err)
+		}
+		for _, want := range []uint32{0, 1} {
+			hdr, _, err := receiver.Recv()
+			if err != nil || hdr.Seq != want {
+				t.Fatalf("ordered: expected seq %d, got %+v %v", want, hdr, err)
+			}
+		}
+		receiver.Close()
+	}
+}
+
+// seqConn запоминает Seq исходящих пакетов
+type seqConn struct {
+	net.PacketConn
+	seqs []uint32
+}
+
+func (c *seqConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	if hdr, err := core.ParseHeader(p); err == nil {
+		c.seqs = append(c.seqs, hdr.Seq)
+	}
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func TestPriorityBypassesCwndAndRetransmitsFirst(t *testing.T) {
+	ctx, _ := newLoopbackContext(t)
+	conn := &seqConn{PacketConn: ctx.conn}
+	ctx.conn = conn
+	if err := ctx.SetInitialWindow(2, 16); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(flags uint8) error {
+		hdr := core.NewPacketHeader()
+		hdr.Proto = core.ProtoUDP
+		hdr.Flags = flags
+		hdr.PayloadLen = 1
+		return ctx.Send(hdr, []byte{flags})
+	}
+	for i := 0; i < 2; i++ {
+		if err := send(0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// cwnd заполнен: обычный пакет не проходит, приоритетный отправляется
+	if err := send(0); !errors.Is(err, ErrSendWindowFull) {
+		t.Fatalf("expected ErrSendWindowFull, got %v", err)
+	}
+	if err := send(core.FlagPriority); err != nil {
+		t.Fatalf("priority packet blocked by cwnd: %v", err)
+	}
+
+	conn.seqs = nil
+	for seq := uint32(0); seq < 3; seq++ {
+		ctx.sendWindow[ctx.getWindowIndex(seq)].SentAt = time.Now().Add(-time.Hour)
+	}
+	if n, err := ctx.ProcessTimeouts(); err != nil || n != 3 {
+		t.Fatalf("ProcessTimeouts: %d %v", n, err)
+	}
+	if len(conn.seqs) != 3 || conn.seqs[0] != 2 || conn.seqs[1] != 0 || conn.seqs[2] != 1 {
+		t.Fatalf("retransmission order %v, expected [2 0 1]", conn.seqs)
+	}
+}
+
+func TestJitteredRTOWithinSpreadAndBounds(t *testing.T) {
+	SetRandSource(rand.New(rand.NewSource(1)))
+	defer SetRandSource(nil)
+
+	tests := []struct {
+		name             string
+		rto, minRTO      uint32
+		maxRTO, low, top uint32
+	}{
+		{"unclamped", 1000, 200, 60000, 750, 1250},
+		{"at min", 200, 200, 60000, 200, 250},
+		{"at max", 60000, 200, 60000, 45000, 60000},
+		{"below min", 100, 200, 60000, 200, 250},
+		{"above max", 90000, 200, 60000, 45000, 60000},
+		{"no spread", 3, 1, 100, 3, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, _ := newLoopbackContext(t)
+			if err := ctx.SetRTOBounds(tt.minRTO, tt.maxRTO); err != nil {
+				t.Fatal(err)
+			}
+			seen := make(map[uint32]bool)
+			for i := 0; i < 1000; i++ {
+				got := ctx.jitteredRTO(tt.rto)
+				if got < tt.low || got > tt.top {
+					t.Fatalf("jitteredRTO(%d) = %d, expected [%d, %d]", tt.rto, got, tt.low, tt.top)
+				}
+				seen[got] = true
+			}
+			if tt.low != tt.top && len(seen) < 2 {
+				t.Fatalf("jitteredRTO(%d) has no spread", tt.rto)
+			}
+		})
+	}
+}
+
+func TestKeepaliveOutsideWindowByDefault(t *testing.T) {
+	ctx, peer := newLoopbackContext(t)
+	if err := ctx.SetInitialWindow(1, 16); err != nil {
+		t.Fatal(err)
+	}
+	_ = peer.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	send := func(opcode uint8) error {
+		hdr := core.NewPacketHeader()
+		hdr.Opcode = opcode
+		hdr.Proto = core.ProtoUDP
+		hdr.PayloadLen = 1
+		return ctx.Send(hdr, []byte{opcode})
+	}
+	recv := func() *core.PacketHeader {
+		hdr, _, _, err := UDPRecv(peer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hdr
+	}
+
+	// Окно заполнено одним пакетом данных
+	if err := send(core.OpData); err != nil {
+		t.Fatal(err)
+	}
+	recv()
+	if err := send(core.OpData); !errors.Is(err, ErrSendWindowFull) {
+		t.Fatalf("expected ErrSendWindowFull, got %v", err)
+	}
+
+	// По умолчанию ping отправляется вне окна, даже когда оно заполнено
+	if err := send(core.OpPing); err != nil {
+		t.Fatalf("keepalive blocked by a full window: %v", err)
+	}
+	if hdr := recv(); hdr.Opcode != core.OpPing || hdr.Flags&core.FlagReliable != 0 {
+		t.Fatalf("keepalive sent as reliable: %+v", hdr)
+	}
+	if inFlight := ctx.Stats().InFlight; inFlight != 1 {
+		t.Fatalf("keepalive took a sequence number: %d in flight", inFlight)
+	}
+
+	// С SetReliableKeepalive ping занимает место в окне
+	ctx.SetReliableKeepalive(true)
+	if err := send(core.OpPing); !errors.Is(err, ErrSendWindowFull) {
+		t.Fatalf("reliable keepalive: expected ErrSendWindowFull, got %v", err)
+	}
+	if err := ctx.ProcessACK(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := send(core.OpPing); err != nil {
+		t.Fatal(err)
+	}
+	if hdr := recv(); hdr.Opcode != core.OpPing || hdr.Flags&core.FlagReliable == 0 || hdr.Seq != 1 {
+		t.Fatalf("reliable keepalive sent outside the window: %+v", hdr)
+	}
+	if inFlight := ctx.Stats().InFlight; inFlight != 1 {
+		t.Fatalf("reliable keepalive not in flight: %d", inFlight)
+	}
+}
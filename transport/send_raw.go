@@ -0,0 +1,84 @@
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// ErrInvalidRawPacket - данные для TCPSendRaw/UDPSendRaw не похожи на
+// сериализованный пакет: неверный Magic или длина не совпадает с PayloadLen
+var ErrInvalidRawPacket = errors.New("invalid raw packet")
+
+// checkRawPacket минимально проверяет сериализованный пакет: Magic и то,
+// что длина data равна заголовку, PayloadLen и CRC32. CRC32 и payload не
+// проверяются. Заголовок сравнивается после снятия маски Config.ObfuscationKey
+func checkRawPacket(data []byte) error {
+	if len(data) < core.HeaderSize+4 {
+		return ErrInvalidRawPacket
+	}
+	var header [core.HeaderSize]byte
+	copy(header[:], data)
+	maskHeader(header[:], currentConfig().ObfuscationKey)
+
+	if !core.IsOverProtoPacket(header[:]) {
+		return ErrInvalidRawPacket
+	}
+	payloadLen := int(binary.BigEndian.Uint16(header[18:20]))
+	if len(data) != core.HeaderSize+payloadLen+4 {
+		return ErrInvalidRawPacket
+	}
+	return nil
+}
+
+// TCPSendRaw отправляет уже сериализованный пакет (например, из TCPRecvRaw)
+// без повторной сериализации: байты, включая CRC32 и зашифрованный payload,
+// записываются как есть. Маска Config.ObfuscationKey не накладывается повторно
+func TCPSendRaw(conn net.Conn, data []byte) (int, error) {
+	if err := checkRawPacket(data); err != nil {
+		return 0, err
+	}
+
+	armed, err := startWrite(conn)
+	if err != nil {
+		return 0, err
+	}
+	n, err := conn.Write(data)
+	addBytesOut(n)
+	if err := finishWrite(conn, armed, err); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
+// UDPSendRaw отправляет уже сериализованный пакет (например, из UDPRecvRaw)
+// одной датаграммой без повторной сериализации
+// Если addr == nil, используется подключённый адрес, как в UDPSend
+func UDPSendRaw(conn net.PacketConn, data []byte, addr *net.UDPAddr) (int, error) {
+	if err := checkRawPacket(data); err != nil {
+		return 0, err
+	}
+
+	armed, err := startWrite(conn)
+	if err != nil {
+		return 0, err
+	}
+	var n int
+	if addr == nil {
+		w, ok := conn.(io.Writer)
+		if !ok {
+			return 0, errors.New("no destination address for unconnected socket")
+		}
+		n, err = w.Write(data)
+	} else {
+		n, err = conn.WriteTo(data, addr)
+	}
+	addBytesOut(n)
+	if err := finishWrite(conn, armed, err); err != nil {
+		return 0, wrapPeerError(err)
+	}
+	return n, nil
+}
@@ -0,0 +1,150 @@
+package transport
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+	"github.com/nickolajgrishuk/overproto-go/optimize"
+)
+
+// ConnStats - состояние отдельного TCP соединения
+type ConnStats struct {
+	ID           string       // Идентификатор соединения (см. TCPConnection.ID)
+	RemoteAddr   string       // Адрес удалённой стороны
+	RecvState    TCPRecvState // Текущее состояние state machine приёма
+	LastActivity time.Time    // Последний приём или отправка данных (см. CloseIdle)
+}
+
+// SessionStats - состояние отдельной надёжной UDP сессии
+type SessionStats struct {
+	ID           string    // Идентификатор сессии (см. ReliableContext.ID)
+	RemoteAddr   string    // Адрес удалённой стороны
+	InFlight     uint32    // Отправленные, но не подтверждённые пакеты
+	DeliveryRate uint64    // Оценка скорости доставки (байт/с), см. BandwidthEstimate
+	Migrations   uint64    // Количество смен адреса удалённой стороны (см. EnableMigration)
+	PathState    PathState // Идёт ли проверка нового адреса удалённой стороны
+	PendingAddr  string    // Проверяемый адрес (пусто, если проверки нет)
+	LateDropped  uint64    // Отброшено опоздавших ненадёжных пакетов (см. SetOrdered)
+	ReorderBytes int       // Байт payload, ожидающих пропущенных пакетов (см. SetMaxReorderBuffer)
+}
+
+// Stats - снимок состояния транспортного уровня
+type Stats struct {
+	ActiveTCPConnections   int            // Количество активных TCP соединений
+	ActiveReliableSessions int            // Количество активных надёжных UDP сессий
+	BytesIn                uint64         // Всего принято байт (TCP + UDP)
+	BytesOut               uint64         // Всего отправлено байт (TCP + UDP)
+	ForeignPacketsDropped  uint64         // Отброшено датаграмм, не являющихся OverProto
+	AcceptedConnections    int            // Открытые соединения в лимите Config.MaxConnections
+	MaxConnections         int            // Лимит принятых соединений (0 - без ограничения)
+	RefusedConnections     uint64         // Соединений закрыто из-за лимита или Drain
+	Draining               bool           // Включён режим Drain
+	Connections            []ConnStats    // Состояние каждого TCP соединения
+	Sessions               []SessionStats // Состояние каждой надёжной сессии
+
+	Compression optimize.CompressionStats // Статистика автоматической компрессии
+	Reassembly  core.ReassemblyStats      // Использование лимитов сборки фрагментов
+}
+
+var (
+	// bytesIn - счётчик принятых байт
+	bytesIn atomic.Uint64
+	// bytesOut - счётчик отправленных байт
+	bytesOut atomic.Uint64
+	// foreignDropped - счётчик отброшенных посторонних датаграмм
+	foreignDropped atomic.Uint64
+
+	// tcpConns - реестр активных TCP соединений
+	tcpConns = make(map[*TCPConnection]struct{})
+	// reliableSessions - реестр активных надёжных сессий
+	reliableSessions = make(map[*ReliableContext]struct{})
+	// registryMu - мьютекс для реестров
+	registryMu sync.Mutex
+)
+
+// addBytesIn учитывает принятые байты
+func addBytesIn(n int) {
+	if n > 0 {
+		bytesIn.Add(uint64(n))
+	}
+}
+
+// addBytesOut учитывает отправленные байты
+func addBytesOut(n int) {
+	if n > 0 {
+		bytesOut.Add(uint64(n))
+	}
+}
+
+// trackTCPConnection добавляет соединение в реестр
+func trackTCPConnection(conn *TCPConnection) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	tcpConns[conn] = struct{}{}
+}
+
+// untrackTCPConnection удаляет соединение из реестра
+// Возвращает false, если соединения в реестре уже не было
+func untrackTCPConnection(conn *TCPConnection) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	_, ok := tcpConns[conn]
+	delete(tcpConns, conn)
+	return ok
+}
+
+// trackReliableSession добавляет надёжную сессию в реестр
+func trackReliableSession(ctx *ReliableContext) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	reliableSessions[ctx] = struct{}{}
+}
+
+// untrackReliableSession удаляет надёжную сессию из реестра
+func untrackReliableSession(ctx *ReliableContext) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(reliableSessions, ctx)
+}
+
+// GetStats возвращает снимок состояния транспортного уровня
+// Thread-safe
+func GetStats() Stats {
+	registryMu.Lock()
+	conns := make([]*TCPConnection, 0, len(tcpConns))
+	for conn := range tcpConns {
+		conns = append(conns, conn)
+	}
+	sessions := make([]*ReliableContext, 0, len(reliableSessions))
+	for ctx := range reliableSessions {
+		sessions = append(sessions, ctx)
+	}
+	registryMu.Unlock()
+
+	stats := Stats{
+		ActiveTCPConnections:   len(conns),
+		ActiveReliableSessions: len(sessions),
+		BytesIn:                bytesIn.Load(),
+		BytesOut:               bytesOut.Load(),
+		ForeignPacketsDropped:  foreignDropped.Load(),
+		AcceptedConnections:    int(acceptedConns.Load()),
+		MaxConnections:         currentConfig().MaxConnections,
+		RefusedConnections:     refusedConns.Load(),
+		Draining:               draining.Load(),
+		Connections:            make([]ConnStats, 0, len(conns)),
+		Sessions:               make([]SessionStats, 0, len(sessions)),
+		Compression:            optimize.GetCompressionStats(),
+		Reassembly:             core.GetReassemblyStats(),
+	}
+
+	for _, conn := range conns {
+		stats.Connections = append(stats.Connections, conn.Stats())
+	}
+	for _, ctx := range sessions {
+		stats.Sessions = append(stats.Sessions, ctx.Stats())
+	}
+
+	return stats
+}
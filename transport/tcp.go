@@ -1,16 +1,19 @@
 package transport
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
 	"github.com/nickolajgrishuk/overproto-go/core"
+	"github.com/nickolajgrishuk/overproto-go/optimize"
 )
 
 // TCPRecvState - состояние state machine для приёма TCP пакетов
@@ -31,17 +34,48 @@ const (
 
 // TCPConnection - TCP соединение с state machine для приёма
 type TCPConnection struct {
+	id            string // Короткий идентификатор для журналов (см. ID)
 	fd            net.Conn
+	activity      *activityConn // fd для ввода-вывода библиотеки, отмечающий время последнего обмена (см. CloseIdle)
+	reader        *bufio.Reader // Буферизованное чтение: один Read может принести несколько пакетов
 	recvState     TCPRecvState
 	recvBuffer    []byte
 	recvBytesRead uint
 	mu            sync.Mutex
+
+	// stateSnapshot - копия recvState для чтения без блокировки (статистика)
+	stateSnapshot atomic.Int32
+	// closed - вызван Close или соединение закрыто CloseIdle
+	closed atomic.Bool
+
+	// Потоковая компрессия (см. EnableStreamCompression)
+	compressor   *optimize.StreamCompressor   // Защищён sendMu
+	decompressor *optimize.StreamDecompressor // Защищён mu
+	sendMu       sync.Mutex
+
+	// userData - данные пользователя (см. SetUserData)
+	userData userData
+	// auth - проверка первого пакета (см. SetAuthFunc)
+	auth authGate
+	// Обработчик обрыва, обнаруженного keepalive (см. SetKeepAliveFailFunc)
+	keepAliveFn     atomic.Pointer[KeepAliveFailFunc]
+	keepAliveFailed atomic.Bool
+
+	// Потоковая проверка CRC32 принимаемого пакета (защищены mu)
+	recvHeader *core.PacketHeader // Заголовок, разобранный в StateReadingHeader
+	recvCRC    *core.CRC32Context // CRC32, обновляемый по мере чтения
+	recvRaw    []byte             // Сериализованный последний принятый пакет (см. TCPRecvRaw)
+	peeked     *peekedPacket      // Принятый, но ещё не выданный пакет (см. Peek)
 }
 
 const (
 	// TCPRecvBufferSize - размер буфера для приёма (64KB)
 	TCPRecvBufferSize = 64 * 1024
+	// tcpCRCChunkSize - размер части payload, после чтения которой обновляется CRC32
+	tcpCRCChunkSize = 16 * 1024
 	// TCPBacklog - backlog для listen
+	// Deprecated: не применяется; размер очереди задаётся Config.Backlog,
+	// по умолчанию используется системный максимум
 	TCPBacklog = 10
 )
 
@@ -49,14 +83,7 @@ const (
 // Устанавливает SO_REUSEADDR
 func TCPListen(port uint16) (net.Listener, error) {
 	lc := net.ListenConfig{
-		Control: func(network, address string, c syscall.RawConn) error {
-			var err error
-			_ = c.Control(func(fd uintptr) {
-				// Устанавливаем SO_REUSEADDR
-				err = setSockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
-			})
-			return err
-		},
+		Control: listenControl,
 	}
 
 	addr := &net.TCPAddr{
@@ -64,47 +91,141 @@ func TCPListen(port uint16) (net.Listener, error) {
 		Port: int(port),
 	}
 
-	return lc.Listen(context.Background(), "tcp", addr.String())
+	listener, err := lc.Listen(context.Background(), "tcp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+	if err := applyBacklog(listener); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	trackOwned(listener)
+
+	return listener, nil
+}
+
+// applyBacklog устанавливает размер очереди входящих соединений из Config.Backlog
+// net.ListenConfig не позволяет задать backlog, поэтому listen вызывается повторно;
+// ядро ограничивает значение системным максимумом
+func applyBacklog(listener net.Listener) error {
+	backlog := currentConfig().Backlog
+	if backlog < 0 {
+		return errors.New("invalid backlog (must not be negative)")
+	}
+	if backlog == 0 {
+		return nil
+	}
+
+	tcpListener, ok := listener.(*net.TCPListener)
+	if !ok {
+		return nil
+	}
+	rawConn, err := tcpListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var listenErr error
+	ctrlErr := rawConn.Control(func(fd uintptr) {
+		listenErr = relisten(fd, backlog)
+	})
+	if ctrlErr != nil {
+		return ctrlErr
+	}
+	return listenErr
 }
 
 // TCPAccept принимает соединение
+// При Config.MaxConnections > 0 соединения сверх лимита получают ControlClose
+// с кодом ConnLimitCloseCode и закрываются, а TCPAccept ждёт следующего
+// (так же в режиме Drain - с кодом GoingAwayCloseCode);
+// принятое соединение занимает место в лимите до вызова Close
+// Соединение, на котором не удалось включить keepalive (например, уже
+// сброшенное клиентом), закрывается, и TCPAccept ждёт следующего
 func TCPAccept(listener net.Listener) (net.Conn, error) {
-	return listener.Accept()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		admitted := admitConn(conn)
+		if admitted == nil {
+			continue
+		}
+		if err := applyKeepAlive(conn); err != nil {
+			// Ошибка касается только этого соединения, а не слушателя
+			_ = admitted.Close()
+			continue
+		}
+		trackOwned(admitted)
+
+		return admitted, nil
+	}
 }
 
 // TCPConnect подключается к TCP серверу
 func TCPConnect(host string, port uint16) (net.Conn, error) {
 	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	return net.DialTimeout("tcp", addr, 10*time.Second)
+	dialer := net.Dialer{
+		Timeout: 10 * time.Second,
+		Control: dialControl,
+	}
+	conn, err := dialer.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	if err := applyKeepAlive(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	trackOwned(conn)
+
+	return conn, nil
 }
 
 // NewTCPConnection создаёт новое TCP соединение с state machine
+// Соединение регистрируется для статистики до вызова Close или получения EOF
 func NewTCPConnection(conn net.Conn) *TCPConnection {
-	return &TCPConnection{
+	activity := newActivityConn(conn)
+	tcpConn := &TCPConnection{
+		id:            newConnID(),
 		fd:            conn,
+		activity:      activity,
+		reader:        bufio.NewReaderSize(activity, TCPRecvBufferSize),
 		recvState:     StateIdle,
-		recvBuffer:    make([]byte, TCPRecvBufferSize),
+		recvBuffer:    make([]byte, TCPRecvBufferSize), // Переиспользуется для всех пакетов
 		recvBytesRead: 0,
+		recvCRC:       core.NewCRC32(),
 	}
+	trackTCPConnection(tcpConn)
+	return tcpConn
 }
 
-// readExact читает точное количество байт (гарантированное чтение)
-func (conn *TCPConnection) readExact(buf []byte) error {
-	totalRead := 0
-	for totalRead < len(buf) {
-		n, err := conn.fd.Read(buf[totalRead:])
-		if err != nil {
-			if err == io.EOF {
-				return io.EOF
-			}
-			return err
-		}
-		if n == 0 {
-			return io.EOF
-		}
-		totalRead += n
+// ID возвращает короткий идентификатор соединения (8 hex символов)
+// Ошибки приёма соединения, кроме io.EOF, оборачиваются в ConnError с этим ID
+func (conn *TCPConnection) ID() string {
+	return conn.id
+}
+
+// Close закрывает соединение и удаляет его из статистики
+func (conn *TCPConnection) Close() error {
+	conn.closed.Store(true)
+	untrackTCPConnection(conn)
+	return conn.fd.Close()
+}
+
+// Stats возвращает снимок состояния соединения
+// Не блокируется, даже если TCPRecv ожидает данные
+func (conn *TCPConnection) Stats() ConnStats {
+	stats := ConnStats{
+		ID:           conn.id,
+		RecvState:    TCPRecvState(conn.stateSnapshot.Load()),
+		LastActivity: conn.LastActivity(),
+	}
+	if addr := conn.fd.RemoteAddr(); addr != nil {
+		stats.RemoteAddr = addr.String()
 	}
-	return nil
+	return stats
 }
 
 // TCPRecv принимает пакет через TCP
@@ -114,11 +235,144 @@ func TCPRecv(conn *TCPConnection) (*core.PacketHeader, []byte, error) {
 	conn.mu.Lock()
 	defer conn.mu.Unlock()
 
+	hdr, payload, err := conn.nextLocked(false)
+	if err != nil {
+		return nil, nil, wrapConnError(conn.id, err)
+	}
+	return hdr, conn.detachPayload(payload), nil
+}
+
+// TCPRecvInto принимает пакет как TCPRecv, но записывает payload в buf
+// (предыдущее содержимое buf сбрасывается)
+// Буфер вызывающего переиспользуется между пакетами, поэтому при
+// повторных вызовах с одним buf приём не выделяет память под payload
+func TCPRecvInto(conn *TCPConnection, buf *bytes.Buffer) (*core.PacketHeader, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	hdr, payload, err := conn.nextLocked(false)
+	if err != nil {
+		return nil, wrapConnError(conn.id, err)
+	}
+	buf.Reset()
+	buf.Write(payload)
+	return hdr, nil
+}
+
+// TCPRecvRaw принимает пакет как TCPRecv и дополнительно возвращает его
+// сериализованные байты без изменений (заголовок, payload и CRC32 как на проводе)
+// Подходит для ретрансляции пакета без повторной сериализации, в том числе
+// с зашифрованным payload или неизвестными флагами
+// raw и payload разделяют память; при потоковой компрессии raw содержит сжатый сегмент
+func TCPRecvRaw(conn *TCPConnection) (*core.PacketHeader, []byte, []byte, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	hdr, payload, err := conn.nextLocked(false)
+	raw := conn.recvRaw
+	conn.recvRaw = nil
+	if err != nil {
+		return nil, nil, nil, wrapConnError(conn.id, err)
+	}
+	// recvBuffer переиспользуется: копируем пакет целиком,
+	// payload без потоковой компрессии указывает в копию
+	raw = append([]byte(nil), raw...)
+	maskHeader(raw, currentConfig().ObfuscationKey)
+	if conn.payloadInBuffer(payload) {
+		payload = raw[core.HeaderSize : core.HeaderSize+len(payload)]
+	}
+	return hdr, payload, raw, nil
+}
+
+// RecvAll возвращает все полностью принятые пакеты, уже находящиеся в буфере,
+// без дополнительных чтений из сокета
+// Если готовых пакетов нет, возвращает пустой срез без ошибки
+func (conn *TCPConnection) RecvAll() ([]core.Packet, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	packets := make([]core.Packet, 0)
+	for conn.packetBuffered() {
+		hdr, payload, err := conn.nextLocked(true)
+		if err != nil {
+			return packets, wrapConnError(conn.id, err)
+		}
+		if hdr == nil {
+			break
+		}
+		packets = append(packets, core.Packet{Header: hdr, Payload: conn.detachPayload(payload)})
+	}
+
+	return packets, nil
+}
+
+// packetBuffered проверяет, находится ли следующий пакет в буфере целиком
+func (conn *TCPConnection) packetBuffered() bool {
+	if conn.peeked != nil {
+		return true
+	}
+	if conn.recvState != StateIdle || conn.reader.Buffered() < core.HeaderSize {
+		return false
+	}
+	header, err := conn.reader.Peek(core.HeaderSize)
+	if err != nil {
+		return false
+	}
+	var lenBytes [2]byte
+	copy(lenBytes[:], header[18:20])
+	if key := currentConfig().ObfuscationKey; len(key) > 0 {
+		lenBytes[0] ^= key[18%len(key)]
+		lenBytes[1] ^= key[19%len(key)]
+	}
+	payloadLen := binary.BigEndian.Uint16(lenBytes[:])
+	return conn.reader.Buffered() >= core.HeaderSize+int(payloadLen)+4
+}
+
+// growRecvBuffer обеспечивает ёмкость recvBuffer не меньше size
+// Буфер только растёт: заголовок копируется в новый буфер, ёмкость
+// не уменьшается после больших пакетов
+func (conn *TCPConnection) growRecvBuffer(size int) {
+	if size <= cap(conn.recvBuffer) {
+		conn.recvBuffer = conn.recvBuffer[:cap(conn.recvBuffer)]
+		return
+	}
+	newBuf := make([]byte, size)
+	copy(newBuf, conn.recvBuffer[:core.HeaderSize])
+	conn.recvBuffer = newBuf
+}
+
+// payloadInBuffer проверяет, указывает ли payload в recvBuffer
+// (payload после потоковой декомпрессии находится в отдельной памяти)
+func (conn *TCPConnection) payloadInBuffer(payload []byte) bool {
+	return len(payload) > 0 && len(conn.recvBuffer) > core.HeaderSize &&
+		&payload[0] == &conn.recvBuffer[core.HeaderSize]
+}
+
+// detachPayload копирует payload из recvBuffer, чтобы следующий пакет
+// не перезаписал данные, уже возвращённые вызывающему
+func (conn *TCPConnection) detachPayload(payload []byte) []byte {
+	if !conn.payloadInBuffer(payload) {
+		return payload
+	}
+	return append([]byte(nil), payload...)
+}
+
+// recvLocked реализует state machine приёма
+// Возвращаемый payload может указывать в recvBuffer и действителен
+// только до следующего приёма (см. detachPayload)
+// Вызывается с захваченным conn.mu
+func (conn *TCPConnection) recvLocked() (*core.PacketHeader, []byte, error) {
+	defer func() {
+		conn.stateSnapshot.Store(int32(conn.recvState))
+	}()
+
 	for {
+		conn.stateSnapshot.Store(int32(conn.recvState))
 		switch conn.recvState {
 		case StateIdle:
-			// Начинаем чтение заголовка
-			conn.recvBuffer = make([]byte, core.HeaderSize)
+			// Начинаем чтение заголовка в уже выделенный буфер:
+			// ёмкость, выросшая на больших пакетах, сохраняется
+			conn.growRecvBuffer(core.HeaderSize)
 			conn.recvBytesRead = 0
 			conn.recvState = StateReadingHeader
 
@@ -135,24 +389,34 @@ func TCPRecv(conn *TCPConnection) (*core.PacketHeader, []byte, error) {
 			}
 			remaining := core.HeaderSize - recvBytesReadInt
 			if remaining > 0 {
-				err := conn.readExact(conn.recvBuffer[recvBytesReadInt:core.HeaderSize])
+				n, err := conn.readExact(conn.recvBuffer[recvBytesReadInt:core.HeaderSize])
 				if err != nil {
-					conn.recvState = StateIdle
-					return nil, nil, err
+					return nil, nil, conn.readFailedLocked(err, recvBytesReadInt+n)
 				}
 				conn.recvBytesRead = core.HeaderSize
+				maskHeader(conn.recvBuffer[:core.HeaderSize], currentConfig().ObfuscationKey)
+			}
+
+			// Проверяем заголовок сразу, не дожидаясь payload
+			hdr, err := core.ParseHeader(conn.recvBuffer[:core.HeaderSize])
+			if err != nil {
+				conn.recvState = StateIdle
+				return nil, nil, err
+			}
+			conn.recvHeader = hdr
+
+			// CRC32 вычисляется по мере чтения (заголовок из буфера, где crc32 = 0)
+			conn.recvCRC.Reset()
+			if core.GetCRCScope() == core.CRCHeaderAndPayload && !core.SkipsCRC(hdr.Opcode) {
+				conn.recvCRC.Update(conn.recvBuffer[:core.HeaderSize])
 			}
 
 			// Извлекаем payload_len из заголовка
-			payloadLen := uint16(conn.recvBuffer[18])<<8 | uint16(conn.recvBuffer[19])
+			payloadLen := hdr.PayloadLen
 			totalSize := core.HeaderSize + int(payloadLen) + 4 // Header + Payload + CRC32
 
-			// Расширяем буфер если нужно
-			if totalSize > len(conn.recvBuffer) {
-				newBuf := make([]byte, totalSize)
-				copy(newBuf, conn.recvBuffer[:core.HeaderSize])
-				conn.recvBuffer = newBuf
-			}
+			// Расширяем буфер, только если пакет не помещается в его ёмкость
+			conn.growRecvBuffer(totalSize)
 
 			conn.recvState = StateReadingPayload
 			conn.recvBytesRead = core.HeaderSize
@@ -172,20 +436,32 @@ func TCPRecv(conn *TCPConnection) (*core.PacketHeader, []byte, error) {
 				conn.recvState = StateIdle
 				return nil, nil, errors.New("invalid recvBytesRead")
 			}
-			remaining := payloadEnd - recvBytesReadInt
-			if remaining > 0 {
-				err := conn.readExact(conn.recvBuffer[recvBytesReadInt:payloadEnd])
-				if err != nil {
-					conn.recvState = StateIdle
-					return nil, nil, err
+			// Читаем payload частями и сразу обновляем CRC32,
+			// чтобы не проходить по буферу второй раз
+			for recvBytesReadInt < payloadEnd {
+				chunkEnd := recvBytesReadInt + tcpCRCChunkSize
+				if chunkEnd > payloadEnd {
+					chunkEnd = payloadEnd
 				}
-				payloadEndUint, err := core.SafeIntToUint(payloadEnd)
-				if err != nil {
-					conn.recvState = StateIdle
-					return nil, nil, errors.New("payload end too large")
+				chunk := conn.recvBuffer[recvBytesReadInt:chunkEnd]
+				if n, err := conn.readExact(chunk); err != nil {
+					// Принятая часть учитывается в CRC32, чтобы продолжить с неё
+					if errors.Is(err, ErrRecvTimeout) && !core.SkipsCRC(conn.recvHeader.Opcode) {
+						conn.recvCRC.Update(chunk[:n])
+					}
+					return nil, nil, conn.readFailedLocked(err, recvBytesReadInt+n)
 				}
-				conn.recvBytesRead = payloadEndUint
+				if !core.SkipsCRC(conn.recvHeader.Opcode) {
+					conn.recvCRC.Update(chunk)
+				}
+				recvBytesReadInt = chunkEnd
 			}
+			payloadEndUint, err := core.SafeIntToUint(payloadEnd)
+			if err != nil {
+				conn.recvState = StateIdle
+				return nil, nil, errors.New("payload end too large")
+			}
+			conn.recvBytesRead = payloadEndUint
 
 			conn.recvState = StateReadingCRC
 
@@ -206,10 +482,9 @@ func TCPRecv(conn *TCPConnection) (*core.PacketHeader, []byte, error) {
 			}
 			remaining := crcEnd - recvBytesReadInt
 			if remaining > 0 {
-				err := conn.readExact(conn.recvBuffer[recvBytesReadInt:crcEnd])
+				n, err := conn.readExact(conn.recvBuffer[recvBytesReadInt:crcEnd])
 				if err != nil {
-					conn.recvState = StateIdle
-					return nil, nil, err
+					return nil, nil, conn.readFailedLocked(err, recvBytesReadInt+n)
 				}
 				crcEndUint, err := core.SafeIntToUint(crcEnd)
 				if err != nil {
@@ -222,18 +497,48 @@ func TCPRecv(conn *TCPConnection) (*core.PacketHeader, []byte, error) {
 			conn.recvState = StateReady
 
 		case StateReady:
-			// Десериализуем пакет
-			packetData := conn.recvBuffer[:conn.recvBytesRead]
-			hdr, payload, err := core.Deserialize(packetData)
-			if err != nil {
+			// Проверяем CRC32, накопленный при чтении
+			hdr := conn.recvHeader
+			payloadEnd := core.HeaderSize + int(hdr.PayloadLen)
+			crc32Received := binary.BigEndian.Uint32(conn.recvBuffer[payloadEnd : payloadEnd+4])
+			if !core.SkipsCRC(hdr.Opcode) && crc32Received != conn.recvCRC.Final() {
 				conn.recvState = StateIdle
-				return nil, nil, err
+				return nil, nil, core.ErrCRCMismatch
 			}
+			core.CountDecoded(payloadEnd + 4)
+			// payload указывает в recvBuffer; копирование - в вызывающих функциях
+			payload := conn.recvBuffer[core.HeaderSize:payloadEnd]
+			conn.recvRaw = conn.recvBuffer[:payloadEnd+4]
+			conn.recvHeader = nil
 
 			// Сбрасываем состояние
 			conn.recvState = StateIdle
 			conn.recvBytesRead = 0
 
+			// Пакет прочитан целиком, поэтому при несовпадении Proto
+			// соединение остаётся синхронизированным
+			if err := checkProto(hdr, core.ProtoTCP); err != nil {
+				return nil, nil, err
+			}
+
+			// Распаковываем сегмент потоковой компрессии, если она включена
+			payload, err := conn.inflateStream(hdr, payload)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			// Первый пакет проходит аутентификацию, иначе соединение закрывается
+			if err := conn.auth.check(hdr.StreamID, payload); err != nil {
+				_ = conn.Close()
+				return nil, nil, err
+			}
+
+			// Сброс словаря потоковой компрессии обрабатывается здесь;
+			// следующий пакет принимает recvPacketLocked
+			if conn.compressResetLocked(hdr, payload) {
+				return nil, nil, errCompressReset
+			}
+
 			return hdr, payload, nil
 		}
 	}
@@ -247,12 +552,18 @@ func TCPSend(conn net.Conn, hdr *core.PacketHeader, payload []byte) (int, error)
 	if err != nil {
 		return 0, err
 	}
+	maskHeader(data, currentConfig().ObfuscationKey)
 
-	// Отправляем данные
-	n, err := conn.Write(data)
+	// Отправляем данные (с дедлайном, если задан Config.WriteTimeout)
+	armed, err := startWrite(conn)
 	if err != nil {
 		return 0, err
 	}
+	n, err := conn.Write(data)
+	addBytesOut(n)
+	if err := finishWrite(conn, armed, err); err != nil {
+		return 0, err
+	}
 
 	return n, nil
 }
@@ -0,0 +1,74 @@
+package transport
+
+import (
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// peekedPacket - пакет, принятый Peek и ожидающий выдачи
+type peekedPacket struct {
+	hdr     *core.PacketHeader
+	payload []byte
+	raw     []byte // Пакет как на проводе (см. TCPRecvRaw)
+}
+
+// Peek принимает следующий пакет, не извлекая его: пакет остаётся
+// в соединении и будет возвращён следующим TCPRecv, TCPRecvInto, TCPRecvRaw
+// или RecvAll. Повторный Peek возвращает тот же пакет без чтения из сокета
+// Позволяет по заголовку решить, обрабатывать соединение здесь или
+// передать другому обработчику
+// Payload возвращается как принят (без DecodePayload) и разделяет память
+// с payload последующего приёма: изменять его нельзя
+// Ошибка приёма (например, core.ErrCRCMismatch) возвращается сразу,
+// и пакет не сохраняется
+func (conn *TCPConnection) Peek() (*core.PacketHeader, []byte, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	if conn.peeked == nil {
+		hdr, payload, err := conn.recvPacketLocked(false)
+		raw := conn.recvRaw
+		conn.recvRaw = nil
+		if err != nil {
+			return nil, nil, wrapConnError(conn.id, err)
+		}
+		// recvBuffer переиспользуется следующим приёмом: сохраняем копию
+		pkt := &peekedPacket{hdr: hdr, raw: append([]byte(nil), raw...)}
+		if conn.payloadInBuffer(payload) {
+			pkt.payload = pkt.raw[core.HeaderSize : core.HeaderSize+len(payload)]
+		} else {
+			pkt.payload = payload
+		}
+		conn.peeked = pkt
+	}
+
+	hdr := *conn.peeked.hdr
+	return &hdr, conn.peeked.payload, nil
+}
+
+// nextLocked возвращает пакет, сохранённый Peek, или принимает следующий
+// (buffered - см. recvPacketLocked)
+// Вызывается с захваченным conn.mu
+func (conn *TCPConnection) nextLocked(buffered bool) (*core.PacketHeader, []byte, error) {
+	if pkt := conn.peeked; pkt != nil {
+		conn.peeked = nil
+		conn.recvRaw = pkt.raw
+		return pkt.hdr, pkt.payload, nil
+	}
+	return conn.recvPacketLocked(buffered)
+}
+
+// recvPacketLocked принимает пакет из сокета, пропуская ControlCompressReset
+// При buffered после сброса следующий пакет принимается, только если он
+// уже целиком в буфере; иначе возвращается nil без ошибки
+// Вызывается с захваченным conn.mu
+func (conn *TCPConnection) recvPacketLocked(buffered bool) (*core.PacketHeader, []byte, error) {
+	for {
+		hdr, payload, err := conn.recvLocked()
+		if err != errCompressReset {
+			return hdr, payload, conn.recvFailed(err)
+		}
+		if buffered && !conn.packetBuffered() {
+			return nil, nil, nil
+		}
+	}
+}
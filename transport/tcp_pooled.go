@@ -0,0 +1,53 @@
+package transport
+
+import (
+	"net"
+	"sync"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// PooledSendMaxPayload - максимальный payload, сериализуемый в буфер из пула
+const PooledSendMaxPayload = 1024
+
+// sendBufPool - пул буферов для сериализации небольших пакетов
+var sendBufPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, core.HeaderSize+PooledSendMaxPayload+4)
+		return &buf
+	},
+}
+
+// TCPSendPooled отправляет пакет через TCP, сериализуя его в буфер из пула
+// Для payload до PooledSendMaxPayload байт не выделяет память в куче,
+// более крупные пакеты отправляются через TCPSend
+func TCPSendPooled(conn net.Conn, hdr *core.PacketHeader, payload []byte) (int, error) {
+	if len(payload) > PooledSendMaxPayload {
+		return TCPSend(conn, hdr, payload)
+	}
+
+	bufPtr, ok := sendBufPool.Get().(*[]byte)
+	if !ok {
+		buf := make([]byte, 0, core.HeaderSize+PooledSendMaxPayload+4)
+		bufPtr = &buf
+	}
+	defer sendBufPool.Put(bufPtr)
+
+	data, err := core.AppendPacket((*bufPtr)[:0], hdr, payload)
+	if err != nil {
+		return 0, err
+	}
+	maskHeader(data, currentConfig().ObfuscationKey)
+
+	armed, err := startWrite(conn)
+	if err != nil {
+		return 0, err
+	}
+	n, err := conn.Write(data)
+	addBytesOut(n)
+	if err := finishWrite(conn, armed, err); err != nil {
+		return 0, err
+	}
+
+	return n, nil
+}
@@ -0,0 +1,86 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// ErrRecvTimeout - приём прерван дедлайном чтения (SetReadDeadline)
+// Ошибка временная: частично принятый пакет сохраняется, и следующий вызов
+// TCPRecv продолжает его с того же места
+var ErrRecvTimeout = errors.New("receive timeout")
+
+// readExact читает точное количество байт (гарантированное чтение)
+// Возвращает число прочитанных байт; прерванный сигналом Read (EINTR)
+// повторяется, истечение дедлайна возвращается как ErrRecvTimeout
+func (conn *TCPConnection) readExact(buf []byte) (int, error) {
+	totalRead := 0
+	for totalRead < len(buf) {
+		n, err := conn.reader.Read(buf[totalRead:])
+		addBytesIn(n)
+		totalRead += n
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			return totalRead, conn.readError(err)
+		}
+		if n == 0 {
+			untrackTCPConnection(conn)
+			return totalRead, io.EOF
+		}
+	}
+	return totalRead, nil
+}
+
+// readError классифицирует ошибку чтения: временные (дедлайн) оборачиваются
+// в ErrRecvTimeout, остальные завершают соединение и удаляют его из реестра
+func (conn *TCPConnection) readError(err error) error {
+	if err == io.EOF {
+		// Соединение закрыто удалённой стороной
+		untrackTCPConnection(conn)
+		return io.EOF
+	}
+	// Провал keepalive (ETIMEDOUT) тоже считается таймаутом в net.Error,
+	// поэтому проверяется первым
+	if err := conn.keepAliveError(err); errors.Is(err, ErrKeepAliveFailed) {
+		return err
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, syscall.EAGAIN) {
+		return fmt.Errorf("%w: %w", ErrRecvTimeout, err)
+	}
+	// net.ErrClosed, ECONNRESET и прочие ошибки сокета необратимы
+	untrackTCPConnection(conn)
+	return err
+}
+
+// recvFailed удаляет соединение из реестра после ошибки приёма, кроме
+// ErrRecvTimeout: иначе соединения, брошенные после ошибки (ECONNRESET,
+// core.ErrCRCMismatch), остаются в реестре вместе с буферами приёма
+// Resync возвращает восстановленное соединение в реестр
+func (conn *TCPConnection) recvFailed(err error) error {
+	if err != nil && !errors.Is(err, ErrRecvTimeout) {
+		untrackTCPConnection(conn)
+	}
+	return err
+}
+
+// readFailedLocked обрабатывает ошибку чтения пакета: при ErrRecvTimeout
+// сохраняет прогресс (read байт пакета уже в recvBuffer) и текущее
+// состояние, иначе сбрасывает state machine
+// Вызывается с захваченным conn.mu
+func (conn *TCPConnection) readFailedLocked(err error, read int) error {
+	if errors.Is(err, ErrRecvTimeout) {
+		if n, convErr := core.SafeIntToUint(read); convErr == nil {
+			conn.recvBytesRead = n
+			return err
+		}
+	}
+	conn.recvState = StateIdle
+	return err
+}
@@ -0,0 +1,54 @@
+package transport
+
+import (
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// Resync восстанавливает выравнивание потока после ошибки приёма
+// (core.ErrCRCMismatch, неверный Magic или Version): пропускает байты до
+// следующего заголовка, проходящего ParseHeader, и возвращает их количество
+// Следующий TCPRecv начинает разбор с найденного заголовка. Байты пакета,
+// на котором произошла ошибка, уже прочитаны: если повреждён его PayloadLen,
+// вместе с ним может быть потерян и следующий пакет
+// Блокируется, пока не придёт заголовок целиком
+func (conn *TCPConnection) Resync() (int, error) {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+
+	// Незавершённый пакет отбрасывается
+	conn.recvState = StateIdle
+	conn.recvBytesRead = 0
+	conn.recvHeader = nil
+	conn.stateSnapshot.Store(int32(StateIdle))
+
+	key := currentConfig().ObfuscationKey
+	var header [core.HeaderSize]byte
+	skipped := 0
+	for {
+		peeked, err := conn.reader.Peek(core.HeaderSize)
+		if err != nil {
+			return skipped, conn.resyncError(err)
+		}
+		copy(header[:], peeked)
+		maskHeader(header[:], key)
+		if _, err := core.ParseHeader(header[:]); err == nil {
+			// Ошибка приёма удалила соединение из реестра (см. recvFailed)
+			if !conn.closed.Load() {
+				trackTCPConnection(conn)
+			}
+			return skipped, nil
+		}
+
+		// Сдвигаемся на байт и проверяем следующую позицию
+		if _, err := conn.reader.Discard(1); err != nil {
+			return skipped, conn.resyncError(err)
+		}
+		addBytesIn(1)
+		skipped++
+	}
+}
+
+// resyncError обрабатывает ошибку чтения в Resync как readExact
+func (conn *TCPConnection) resyncError(err error) error {
+	return wrapConnError(conn.id, conn.readError(err))
+}
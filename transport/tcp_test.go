@@ -0,0 +1,882 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// serializeTestPacket сериализует пакет с payload заданного размера
+func serializeTestPacket(t *testing.T, size int) ([]byte, []byte) {
+	t.Helper()
+
+	payload := bytes.Repeat([]byte("overproto"), size/9+1)[:size]
+	hdr := core.NewPacketHeader()
+	hdr.PayloadLen = uint16(size)
+	data, err := core.Serialize(hdr, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, payload
+}
+
+func TestTCPRecvStreamingCRC(t *testing.T) {
+	// Payload больше tcpCRCChunkSize: CRC32 собирается из нескольких частей
+	good, payload := serializeTestPacket(t, 60000)
+	bad := append([]byte(nil), good...)
+	bad[core.HeaderSize+40000] ^= 0xFF
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	go func() {
+		_, _ = client.Write(good)
+		_, _ = client.Write(bad)
+	}()
+
+	_, got, err := TCPRecv(conn)
+	if err != nil {
+		t.Fatalf("TCPRecv failed: %v", err)
+	}
+	if !bytes.Equal(got, payload) {
+		t.Fatal("payload mismatch")
+	}
+
+	// Ошибка приёма содержит идентификатор соединения
+	var connErr *ConnError
+	_, _, err = TCPRecv(conn)
+	if !errors.As(err, &connErr) || connErr.ID != conn.ID() || connErr.Err.Error() != "CRC32 mismatch" {
+		t.Fatalf("expected CRC32 mismatch of conn %s, got %v", conn.ID(), err)
+	}
+	if len(conn.ID()) != 8 {
+		t.Fatalf("unexpected connection ID %q", conn.ID())
+	}
+}
+
+// isTracked проверяет, учитывается ли соединение в статистике
+func isTracked(conn *TCPConnection) bool {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	_, ok := tcpConns[conn]
+	return ok
+}
+
+func TestTCPResyncAfterCRCMismatch(t *testing.T) {
+	good, payload := serializeTestPacket(t, 100)
+	bad := append([]byte(nil), good...)
+	bad[core.HeaderSize+10] ^= 0xFF
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	go func() {
+		_, _ = client.Write(bad)
+		_, _ = client.Write([]byte("junk!"))
+		_, _ = client.Write(good)
+	}()
+
+	if _, _, err := TCPRecv(conn); !errors.Is(err, core.ErrCRCMismatch) {
+		t.Fatalf("expected CRC32 mismatch, got %v", err)
+	}
+	if isTracked(conn) {
+		t.Fatal("connection still tracked after receive error")
+	}
+	skipped, err := conn.Resync()
+	if err != nil || skipped != 5 {
+		t.Fatalf("Resync: skipped=%d err=%v", skipped, err)
+	}
+	if !isTracked(conn) {
+		t.Fatal("connection not tracked after Resync")
+	}
+	_, got, err := TCPRecv(conn)
+	if err != nil || !bytes.Equal(got, payload) {
+		t.Fatalf("packet after resync: err=%v", err)
+	}
+}
+
+func TestTCPRecvTimeoutResumes(t *testing.T) {
+	data, payload := serializeTestPacket(t, 1000)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	// Пакет обрывается посреди payload, чтение упирается в дедлайн
+	split := core.HeaderSize + 300
+	go func() { _, _ = client.Write(data[:split]) }()
+	_ = server.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	if _, _, err := TCPRecv(conn); !errors.Is(err, ErrRecvTimeout) {
+		t.Fatalf("expected ErrRecvTimeout, got %v", err)
+	}
+
+	// Следующий вызов продолжает пакет с места остановки
+	go func() { _, _ = client.Write(data[split:]) }()
+	_ = server.SetReadDeadline(time.Time{})
+	hdr, got, err := TCPRecv(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.PayloadLen != 1000 || !bytes.Equal(got, payload) {
+		t.Fatal("resumed packet differs from sent")
+	}
+}
+
+func TestTCPPeekLeavesPacket(t *testing.T) {
+	first, payload := serializeTestPacket(t, 100)
+	second, _ := serializeTestPacket(t, 10)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	go func() {
+		_, _ = client.Write(first)
+		_, _ = client.Write(second)
+	}()
+
+	for i := 0; i < 2; i++ {
+		hdr, got, err := conn.Peek()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hdr.PayloadLen != 100 || !bytes.Equal(got, payload) {
+			t.Fatalf("Peek %d returned another packet", i)
+		}
+	}
+
+	_, got, raw, err := TCPRecvRaw(conn)
+	if err != nil || !bytes.Equal(got, payload) || !bytes.Equal(raw, first) {
+		t.Fatalf("TCPRecvRaw after Peek: err=%v", err)
+	}
+	hdr, _, err := TCPRecv(conn)
+	if err != nil || hdr.PayloadLen != 10 {
+		t.Fatalf("second packet: %v", err)
+	}
+}
+
+func TestCloseIdleClosesOnlyIdleConnections(t *testing.T) {
+	idleClient, idleServer := net.Pipe()
+	defer idleClient.Close()
+	idle := NewTCPConnection(idleServer)
+	defer idle.Close()
+
+	activeClient, activeServer := net.Pipe()
+	defer activeClient.Close()
+	active := NewTCPConnection(activeServer)
+	defer active.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	// Приём через активное соединение обновляет время активности
+	data, _ := serializeTestPacket(t, 10)
+	go func() { _, _ = activeClient.Write(data) }()
+	if _, _, err := TCPRecv(active); err != nil {
+		t.Fatal(err)
+	}
+	if !active.Stats().LastActivity.After(idle.Stats().LastActivity) {
+		t.Fatal("LastActivity not updated on receive")
+	}
+
+	if n := CloseIdle(50 * time.Millisecond); n != 1 {
+		t.Fatalf("CloseIdle closed %d connections, want 1", n)
+	}
+	if _, err := idleClient.Write([]byte{0}); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("idle connection not closed: %v", err)
+	}
+	for _, c := range GetStats().Connections {
+		if c.ID == idle.ID() {
+			t.Fatal("closed connection still tracked")
+		}
+	}
+	if n := CloseIdle(50 * time.Millisecond); n != 0 {
+		t.Fatalf("second CloseIdle closed %d connections, want 0", n)
+	}
+}
+
+func TestLastActivityCountsOnlyConnectionIO(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	if conn.Conn() != server {
+		t.Fatal("Conn does not return the original connection")
+	}
+	go func() { _, _ = io.Copy(io.Discard, client) }()
+
+	// Запись напрямую в Conn не считается активностью
+	created := conn.LastActivity()
+	time.Sleep(10 * time.Millisecond)
+	if _, err := conn.Conn().Write([]byte{0}); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.LastActivity().Equal(created) {
+		t.Fatal("LastActivity updated by a write to Conn")
+	}
+
+	hdr := core.NewPacketHeader()
+	hdr.Proto = core.ProtoTCP
+	hdr.PayloadLen = 3
+	if _, err := TCPSendConn(conn, hdr, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	if !conn.LastActivity().After(created) {
+		t.Fatal("LastActivity not updated by TCPSendConn")
+	}
+}
+
+func TestRecvAllTrailingCompressResetDoesNotBlock(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+	if err := conn.EnableStreamCompression(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, payload := serializeTestPacket(t, 10)
+	resetPayload, err := core.EncodeControl(core.NewCompressReset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resetHdr := core.NewPacketHeader()
+	resetHdr.Opcode = core.OpControl
+	resetHdr.Proto = core.ProtoTCP
+	resetHdr.PayloadLen = uint16(len(resetPayload))
+	reset, err := core.Serialize(resetHdr, resetPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Три пакета данных и сброс приходят одной записью: после первого
+	// TCPRecv в буфере остаются два пакета данных и ControlCompressReset
+	stream := append(append(append(append([]byte(nil), data...), data...), data...), reset...)
+	go func() { _, _ = client.Write(stream) }()
+	if _, _, err := TCPRecv(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	type result struct {
+		packets []core.Packet
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		packets, err := conn.RecvAll()
+		done <- result{packets, err}
+	}()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		if len(res.packets) != 2 {
+			t.Fatalf("RecvAll returned %d packets, want 2", len(res.packets))
+		}
+		for i, pkt := range res.packets {
+			if !bytes.Equal(pkt.Payload, payload) {
+				t.Fatalf("packet %d: payload %q", i, pkt.Payload)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatal("RecvAll blocked on a socket read after a trailing reset")
+	}
+}
+
+func TestTCPResetCompression(t *testing.T) {
+	client, server := net.Pipe()
+	sender := NewTCPConnection(client)
+	defer sender.Close()
+	receiver := NewTCPConnection(server)
+	defer receiver.Close()
+	for _, conn := range []*TCPConnection{sender, receiver} {
+		if err := conn.EnableStreamCompression(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	msg := bytes.Repeat([]byte("overproto stream compression "), 20)
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpData
+	hdr.Proto = core.ProtoTCP
+	hdr.PayloadLen = uint16(len(msg))
+	sent := make(chan error, 1)
+	go func() {
+		for i := 0; i < 3; i++ {
+			if i == 2 {
+				if err := sender.ResetCompression(); err != nil {
+					sent <- err
+					return
+				}
+			}
+			if _, err := TCPSendStream(sender, hdr, msg); err != nil {
+				sent <- err
+				return
+			}
+		}
+		sent <- nil
+	}()
+
+	// Повтор сообщения сжимается по словарю, после сброса - снова целиком;
+	// сам ControlCompressReset приложению не выдаётся
+	var sizes []int
+	for i := 0; i < 3; i++ {
+		got, payload, raw, err := TCPRecvRaw(receiver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Opcode != core.OpData || !bytes.Equal(payload, msg) {
+			t.Fatalf("packet %d: opcode %d, payload %q", i, got.Opcode, payload)
+		}
+		sizes = append(sizes, len(raw))
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+	if sizes[1] >= sizes[0] || sizes[2] != sizes[0] {
+		t.Fatalf("compressed sizes %v: dictionary was not reset", sizes)
+	}
+}
+
+func TestTCPRecvRawMatchesWire(t *testing.T) {
+	data, payload := serializeTestPacket(t, 100)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	go func() {
+		_, _ = client.Write(data)
+	}()
+
+	_, got, raw, err := TCPRecvRaw(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, payload) || !bytes.Equal(raw, data) {
+		t.Fatal("raw bytes or payload differ from the wire")
+	}
+}
+
+func TestTCPAuthFuncRejectsClient(t *testing.T) {
+	data, _ := serializeTestPacket(t, 10)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	conn.SetAuthFunc(func(streamID uint32, payload []byte) error {
+		return errors.New("bad token")
+	})
+
+	go func() {
+		_, _ = client.Write(data)
+	}()
+
+	if _, _, err := TCPRecv(conn); !errors.Is(err, ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+	if conn.Authenticated() {
+		t.Fatal("rejected connection reported as authenticated")
+	}
+	// Соединение закрыто: запись со стороны клиента больше невозможна
+	if _, err := client.Write(data); err == nil {
+		t.Fatal("expected connection to be closed")
+	}
+}
+
+func TestTCPRecvReusesBuffer(t *testing.T) {
+	large, largePayload := serializeTestPacket(t, 60000)
+	small, smallPayload := serializeTestPacket(t, 10)
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	go func() {
+		_, _ = client.Write(large)
+		for i := 0; i < 3; i++ {
+			_, _ = client.Write(small)
+		}
+	}()
+
+	_, first, err := TCPRecv(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	backing := &conn.recvBuffer[0]
+
+	var buf bytes.Buffer
+	for i := 0; i < 3; i++ {
+		if _, err := TCPRecvInto(conn, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), smallPayload) {
+			t.Fatalf("packet %d: payload mismatch", i)
+		}
+		if &conn.recvBuffer[0] != backing || cap(conn.recvBuffer) < len(large) {
+			t.Fatalf("packet %d: receive buffer was reallocated", i)
+		}
+	}
+
+	// Payload, возвращённый TCPRecv, не перезаписан следующими пакетами
+	if !bytes.Equal(first, largePayload) {
+		t.Fatal("payload returned by TCPRecv was overwritten")
+	}
+}
+
+// repeatConn отдаёт одни и те же данные по кругу
+type repeatConn struct {
+	net.Conn
+	data []byte
+	off  int
+}
+
+func (c *repeatConn) Read(p []byte) (int, error) {
+	n := copy(p, c.data[c.off:])
+	c.off = (c.off + n) % len(c.data)
+	return n, nil
+}
+
+func TestTCPRecvIntoNoAllocs(t *testing.T) {
+	large, _ := serializeTestPacket(t, 30000)
+	small, _ := serializeTestPacket(t, 100)
+	stream := append(append([]byte(nil), large...), small...)
+
+	conn := NewTCPConnection(&repeatConn{data: stream})
+	defer untrackTCPConnection(conn)
+
+	var buf bytes.Buffer
+	buf.Grow(len(large))
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := TCPRecvInto(conn, &buf); err != nil {
+			t.Fatal(err)
+		}
+	})
+	// Единственное выделение на пакет - *PacketHeader из ParseHeader
+	if allocs > 1 {
+		t.Fatalf("expected no per-packet buffer allocations, got %.1f allocs per packet", allocs)
+	}
+}
+
+func TestTCPSendWriteTimeout(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.WriteTimeout = 50 * time.Millisecond
+	SetConfig(cfg)
+
+	// Никто не читает из client: запись блокируется
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	hdr := core.NewPacketHeader()
+	hdr.PayloadLen = 3
+	if _, err := TCPSend(server, hdr, []byte("abc")); !errors.Is(err, ErrWriteTimeout) {
+		t.Fatalf("expected ErrWriteTimeout, got %v", err)
+	}
+
+	// Дедлайн снят: запись в обход библиотеки ждёт медленного получателя
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		_, _ = io.Copy(io.Discard, client)
+	}()
+	if _, err := server.Write([]byte("abc")); err != nil {
+		t.Fatalf("write after timeout failed: %v", err)
+	}
+}
+
+func TestTCPListenBacklog(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.Backlog = 16
+	SetConfig(cfg)
+
+	listener, err := TCPListen(0)
+	if err != nil {
+		t.Fatalf("listen with backlog failed: %v", err)
+	}
+	defer listener.Close()
+	port := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	client, err := TCPConnect("127.0.0.1", port)
+	if err != nil {
+		t.Fatalf("connect failed: %v", err)
+	}
+	defer client.Close()
+	server, err := TCPAccept(listener)
+	if err != nil {
+		t.Fatalf("accept failed: %v", err)
+	}
+	server.Close()
+
+	// Отрицательный backlog: ошибка, а порт освобождён
+	if err := listener.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	cfg.Backlog = -1
+	SetConfig(cfg)
+	if bad, err := TCPListen(port); err == nil {
+		bad.Close()
+		t.Fatal("expected error for negative backlog")
+	}
+
+	SetConfig(nil)
+	again, err := TCPListen(port)
+	if err != nil {
+		t.Fatalf("listener leaked after backlog error: %v", err)
+	}
+	again.Close()
+}
+
+// closedFirstListener закрывает первое принятое соединение до его возврата
+type closedFirstListener struct {
+	net.Listener
+	accepted int
+}
+
+func (l *closedFirstListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	l.accepted++
+	if err == nil && l.accepted == 1 {
+		_ = conn.Close()
+	}
+	return conn, err
+}
+
+func TestTCPAcceptSkipsKeepAliveFailure(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.KeepAliveIdle = time.Second
+	SetConfig(cfg)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+	}
+
+	wrapped := &closedFirstListener{Listener: listener}
+	conn, err := TCPAccept(wrapped)
+	if err != nil {
+		t.Fatalf("keepalive failure on one connection stopped TCPAccept: %v", err)
+	}
+	defer conn.Close()
+	if wrapped.accepted != 2 {
+		t.Fatalf("accepted %d connections, want 2", wrapped.accepted)
+	}
+}
+
+func TestAcceptChanStopsOnClose(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conns, errs := AcceptChan(listener)
+
+	for i := 0; i < 2; i++ {
+		client, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+
+		conn := <-conns
+		if conn.RemoteAddr().String() != client.LocalAddr().String() {
+			t.Fatalf("accepted unexpected connection from %v", conn.RemoteAddr())
+		}
+		conn.Close()
+	}
+
+	_ = listener.Close()
+	if _, ok := <-conns; ok {
+		t.Fatal("connection channel not closed after listener close")
+	}
+	if err, ok := <-errs; ok {
+		t.Fatalf("unexpected accept error: %v", err)
+	}
+}
+
+func TestTCPRecvValidateProto(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.ValidateProto = true
+	SetConfig(cfg)
+
+	packet := func(proto uint8) []byte {
+		hdr := core.NewPacketHeader()
+		hdr.Proto = proto
+		hdr.PayloadLen = 2
+		data, err := core.Serialize(hdr, []byte("ok"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	go func() {
+		_, _ = client.Write(packet(core.ProtoUDP))
+		_, _ = client.Write(packet(core.ProtoTCP))
+	}()
+
+	if _, _, err := TCPRecv(conn); !errors.Is(err, ErrProtoMismatch) {
+		t.Fatalf("expected ErrProtoMismatch, got %v", err)
+	}
+	// Пакет с неверным Proto прочитан целиком: следующий принимается
+	if hdr, payload, err := TCPRecv(conn); err != nil || hdr.Proto != core.ProtoTCP || string(payload) != "ok" {
+		t.Fatalf("next packet: %v %q %v", hdr, payload, err)
+	}
+}
+
+func TestRecvChanBackpressure(t *testing.T) {
+	data, payload := serializeTestPacket(t, 10)
+
+	client, server := net.Pipe()
+	conn := NewTCPConnection(server)
+	packets, errs := RecvChan(conn, 1)
+
+	// net.Pipe не буферизует: запись завершается, только когда её читают
+	written := make(chan int, 4)
+	go func() {
+		for i := 0; i < 4; i++ {
+			if _, err := client.Write(data); err != nil {
+				return
+			}
+			written <- i
+		}
+	}()
+
+	// Первый пакет в буфере канала, второй ждёт отправки в канал - третий не читается
+	for i := 0; i < 2; i++ {
+		<-written
+	}
+	select {
+	case i := <-written:
+		t.Fatalf("write %d completed while the channel was full", i)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	for i := 0; i < 4; i++ {
+		pkt := <-packets
+		if !bytes.Equal(pkt.Payload, payload) {
+			t.Fatalf("packet %d: payload mismatch", i)
+		}
+	}
+
+	client.Close()
+	if _, ok := <-packets; ok {
+		t.Fatal("packet channel not closed after connection close")
+	}
+	if err, ok := <-errs; ok {
+		t.Fatalf("unexpected receive error: %v", err)
+	}
+}
+
+func TestTCPAcceptMaxConnections(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.MaxConnections = 1
+	SetConfig(cfg)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	accepted := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := TCPAccept(listener)
+			if err != nil {
+				close(accepted)
+				return
+			}
+			accepted <- conn
+		}
+	}()
+
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+
+	dial()
+	first := <-accepted
+
+	// Второе соединение сверх лимита получает ControlClose и закрывается
+	refused := NewTCPConnection(dial())
+	hdr, payload, err := TCPRecv(refused)
+	if err != nil || hdr.Opcode != core.OpControl {
+		t.Fatalf("expected refusal, got %+v %v", hdr, err)
+	}
+	msg, err := core.DecodeControl(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := msg.Uint16(core.TagCode); msg.Type != core.ControlClose || code != ConnLimitCloseCode {
+		t.Fatalf("unexpected refusal message: %+v", msg)
+	}
+	if stats := GetStats(); stats.AcceptedConnections != 1 || stats.MaxConnections != 1 || stats.RefusedConnections == 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	// После закрытия место освобождается
+	_ = first.Close()
+	dial()
+	select {
+	case conn := <-accepted:
+		_ = conn.Close()
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection was not accepted after a slot was freed")
+	}
+}
+
+func TestDrainNotifiesAndRefuses(t *testing.T) {
+	defer stopDrain()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	dial := func() net.Conn {
+		conn, err := net.Dial("tcp", listener.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = conn.Close() })
+		return conn
+	}
+
+	client := dial()
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+
+	if err := Drain("deploy"); err != nil {
+		t.Fatal(err)
+	}
+	if !GetStats().Draining {
+		t.Fatal("stats do not report draining")
+	}
+
+	// Открытое соединение получает уведомление
+	peer := NewTCPConnection(client)
+	defer peer.Close()
+	hdr, payload, err := TCPRecv(peer)
+	if err != nil || hdr.Opcode != core.OpControl {
+		t.Fatalf("expected going away, got %+v %v", hdr, err)
+	}
+	msg, err := core.DecodeControl(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, _ := msg.Uint16(core.TagCode); code != GoingAwayCloseCode || msg.String(core.TagReason) != "deploy" {
+		t.Fatalf("unexpected message: %+v", msg)
+	}
+
+	// Новое соединение отклоняется
+	go func() { _, _ = TCPAccept(listener) }()
+	refused := NewTCPConnection(dial())
+	defer refused.Close()
+	if hdr, _, err := TCPRecv(refused); err != nil || hdr.Opcode != core.OpControl {
+		t.Fatalf("expected refusal, got %+v %v", hdr, err)
+	}
+	if _, _, err := TCPRecv(refused); err != io.EOF {
+		t.Fatalf("expected EOF after refusal, got %v", err)
+	}
+}
+
+// userDataHolder - TCPConnection и ReliableContext
+type userDataHolder interface {
+	SetUserData(v interface{})
+	UserData() interface{}
+}
+
+func TestUserDataConcurrent(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewTCPConnection(server)
+	defer conn.Close()
+	ctx, _ := newLoopbackContext(t)
+
+	type identity struct{ id int }
+	for _, holder := range []userDataHolder{conn, ctx} {
+		if holder.UserData() != nil {
+			t.Fatal("user data set before SetUserData")
+		}
+
+		var wg sync.WaitGroup
+		for w := 0; w < 4; w++ {
+			wg.Add(2)
+			go func(w int) {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					if i%10 == 9 {
+						holder.SetUserData(nil)
+						continue
+					}
+					holder.SetUserData(&identity{id: w})
+				}
+			}(w)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 1000; i++ {
+					switch v := holder.UserData().(type) {
+					case nil:
+					case *identity:
+						if v.id < 0 || v.id >= 4 {
+							t.Errorf("unexpected identity %d", v.id)
+							return
+						}
+					default:
+						t.Errorf("unexpected user data %T", v)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		holder.SetUserData("final")
+		if got := holder.UserData(); got != "final" {
+			t.Fatalf("UserData = %v, expected final", got)
+		}
+		holder.SetUserData(nil)
+		if got := holder.UserData(); got != nil {
+			t.Fatalf("UserData after clearing = %v", got)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"syscall"
 
@@ -15,18 +16,32 @@ const (
 	UDPRecvBufferSize = 64 * 1024
 )
 
+// ErrDatagramTruncated - датаграмма не поместилась в буфер приёма и была обрезана
+var ErrDatagramTruncated = errors.New("datagram truncated")
+
+// ErrPeerUnreachable - на порту удалённой стороны никто не слушает
+// (ОС получила ICMP port unreachable). Исходная ошибка доступна через errors.Unwrap
+var ErrPeerUnreachable = errors.New("peer unreachable")
+
+// wrapPeerError оборачивает ошибку "connection refused" в ErrPeerUnreachable
+// Остальные ошибки возвращаются без изменений
+func wrapPeerError(err error) error {
+	if err != nil && isConnRefused(err) {
+		return fmt.Errorf("%w: %w", ErrPeerUnreachable, err)
+	}
+	return err
+}
+
 // UDPBind создаёт UDP сокет с привязкой к порту
-// Устанавливает SO_REUSEADDR
+// Устанавливает SO_REUSEADDR, если он не отключён через Config.DisableReuseAddr
 func UDPBind(port uint16) (*net.UDPConn, error) {
+	return udpBindWithControl(port, listenControl)
+}
+
+// udpBindWithControl создаёт UDP сокет, настраивая его через control перед bind
+func udpBindWithControl(port uint16, control func(network, address string, c syscall.RawConn) error) (*net.UDPConn, error) {
 	lc := net.ListenConfig{
-		Control: func(network, address string, c syscall.RawConn) error {
-			var err error
-			_ = c.Control(func(fd uintptr) {
-				// Устанавливаем SO_REUSEADDR
-				err = setSockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
-			})
-			return err
-		},
+		Control: control,
 	}
 
 	addr := &net.UDPAddr{
@@ -44,6 +59,7 @@ func UDPBind(port uint16) (*net.UDPConn, error) {
 		_ = conn.Close()
 		return nil, errors.New("failed to cast to UDPConn")
 	}
+	trackOwned(udpConn)
 
 	return udpConn, nil
 }
@@ -52,67 +68,203 @@ func UDPBind(port uint16) (*net.UDPConn, error) {
 // Позволяет использовать Write/Read вместо WriteTo/ReadFrom
 func UDPConnect(host string, port uint16) (*net.UDPConn, error) {
 	addr := net.JoinHostPort(host, fmt.Sprintf("%d", port))
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	dialer := net.Dialer{
+		Control: dialControl,
+	}
+	conn, err := dialer.Dial("udp", addr)
 	if err != nil {
 		return nil, err
 	}
 
-	conn, err := net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		return nil, err
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.New("failed to cast to UDPConn")
 	}
+	trackOwned(udpConn)
 
-	return conn, nil
+	return udpConn, nil
 }
 
 // UDPSend отправляет пакет через UDP
-// Если addr == nil, используется подключённый адрес
-// Проверяет MTU и предупреждает если пакет слишком большой
-func UDPSend(conn *net.UDPConn, hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr) (int, error) {
+// conn - любой net.PacketConn (*net.UDPConn, обёртки, тестовые двойники)
+// Если addr == nil, используется подключённый адрес: conn должен реализовывать io.Writer
+// Проверяет MTU и предупреждает если пакет слишком большой (только для *net.UDPConn)
+func UDPSend(conn net.PacketConn, hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr) (int, error) {
 	// Сериализуем пакет
 	data, err := core.Serialize(hdr, payload)
 	if err != nil {
 		return 0, err
 	}
+	maskHeader(data, currentConfig().ObfuscationKey)
 
 	// Проверяем MTU (предупреждение, если пакет превышает MTU)
-	// Примечание: фрагментация будет реализована в будущем
-	_, _ = UDPGetMTU(conn)
+	// Пакет больше MTU не фрагментируется (см. UDPSendFragmented)
+	if udpConn, ok := conn.(*net.UDPConn); ok {
+		_, _ = UDPGetMTU(udpConn)
+	}
 
-	// Отправляем данные
+	// Отправляем данные (с дедлайном, если задан Config.WriteTimeout)
+	armed, err := startWrite(conn)
+	if err != nil {
+		return 0, err
+	}
 	var n int
 	if addr == nil {
 		// Используем подключённый адрес
-		n, err = conn.Write(data)
+		w, ok := conn.(io.Writer)
+		if !ok {
+			return 0, errors.New("no destination address for unconnected socket")
+		}
+		n, err = w.Write(data)
 	} else {
 		// Отправляем на указанный адрес
-		n, err = conn.WriteToUDP(data, addr)
+		n, err = conn.WriteTo(data, addr)
 	}
+	addBytesOut(n)
 
-	if err != nil {
-		return 0, err
+	if err := finishWrite(conn, armed, err); err != nil {
+		return 0, wrapPeerError(err)
 	}
 
 	return n, nil
 }
 
 // UDPRecv принимает пакет через UDP
+// conn - любой net.PacketConn (*net.UDPConn, обёртки, тестовые двойники)
 // Возвращает заголовок, payload и адрес отправителя
-func UDPRecv(conn *net.UDPConn) (*core.PacketHeader, []byte, *net.UDPAddr, error) {
-	buf := make([]byte, UDPRecvBufferSize)
+// (nil, если conn вернул адрес не типа *net.UDPAddr)
+// Если Config.DropForeignPackets включён, датаграммы с чужим Magic
+// отбрасываются без ошибки и учитываются в статистике
+// Если датаграмма не поместилась в буфер приёма (флаг MSG_TRUNC для
+// *net.UDPConn, заполненный целиком буфер для других net.PacketConn),
+// возвращается ErrDatagramTruncated вместо ошибки CRC32
+func UDPRecv(conn net.PacketConn) (*core.PacketHeader, []byte, *net.UDPAddr, error) {
+	hdr, payload, _, addr, err := UDPRecvRaw(conn)
+	return hdr, payload, addr, err
+}
 
-	n, addr, err := conn.ReadFromUDP(buf)
+// UDPRecvRaw принимает пакет как UDPRecv и дополнительно возвращает
+// датаграмму без изменений (заголовок, payload и CRC32 как на проводе)
+// Подходит для ретрансляции пакета без повторной сериализации
+// raw и payload разделяют память
+func UDPRecvRaw(conn net.PacketConn) (*core.PacketHeader, []byte, []byte, *net.UDPAddr, error) {
+	buf := make([]byte, UDPRecvBufferSize)
+	n, addr, truncated, err := readDatagram(conn, buf)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
+	}
+	return parseDatagram(buf, n, truncated, addr)
+}
+
+// UDPRecvConnected принимает пакет из подключённого сокета (UDPConnect)
+// через Read, не запрашивая адрес отправителя: ядро уже отбрасывает
+// датаграммы с других адресов, поэтому адрес всегда совпадает с
+// RemoteAddr(). Быстрее UDPRecv и не возвращает ненужный адрес
+// Для неподключённых сокетов (UDPBind) используется UDPRecv
+// Ошибки и DropForeignPackets - как в UDPRecv
+func UDPRecvConnected(conn net.Conn) (*core.PacketHeader, []byte, error) {
+	buf := make([]byte, UDPRecvBufferSize)
+	var n int
+	var truncated bool
+	for {
+		var err error
+		n, truncated, err = readConnected(conn, buf)
+		if err != nil {
+			return nil, nil, wrapPeerError(err)
+		}
+		if acceptDatagram(buf[:n]) {
+			break
+		}
+	}
+	hdr, payload, _, _, err := parseDatagram(buf, n, truncated, nil)
+	return hdr, payload, err
+}
+
+// readConnected читает датаграмму из подключённого сокета без адреса
+// отправителя; truncated - датаграмма не поместилась в buf
+func readConnected(conn net.Conn, buf []byte) (int, bool, error) {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		n, err := conn.Read(buf)
+		return n, err == nil && n == len(buf), err
+	}
+	n, _, flags, _, err := udpConn.ReadMsgUDPAddrPort(buf, nil)
+	if err != nil && isTruncatedError(err) {
+		return n, true, nil
+	}
+	return n, flags&msgTrunc != 0, err
+}
+
+// readDatagram читает в buf следующую датаграмму, пропуская посторонний
+// трафик (Config.DropForeignPackets), и снимает маску заголовка
+// truncated - датаграмма не поместилась в buf (см. readFrom)
+// Возвращает только ошибки чтения из сокета
+func readDatagram(conn net.PacketConn, buf []byte) (int, *net.UDPAddr, bool, error) {
+	for {
+		n, addr, truncated, err := readFrom(conn, buf)
+		if err != nil {
+			return 0, nil, false, wrapPeerError(err)
+		}
+		if acceptDatagram(buf[:n]) {
+			return n, addr, truncated, nil
+		}
+	}
+}
+
+// readFrom читает датаграмму и адрес отправителя; truncated - датаграмма
+// не поместилась в buf: для *net.UDPConn - по флагу MSG_TRUNC, для других
+// net.PacketConn, не сообщающих об обрезке, - если буфер заполнен целиком
+func readFrom(conn net.PacketConn, buf []byte) (int, *net.UDPAddr, bool, error) {
+	udpConn, ok := conn.(*net.UDPConn)
+	if !ok {
+		n, from, err := conn.ReadFrom(buf)
+		addr, _ := from.(*net.UDPAddr)
+		return n, addr, err == nil && n == len(buf), err
+	}
+	n, _, flags, addr, err := udpConn.ReadMsgUDP(buf, nil)
+	if err != nil && isTruncatedError(err) {
+		return n, addr, true, nil
+	}
+	return n, addr, flags&msgTrunc != 0, err
+}
+
+// acceptDatagram учитывает принятую датаграмму и снимает маску заголовка
+// Возвращает false для постороннего трафика при Config.DropForeignPackets
+func acceptDatagram(data []byte) bool {
+	cfg := currentConfig()
+	addBytesIn(len(data))
+	maskHeader(data, cfg.ObfuscationKey)
+
+	// Посторонний трафик (сканеры портов, другие протоколы) отбрасываем молча
+	if cfg.DropForeignPackets && !core.IsOverProtoPacket(data) {
+		foreignDropped.Add(1)
+		return false
+	}
+	return true
+}
+
+// parseDatagram разбирает датаграмму из buf[:n], прочитанную readDatagram
+func parseDatagram(buf []byte, n int, truncated bool, addr *net.UDPAddr) (*core.PacketHeader, []byte, []byte, *net.UDPAddr, error) {
+	// Обрезанная датаграмма не пройдёт проверку CRC32: сообщаем причину
+	if truncated {
+		return nil, nil, nil, addr, ErrDatagramTruncated
 	}
 
 	// Десериализуем пакет
 	hdr, payload, err := core.Deserialize(buf[:n])
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, nil, nil, nil, err
+	}
+	if err := checkProto(hdr, core.ProtoUDP); err != nil {
+		return nil, nil, nil, addr, err
 	}
 
-	return hdr, payload, addr, nil
+	// raw возвращается как на проводе, с маской заголовка
+	maskHeader(buf[:n], currentConfig().ObfuscationKey)
+
+	// Байты после CRC32 (если есть) в raw не входят
+	return hdr, payload, buf[:core.HeaderSize+len(payload)+4], addr, nil
 }
 
 // UDPGetMTU получает MTU для соединения
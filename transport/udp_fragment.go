@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"errors"
+	"net"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+const (
+	// maxUDPPacket - наибольшая UDP датаграмма по IPv4 (65535 - IP и UDP заголовки)
+	maxUDPPacket = 65507
+	// udpIPv4Overhead и udpIPv6Overhead - заголовки IP и UDP датаграммы
+	udpIPv4Overhead = 20 + 8
+	udpIPv6Overhead = 40 + 8
+)
+
+// UDPMaxPacket возвращает наибольший размер пакета OverProto (заголовок,
+// payload и CRC32), который conn передаёт одной датаграммой без IP фрагментации:
+// Config.MTU, уменьшенный до MTU пути (UDPGetMTU для подключённого
+// *net.UDPConn) за вычетом заголовков IP и UDP
+func UDPMaxPacket(conn net.PacketConn) uint {
+	size := currentConfig().MTU
+	if size == 0 {
+		size = core.FragMTUDefault
+	}
+	if udpConn, ok := conn.(*net.UDPConn); ok {
+		overhead := uint(udpIPv4Overhead)
+		if addr, ok := udpConn.LocalAddr().(*net.UDPAddr); ok && addr.IP.To4() == nil {
+			overhead = udpIPv6Overhead
+		}
+		if mtu, err := UDPGetMTU(udpConn); err == nil && mtu > overhead {
+			size = min(size, mtu-overhead)
+		}
+	}
+	return min(size, maxUDPPacket)
+}
+
+// UDPSendFragmented отправляет пакет как UDPSend, но пакет больше mtu байт
+// разбивает FragmentPacket на фрагменты с FlagFragment и отправляет каждый
+// отдельной датаграммой. Получатель собирает их FragmentReassembler по
+// (StreamID, Seq), поэтому одновременно отправляемые сообщения потока
+// должны различаться Seq
+// Возвращает общее количество отправленных байт
+func UDPSendFragmented(conn net.PacketConn, hdr *core.PacketHeader, payload []byte, mtu uint, addr *net.UDPAddr) (int, error) {
+	if mtu <= core.HeaderSize+4 {
+		return 0, errors.New("MTU too small for fragmentation")
+	}
+	fragments, _, err := core.FragmentPacket(hdr, payload, mtu)
+	if err != nil {
+		return 0, err
+	}
+	if fragments == nil {
+		return UDPSend(conn, hdr, payload, addr)
+	}
+
+	key := currentConfig().ObfuscationKey
+	total := 0
+	for _, fragment := range fragments {
+		maskHeader(fragment, key)
+		n, err := UDPSendRaw(conn, fragment, addr)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package transport
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnRefused проверяет, сообщила ли ОС об отсутствии слушателя на порту peer'а
+// На Unix ICMP port unreachable для подключённого UDP сокета приходит как
+// ECONNREFUSED при следующем Read/Write
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
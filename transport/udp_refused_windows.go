@@ -0,0 +1,18 @@
+//go:build windows
+
+package transport
+
+import (
+	"errors"
+	"syscall"
+)
+
+// wsaeconnrefused - WSAECONNREFUSED (нет в пакете syscall)
+const wsaeconnrefused = syscall.Errno(10061)
+
+// isConnRefused проверяет, сообщила ли ОС об отсутствии слушателя на порту peer'а
+// На Windows ICMP port unreachable для UDP приходит как WSAECONNRESET при следующем
+// приёме, а для подключённого сокета также как WSAECONNREFUSED
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.WSAECONNRESET) || errors.Is(err, wsaeconnrefused)
+}
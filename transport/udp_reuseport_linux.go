@@ -0,0 +1,32 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !sparc64
+
+package transport
+
+import (
+	"net"
+	"syscall"
+)
+
+// soReusePort - значение SO_REUSEPORT из asm-generic (в пакете syscall константа отсутствует)
+// На mips и sparc значение отличается, поэтому эти архитектуры исключены
+const soReusePort = 0xf
+
+// UDPBindReusePort создаёт UDP сокет с SO_REUSEPORT
+// Несколько сокетов, привязанных к одному порту, получают датаграммы,
+// распределённые ядром по хешу адресов - по одному циклу приёма на ядро
+func UDPBindReusePort(port uint16) (*net.UDPConn, error) {
+	return udpBindWithControl(port, func(network, address string, c syscall.RawConn) error {
+		if err := listenControl(network, address, c); err != nil {
+			return err
+		}
+
+		var err error
+		ctrlErr := c.Control(func(fd uintptr) {
+			err = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, soReusePort, 1)
+		})
+		if ctrlErr != nil {
+			return ctrlErr
+		}
+		return err
+	})
+}
@@ -0,0 +1,27 @@
+//go:build linux && !mips && !mipsle && !mips64 && !mips64le && !sparc64
+
+package transport
+
+import (
+	"net"
+	"testing"
+)
+
+func TestUDPBindReusePortSharesPort(t *testing.T) {
+	first, err := UDPBindReusePort(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	port := uint16(first.LocalAddr().(*net.UDPAddr).Port)
+
+	// Второй сокет с SO_REUSEPORT привязывается к тому же порту
+	second, err := UDPBindReusePort(port)
+	if err != nil {
+		t.Fatalf("second bind to port %d: %v", port, err)
+	}
+	defer second.Close()
+	if got := second.LocalAddr().(*net.UDPAddr).Port; got != int(port) {
+		t.Fatalf("second socket bound to port %d, expected %d", got, port)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le || sparc64
+
+package transport
+
+import (
+	"errors"
+	"net"
+)
+
+// UDPBindReusePort поддерживается только на Linux:
+// на других платформах SO_REUSEPORT либо отсутствует, либо не распределяет нагрузку между сокетами
+func UDPBindReusePort(port uint16) (*net.UDPConn, error) {
+	return nil, errors.New("UDPBindReusePort is not supported on this platform (Linux only)")
+}
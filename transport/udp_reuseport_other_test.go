@@ -0,0 +1,12 @@
+//go:build !linux || mips || mipsle || mips64 || mips64le || sparc64
+
+package transport
+
+import "testing"
+
+func TestUDPBindReusePortUnsupported(t *testing.T) {
+	conn, err := UDPBindReusePort(0)
+	if err == nil || conn != nil {
+		t.Fatalf("expected an unsupported platform error, got %v %v", conn, err)
+	}
+}
@@ -0,0 +1,222 @@
+package transport
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// UDPPacketHandler - обработчик пакетов одного опкода в UDPServe
+type UDPPacketHandler func(hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr)
+
+// UnknownOpcodeHandler - обработчик пакетов UDPServe, для опкода которых нет
+// обработчика; raw - пакет как на проводе, действителен только во время вызова
+type UnknownOpcodeHandler func(hdr *core.PacketHeader, payload []byte, raw []byte, addr *net.UDPAddr)
+
+// UDPMux - таблица маршрутизации UDPServe: обработчики опкодов и надёжные
+// сессии, которым передаются пакеты их удалённых сторон
+// Методы можно вызывать во время работы UDPServe
+type UDPMux struct {
+	mu       sync.RWMutex
+	handlers map[uint8]UDPPacketHandler
+	sessions map[string]*ReliableContext // По адресу удалённой стороны
+	unknown  UnknownOpcodeHandler
+	dropped  atomic.Uint64 // Пакеты неизвестных опкодов, отброшенные без обработчика
+}
+
+// NewUDPMux создаёт пустую таблицу маршрутизации
+func NewUDPMux() *UDPMux {
+	return &UDPMux{
+		handlers: make(map[uint8]UDPPacketHandler),
+		sessions: make(map[string]*ReliableContext),
+	}
+}
+
+// Handle регистрирует обработчик fn пакетов с опкодом opcode; nil удаляет его
+// Обработчик OpPing заменяет автоматический ответ OpPong
+func (m *UDPMux) Handle(opcode uint8, fn UDPPacketHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if fn == nil {
+		delete(m.handlers, opcode)
+		return
+	}
+	m.handlers[opcode] = fn
+}
+
+// HandleUnknown регистрирует обработчик fn пакетов, для опкода которых
+// нет обработчика Handle (например, от более новой версии протокола):
+// их можно переслать, записать в журнал или отбросить; nil восстанавливает
+// поведение по умолчанию - пакет отбрасывается и учитывается в UnknownDropped
+func (m *UDPMux) HandleUnknown(fn UnknownOpcodeHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.unknown = fn
+}
+
+// UnknownDropped возвращает число пакетов неизвестных опкодов, отброшенных
+// без обработчика HandleUnknown
+func (m *UDPMux) UnknownDropped() uint64 {
+	return m.dropped.Load()
+}
+
+// AddSession направляет пакеты с адреса ctx.RemoteAddr() в надёжную сессию:
+// ACK передаются в ProcessACK, пакеты данных подтверждаются и проверяются
+// на дубликаты как в Recv, после чего попадают в обработчики опкодов
+// Сессия должна отправлять через тот же сокет, который обслуживает UDPServe,
+// и её Recv не вызывается
+func (m *UDPMux) AddSession(ctx *ReliableContext) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions[ctx.RemoteAddr().String()] = ctx
+}
+
+// RemoveSession прекращает передачу пакетов в сессию ctx
+func (m *UDPMux) RemoveSession(ctx *ReliableContext) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for addr, s := range m.sessions {
+		if s == ctx {
+			delete(m.sessions, addr)
+		}
+	}
+}
+
+// handler возвращает обработчик опкода или nil
+func (m *UDPMux) handler(opcode uint8) UDPPacketHandler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.handlers[opcode]
+}
+
+// unknownHandler возвращает обработчик неизвестных опкодов или nil
+func (m *UDPMux) unknownHandler() UnknownOpcodeHandler {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.unknown
+}
+
+// session возвращает сессию удалённой стороны addr или nil
+func (m *UDPMux) session(addr *net.UDPAddr) *ReliableContext {
+	if addr == nil {
+		return nil
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.sessions[addr.String()]
+}
+
+// UDPServe принимает пакеты из conn и распределяет их по mux:
+//   - пакеты удалённых сторон AddSession проходят через их сессию
+//     (ACK - ProcessACK, подтверждение и отбрасывание дубликатов);
+//   - на OpPing без обработчика отвечает OpPong с тем же StreamID и payload;
+//   - OpPong без обработчика поглощается;
+//   - остальные пакеты передаются обработчику своего опкода, пакеты без
+//     обработчика - HandleUnknown или отбрасываются (UnknownDropped)
+//
+// Обработчики вызываются последовательно в горутине UDPServe; payload
+// передаётся как принят (см. DecodePayload)
+// Повреждённые датаграммы пропускаются. Возвращает ошибку чтения из conn
+// (например, net.ErrClosed после его закрытия)
+func UDPServe(conn net.PacketConn, mux *UDPMux) error {
+	buf := make([]byte, UDPRecvBufferSize)
+	for {
+		n, addr, truncated, err := readDatagram(conn, buf)
+		if err != nil {
+			return err
+		}
+		// Deserialize копирует payload, поэтому buf переиспользуется
+		hdr, payload, raw, _, err := parseDatagram(buf, n, truncated, addr)
+		if err != nil {
+			continue
+		}
+
+		ctx := mux.session(addr)
+		if ctx == nil {
+			mux.dispatch(conn, nil, hdr, payload, raw, addr)
+			continue
+		}
+
+		received := hdr
+		hdr, payload, err = ctx.handlePacket(hdr, payload, addr)
+		if err != nil {
+			if isSessionFatal(err) {
+				mux.RemoveSession(ctx)
+			}
+			continue
+		}
+		// При упорядочивании handlePacket может вернуть ранее принятый
+		// пакет вместо текущего: raw относится только к текущему
+		if !isSessionControl(hdr, payload) {
+			if hdr != received {
+				raw = nil
+			}
+			mux.dispatch(conn, ctx, hdr, payload, raw, addr)
+		}
+		// Пакеты, освобождённые заполнением пропуска (SetOrdered)
+		for {
+			hdr, payload, ok := ctx.popReady()
+			if !ok {
+				break
+			}
+			mux.dispatch(conn, ctx, hdr, payload, nil, addr)
+		}
+	}
+}
+
+// dispatch передаёт пакет обработчику опкода, выполняет встроенную
+// обработку keepalive или передаёт пакет HandleUnknown
+// ctx - сессия отправителя или nil; raw - пакет как на проводе или nil,
+// если он уже недоступен
+func (m *UDPMux) dispatch(conn net.PacketConn, ctx *ReliableContext, hdr *core.PacketHeader, payload, raw []byte, addr *net.UDPAddr) {
+	if fn := m.handler(hdr.Opcode); fn != nil {
+		fn(hdr, payload, addr)
+		return
+	}
+
+	switch hdr.Opcode {
+	case core.OpPing:
+		pong := *hdr
+		pong.Opcode = core.OpPong
+		pong.Flags = 0
+		pong.Seq = 0
+		if ctx != nil {
+			_ = ctx.Send(&pong, payload)
+			return
+		}
+		_, _ = UDPSend(conn, &pong, payload, addr)
+		return
+	case core.OpPong:
+		return
+	}
+
+	fn := m.unknownHandler()
+	if fn == nil {
+		m.dropped.Add(1)
+		return
+	}
+	if raw == nil {
+		// Пакет выдан из буфера упорядочивания: восстанавливаем его вид
+		// на проводе (поле Timestamp не передаётся, поэтому совпадает)
+		serialized, err := core.Serialize(hdr, payload)
+		if err != nil {
+			m.dropped.Add(1)
+			return
+		}
+		maskHeader(serialized, currentConfig().ObfuscationKey)
+		raw = serialized
+	}
+	fn(hdr, payload, raw, addr)
+}
+
+// isSessionControl проверяет, обработан ли пакет надёжной сессией целиком:
+// ACK, NACK и сообщения миграции не передаются приложению
+func isSessionControl(hdr *core.PacketHeader, payload []byte) bool {
+	if hdr.Flags&core.FlagACK != 0 || migrationControl(hdr, payload) != nil {
+		return true
+	}
+	_, ok := nackControl(hdr, payload)
+	return ok
+}
@@ -0,0 +1,436 @@
+package transport
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// countingConn - обёртка net.PacketConn, считающая записанные датаграммы
+type countingConn struct {
+	net.PacketConn
+	writes atomic.Int32
+}
+
+func (c *countingConn) WriteTo(p []byte, addr net.Addr) (int, error) {
+	c.writes.Add(1)
+	return c.PacketConn.WriteTo(p, addr)
+}
+
+func TestUDPSendRecvPacketConnWrapper(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	conn := &countingConn{PacketConn: pc}
+
+	hdr := core.NewPacketHeader()
+	hdr.StreamID = 3
+	hdr.PayloadLen = 5
+	if _, err := UDPSend(conn, hdr, []byte("hello"), pc.LocalAddr().(*net.UDPAddr)); err != nil {
+		t.Fatal(err)
+	}
+
+	got, payload, addr, err := UDPRecv(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.StreamID != 3 || string(payload) != "hello" || addr == nil {
+		t.Fatalf("unexpected packet: %+v %q %v", got, payload, addr)
+	}
+	if conn.writes.Load() != 1 {
+		t.Fatalf("wrapper saw %d writes, want 1", conn.writes.Load())
+	}
+
+	// Без адреса неподключённый net.PacketConn отправить не может
+	if _, err := UDPSend(conn, hdr, []byte("hello"), nil); err == nil {
+		t.Fatal("expected error for unconnected socket without address")
+	}
+}
+
+func TestUDPConnectPeerUnreachable(t *testing.T) {
+	// Занимаем и освобождаем порт, чтобы на нём гарантированно никто не слушал
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	pc.Close()
+
+	conn, err := UDPConnect("127.0.0.1", uint16(port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	hdr := core.NewPacketHeader()
+	hdr.PayloadLen = 1
+	if _, err := UDPSend(conn, hdr, []byte{1}, nil); err != nil && !errors.Is(err, ErrPeerUnreachable) {
+		t.Fatal(err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, _, err := UDPRecv(conn); !errors.Is(err, ErrPeerUnreachable) {
+		t.Fatalf("expected ErrPeerUnreachable, got %v", err)
+	}
+}
+
+func TestUDPBindInterface(t *testing.T) {
+	defer SetConfig(nil)
+
+	cfg := core.NewConfig()
+	cfg.BindInterface = "overproto-missing0"
+	SetConfig(cfg)
+	if _, err := UDPBind(0); err == nil {
+		t.Fatal("expected error for missing interface")
+	}
+
+	ifaces, err := net.Interfaces()
+	if err != nil || len(ifaces) == 0 {
+		t.Skip("no network interfaces")
+	}
+	cfg.BindInterface = ifaces[0].Name
+	SetConfig(cfg)
+	conn, err := UDPBind(0)
+	if runtime.GOOS != "linux" {
+		if !errors.Is(err, ErrBindInterfaceUnsupported) {
+			t.Fatalf("expected ErrBindInterfaceUnsupported, got %v", err)
+		}
+		return
+	}
+	if err != nil {
+		t.Skipf("SO_BINDTODEVICE not permitted: %v", err)
+	}
+	conn.Close()
+}
+
+func TestUDPRecvWorkersPerSourceOrder(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverAddr := server.LocalAddr().(*net.UDPAddr)
+
+	const senders, count = 3, 100
+	var (
+		mu       sync.Mutex
+		lastSeq  = make(map[string]uint32)
+		received int
+		done     = make(chan struct{})
+	)
+	handler := func(hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr, err error) {
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if hdr.Seq != lastSeq[addr.String()]+1 {
+			t.Errorf("%s: seq %d after %d", addr, hdr.Seq, lastSeq[addr.String()])
+		}
+		lastSeq[addr.String()] = hdr.Seq
+		if received++; received == senders*count {
+			close(done)
+		}
+	}
+
+	recvErr := make(chan error, 1)
+	go func() { recvErr <- UDPRecvWorkers(server, handler) }()
+
+	for i := 0; i < senders; i++ {
+		client, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close()
+		go func(client net.PacketConn) {
+			for seq := uint32(1); seq <= count; seq++ {
+				hdr := core.NewPacketHeader()
+				hdr.Seq = seq
+				hdr.PayloadLen = 4
+				if _, err := UDPSend(client, hdr, []byte("data"), serverAddr); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(client)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("not all packets were handled")
+	}
+
+	server.Close()
+	if err := <-recvErr; err == nil {
+		t.Fatal("expected read error after close")
+	}
+}
+
+func TestUDPObfuscationKey(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+	addr := pc.LocalAddr().(*net.UDPAddr)
+
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.ObfuscationKey = []byte{0x5a, 0xc3, 0x17}
+	SetConfig(cfg)
+
+	hdr := core.NewPacketHeader()
+	hdr.StreamID = 9
+	hdr.PayloadLen = 5
+	if _, err := UDPSend(pc, hdr, []byte("hello"), addr); err != nil {
+		t.Fatal(err)
+	}
+	got, payload, raw, _, err := UDPRecvRaw(pc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.StreamID != 9 || string(payload) != "hello" {
+		t.Fatalf("unexpected packet: %+v %q", got, payload)
+	}
+	// На проводе Magic скрыт маской
+	if core.IsOverProtoPacket(raw) {
+		t.Fatal("raw datagram starts with plain magic")
+	}
+
+	// Получатель без ключа пакет не разбирает
+	if _, err := UDPSend(pc, hdr, []byte("hello"), addr); err != nil {
+		t.Fatal(err)
+	}
+	SetConfig(nil)
+	if _, _, _, err := UDPRecv(pc); err == nil {
+		t.Fatal("expected error without obfuscation key")
+	}
+}
+
+func TestUDPServeRoutesByOpcode(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	serverAddr := server.LocalAddr().(*net.UDPAddr)
+
+	serverSession, err := NewReliableContext(server, client.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer serverSession.Close()
+	clientSession, err := NewReliableContext(client, serverAddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientSession.Close()
+
+	data := make(chan string, 1)
+	mux := NewUDPMux()
+	mux.Handle(core.OpData, func(hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr) {
+		data <- string(payload)
+	})
+	mux.AddSession(serverSession)
+
+	served := make(chan error, 1)
+	go func() { served <- UDPServe(server, mux) }()
+
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpData
+	hdr.Proto = core.ProtoUDP
+	hdr.PayloadLen = 4
+	if err := clientSession.Send(hdr, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	ping := core.NewPacketHeader()
+	ping.Opcode = core.OpPing
+	ping.Proto = core.ProtoUDP
+	ping.PayloadLen = 4
+	if err := clientSession.Send(ping, []byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Клиент получает ACK пакета данных и OpPong на ping
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var acked, ponged bool
+	for !acked || !ponged {
+		got, payload, err := clientSession.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case got.Flags&core.FlagACK != 0:
+			acked = true
+		case got.Opcode == core.OpPong && string(payload) == "ping":
+			ponged = true
+		}
+	}
+	if got := <-data; got != "data" {
+		t.Fatalf("handler got %q", got)
+	}
+	if clientSession.Stats().InFlight != 0 {
+		t.Fatal("data packet was not acknowledged")
+	}
+
+	_ = server.Close()
+	if err := <-served; !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("UDPServe returned %v", err)
+	}
+}
+
+func TestUDPServeUnknownOpcode(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	serverAddr := server.LocalAddr().(*net.UDPAddr)
+
+	mux := NewUDPMux()
+	served := make(chan error, 1)
+	go func() { served <- UDPServe(server, mux) }()
+
+	unknown := core.NewPacketHeader()
+	unknown.Opcode = 0x7F
+	unknown.Proto = core.ProtoUDP
+	unknown.PayloadLen = 3
+	ping := core.NewPacketHeader()
+	ping.Opcode = core.OpPing
+	ping.Proto = core.ProtoUDP
+
+	// Без обработчика пакет отбрасывается и учитывается; ответ на ping
+	// гарантирует, что UDPServe уже обработал предыдущий пакет
+	roundTrip := func() {
+		t.Helper()
+		if _, err := UDPSend(client, unknown, []byte("new"), serverAddr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := UDPSend(client, ping, nil, serverAddr); err != nil {
+			t.Fatal(err)
+		}
+		_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if hdr, _, _, err := UDPRecv(client); err != nil || hdr.Opcode != core.OpPong {
+			t.Fatalf("expected pong, got %v %v", hdr, err)
+		}
+	}
+	roundTrip()
+	if got := mux.UnknownDropped(); got != 1 {
+		t.Fatalf("UnknownDropped = %d, want 1", got)
+	}
+
+	raws := make(chan []byte, 1)
+	mux.HandleUnknown(func(hdr *core.PacketHeader, payload []byte, raw []byte, addr *net.UDPAddr) {
+		raws <- append([]byte(nil), raw...)
+	})
+	roundTrip()
+	want, err := core.Serialize(unknown, []byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := <-raws; !bytes.Equal(got, want) {
+		t.Fatalf("raw packet mismatch: %x, want %x", got, want)
+	}
+	if got := mux.UnknownDropped(); got != 1 {
+		t.Fatalf("UnknownDropped = %d after HandleUnknown, want 1", got)
+	}
+
+	_ = server.Close()
+	<-served
+}
+
+func TestUDPRecvConnectedIgnoresOtherSources(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	other, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	client, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	clientAddr := client.LocalAddr().(*net.UDPAddr)
+
+	hdr := core.NewPacketHeader()
+	hdr.Proto = core.ProtoUDP
+	hdr.PayloadLen = 5
+	// Датаграмму с чужого адреса подключённый сокет не принимает
+	if _, err := UDPSend(other, hdr, []byte("other"), clientAddr); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UDPSend(server, hdr, []byte("hello"), clientAddr); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = client.SetReadDeadline(time.Now().Add(2 * time.Second))
+	got, payload, err := UDPRecvConnected(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PayloadLen != 5 || string(payload) != "hello" {
+		t.Fatalf("unexpected packet %q", payload)
+	}
+}
+
+func TestUDPRecvDetectsTruncation(t *testing.T) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	client, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	hdr := core.NewPacketHeader()
+	hdr.Proto = core.ProtoUDP
+	payload := make([]byte, 200)
+	hdr.PayloadLen = uint16(len(payload))
+	for i := 0; i < 2; i++ {
+		if _, err := UDPSend(client, hdr, payload, server.LocalAddr().(*net.UDPAddr)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = server.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	// Буфер меньше датаграммы: ядро обрезает её и выставляет MSG_TRUNC
+	buf := make([]byte, 100)
+	n, addr, truncated, err := readDatagram(server, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, _, err := parseDatagram(buf, n, truncated, addr); !errors.Is(err, ErrDatagramTruncated) {
+		t.Fatalf("expected ErrDatagramTruncated, got %v", err)
+	}
+
+	// Датаграмма, поместившаяся в буфер, не считается обрезанной
+	if _, got, _, err := UDPRecv(server); err != nil || len(got) != len(payload) {
+		t.Fatalf("UDPRecv: err=%v len=%d", err, len(got))
+	}
+}
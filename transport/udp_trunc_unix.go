@@ -0,0 +1,14 @@
+//go:build !windows
+
+package transport
+
+import "syscall"
+
+// msgTrunc - флаг recvmsg: датаграмма длиннее буфера и обрезана
+const msgTrunc = syscall.MSG_TRUNC
+
+// isTruncatedError проверяет, сообщила ли ОС об обрезанной датаграмме ошибкой
+// На Unix обрезка сообщается только флагом msgTrunc
+func isTruncatedError(err error) bool {
+	return false
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package transport
+
+import (
+	"errors"
+	"syscall"
+)
+
+const (
+	// msgTrunc - MSG_TRUNC из winsock (нет в пакете syscall)
+	msgTrunc = 0x0100
+	// wsaemsgsize - WSAEMSGSIZE (нет в пакете syscall)
+	wsaemsgsize = syscall.Errno(10040)
+)
+
+// isTruncatedError проверяет, сообщила ли ОС об обрезанной датаграмме ошибкой
+// WSARecvMsg возвращает WSAEMSGSIZE, заполнив буфер началом датаграммы
+func isTruncatedError(err error) bool {
+	return errors.Is(err, wsaemsgsize)
+}
@@ -0,0 +1,124 @@
+package transport
+
+import (
+	"hash/fnv"
+	"net"
+	"runtime"
+	"sync"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// udpWorkerQueueSize - очередь датаграмм одного обработчика UDPRecvWorkers
+// Когда очередь заполнена, чтение из сокета приостанавливается
+const udpWorkerQueueSize = 256
+
+// UDPHandler - обработчик пакета, принятого UDPRecvWorkers
+// При ошибке разбора датаграммы hdr и payload равны nil, а err - причина
+type UDPHandler func(hdr *core.PacketHeader, payload []byte, addr *net.UDPAddr, err error)
+
+// udpBufferPool - буферы чтения датаграмм; буфер возвращается в пул
+// после Deserialize, которая копирует payload
+var udpBufferPool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, UDPRecvBufferSize)
+		return &buf
+	},
+}
+
+// udpDatagram - датаграмма, переданная обработчику
+type udpDatagram struct {
+	buf       *[]byte
+	n         int
+	truncated bool // Датаграмма не поместилась в буфер (см. readFrom)
+	addr      *net.UDPAddr
+}
+
+// UDPRecvWorkers читает датаграммы из conn в вызывающей горутине и разбирает
+// их (CRC32, заголовок) в Config.UDPRecvWorkers горутинах (0 - по числу CPU),
+// вызывая handler для каждого пакета
+// Датаграммы одного адреса отправителя попадают в одну горутину, поэтому
+// handler вызывается для них в порядке прихода; для разных адресов -
+// параллельно
+// Каждое чтение использует отдельный буфер из пула, гонок на общем
+// буфере нет. Возвращает ошибку чтения (например, после закрытия conn),
+// дождавшись обработки уже прочитанных датаграмм
+func UDPRecvWorkers(conn net.PacketConn, handler UDPHandler) error {
+	cfg := currentConfig()
+	workers := cfg.UDPRecvWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	queues := make([]chan udpDatagram, workers)
+	var wg sync.WaitGroup
+	for i := range queues {
+		queues[i] = make(chan udpDatagram, udpWorkerQueueSize)
+		wg.Add(1)
+		go func(queue chan udpDatagram) {
+			defer wg.Done()
+			for d := range queue {
+				d.process(handler)
+			}
+		}(queues[i])
+	}
+	defer func() {
+		for _, queue := range queues {
+			close(queue)
+		}
+		wg.Wait()
+	}()
+
+	for {
+		bufp, _ := udpBufferPool.Get().(*[]byte)
+		n, addr, truncated, err := readFrom(conn, *bufp)
+		if err != nil {
+			udpBufferPool.Put(bufp)
+			return wrapPeerError(err)
+		}
+		addBytesIn(n)
+		maskHeader((*bufp)[:n], cfg.ObfuscationKey)
+
+		// Посторонний трафик отбрасываем ещё до передачи обработчику
+		if cfg.DropForeignPackets && !core.IsOverProtoPacket((*bufp)[:n]) {
+			foreignDropped.Add(1)
+			udpBufferPool.Put(bufp)
+			continue
+		}
+
+		queues[sourceWorker(addr, workers)] <- udpDatagram{buf: bufp, n: n, truncated: truncated, addr: addr}
+	}
+}
+
+// process разбирает датаграмму, возвращает буфер в пул и вызывает handler
+func (d udpDatagram) process(handler UDPHandler) {
+	buf := *d.buf
+	if d.truncated {
+		// Обрезанная датаграмма не пройдёт проверку CRC32: сообщаем причину
+		udpBufferPool.Put(d.buf)
+		handler(nil, nil, d.addr, ErrDatagramTruncated)
+		return
+	}
+
+	hdr, payload, err := core.Deserialize(buf[:d.n])
+	udpBufferPool.Put(d.buf)
+	if err == nil {
+		err = checkProto(hdr, core.ProtoUDP)
+	}
+	if err != nil {
+		handler(nil, nil, d.addr, err)
+		return
+	}
+	handler(hdr, payload, d.addr, nil)
+}
+
+// sourceWorker выбирает горутину обработки по адресу отправителя
+func sourceWorker(addr *net.UDPAddr, workers int) int {
+	if addr == nil {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write(addr.IP)
+	_, _ = h.Write([]byte{byte(addr.Port >> 8), byte(addr.Port)})
+	return int(h.Sum32() % uint32(workers))
+}
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"errors"
+	"net"
+	"os"
+	"time"
+)
+
+// UnixListen создаёт слушающий Unix domain socket (SOCK_STREAM)
+// Оставшийся от предыдущего запуска файл сокета удаляется перед bind;
+// файл другого типа не трогается и приводит к ошибке
+// Принятые соединения оборачиваются в NewTCPConnection так же, как TCP
+func UnixListen(path string) (*net.UnixListener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, errors.New("path exists and is not a socket")
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	addr := &net.UnixAddr{Name: path, Net: "unix"}
+	listener, err := net.ListenUnix("unix", addr)
+	if err != nil {
+		return nil, err
+	}
+	// Файл сокета удаляется при Close
+	listener.SetUnlinkOnClose(true)
+	trackOwned(listener)
+
+	return listener, nil
+}
+
+// UnixConnect подключается к Unix domain socket
+func UnixConnect(path string) (*net.UnixConn, error) {
+	conn, err := net.DialTimeout("unix", path, 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.New("failed to cast to UnixConn")
+	}
+	trackOwned(unixConn)
+
+	return unixConn, nil
+}
@@ -0,0 +1,165 @@
+//go:build !windows
+
+package transport
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+// newUnixPair создаёт пару соединённых Unix stream сокетов
+func newUnixPair(t *testing.T) (*net.UnixConn, *net.UnixConn) {
+	t.Helper()
+
+	dir, err := os.MkdirTemp("", "op")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	listener, err := UnixListen(filepath.Join(dir, "s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := UnixConnect(listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = client.Close() })
+
+	server, err := listener.AcceptUnix()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = server.Close() })
+	return client, server
+}
+
+// sendTestPacket отправляет через TCPSend пакет с payload data
+func sendTestPacket(t *testing.T, conn net.Conn, data string) {
+	t.Helper()
+
+	hdr := core.NewPacketHeader()
+	hdr.Proto = core.ProtoTCP
+	hdr.PayloadLen = uint16(len(data))
+	if _, err := TCPSend(conn, hdr, []byte(data)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnixSendRecvFDs(t *testing.T) {
+	client, server := newUnixPair(t)
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if _, err := UnixSendFDs(client, 7, []byte("pipe"), []int{int(w.Fd())}); err != nil {
+		t.Fatal(err)
+	}
+
+	hdr, payload, fds, err := UnixRecvFDs(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hdr.StreamID != 7 || string(payload) != "pipe" || len(fds) != 1 {
+		t.Fatalf("unexpected packet: stream=%d payload=%q fds=%v", hdr.StreamID, payload, fds)
+	}
+
+	// Пишем через полученный дескриптор и читаем из исходного pipe
+	received := os.NewFile(uintptr(fds[0]), "received")
+	defer received.Close()
+	if _, err := received.Write([]byte("ok")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2)
+	if _, err := r.Read(buf); err != nil || string(buf) != "ok" {
+		t.Fatalf("read through passed fd: %q %v", buf, err)
+	}
+}
+
+func TestUnixFDsInterleaveWithObfuscation(t *testing.T) {
+	defer SetConfig(nil)
+	cfg := core.NewConfig()
+	cfg.ObfuscationKey = []byte{0x5a, 0xc3, 0x17}
+	cfg.ValidateProto = true
+	SetConfig(cfg)
+
+	client, server := newUnixPair(t)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// Пакет с дескриптором идёт в одном потоке с обычными пакетами
+	sendTestPacket(t, client, "first")
+	if _, err := UnixSendFDs(client, 7, []byte("pipe"), []int{int(w.Fd())}); err != nil {
+		t.Fatal(err)
+	}
+	sendTestPacket(t, client, "last")
+
+	hdr, payload, fds, err := UnixRecvFDs(server)
+	if err != nil || string(payload) != "first" || len(fds) != 0 {
+		t.Fatalf("first packet: %q fds=%v %v", payload, fds, err)
+	}
+	hdr, payload, fds, err = UnixRecvFDs(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeFDs(fds)
+	if hdr.StreamID != 7 || hdr.Proto != core.ProtoTCP || string(payload) != "pipe" || len(fds) != 1 {
+		t.Fatalf("fd packet: stream=%d proto=%#x payload=%q fds=%v", hdr.StreamID, hdr.Proto, payload, fds)
+	}
+	if _, payload, err := TCPRecv(NewTCPConnection(server)); err != nil || string(payload) != "last" {
+		t.Fatalf("packet after fds: %q %v", payload, err)
+	}
+}
+
+func TestUnixRecvFDsTruncated(t *testing.T) {
+	client, server := newUnixPair(t)
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	// Дескрипторов больше, чем помещается в буфер управляющих сообщений
+	fds := make([]int, UnixMaxFDs+4)
+	for i := range fds {
+		fds[i] = int(w.Fd())
+	}
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpControl
+	hdr.Proto = core.ProtoTCP
+	hdr.PayloadLen = 4
+	data, err := core.Serialize(hdr, []byte("many"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := client.WriteMsgUnix(data, syscall.UnixRights(fds...), nil); err != nil {
+		t.Fatal(err)
+	}
+	sendTestPacket(t, client, "next")
+
+	if _, _, got, err := UnixRecvFDs(server); !errors.Is(err, ErrFDsTruncated) || got != nil {
+		t.Fatalf("expected ErrFDsTruncated, got fds=%v err=%v", got, err)
+	}
+	// Пакет дочитан: следующий принимается с начала заголовка
+	if _, payload, _, err := UnixRecvFDs(server); err != nil || string(payload) != "next" {
+		t.Fatalf("packet after truncation: %q %v", payload, err)
+	}
+}
@@ -0,0 +1,163 @@
+//go:build !windows
+
+package transport
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"syscall"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+const (
+	// UnixMaxFDs - максимальное количество дескрипторов в одном пакете
+	UnixMaxFDs = 16
+)
+
+// ErrFDsTruncated - ядро отбросило часть дескрипторов пакета (MSG_CTRUNC),
+// например, если их больше UnixMaxFDs; принятые дескрипторы закрываются
+var ErrFDsTruncated = errors.New("file descriptors truncated")
+
+// UnixSendFDs отправляет пакет OpControl с файловыми дескрипторами (SCM_RIGHTS)
+// Дескрипторы передаются ядром вместе с первым байтом пакета;
+// payload может быть пустым или описывать передаваемые дескрипторы
+// Дескрипторы остаются открытыми у отправителя - закрыть их должен вызывающий
+// Пакет отправляется по правилам TCPSend (Proto, маска Config.ObfuscationKey,
+// Config.WriteTimeout), поэтому может чередоваться с ними в одном потоке
+func UnixSendFDs(conn *net.UnixConn, streamID uint32, payload []byte, fds []int) (int, error) {
+	if len(fds) == 0 || len(fds) > UnixMaxFDs {
+		return 0, errors.New("invalid number of file descriptors")
+	}
+
+	payloadLen, err := core.SafeIntToUint16(len(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	hdr := core.NewPacketHeader()
+	hdr.Opcode = core.OpControl
+	hdr.Proto = core.ProtoTCP
+	hdr.StreamID = streamID
+	hdr.PayloadLen = payloadLen
+
+	data, err := core.Serialize(hdr, payload)
+	if err != nil {
+		return 0, err
+	}
+	maskHeader(data, currentConfig().ObfuscationKey)
+
+	armed, err := startWrite(conn)
+	if err != nil {
+		return 0, err
+	}
+	n, _, err := conn.WriteMsgUnix(data, syscall.UnixRights(fds...), nil)
+	addBytesOut(n)
+	if err := finishWrite(conn, armed, err); err != nil {
+		return n, err
+	}
+	if n != len(data) {
+		return n, io.ErrShortWrite
+	}
+
+	return n, nil
+}
+
+// UnixRecvFDs принимает пакет, отправленный UnixSendFDs, вместе с дескрипторами
+// Читает ровно один пакет напрямую из сокета, поэтому соединение не должно
+// одновременно читаться через TCPConnection (его буфер поглотит управляющие сообщения)
+// Полученные дескрипторы принадлежат вызывающему и должны быть закрыты им
+// Если ядро отбросило часть дескрипторов, пакет дочитывается (поток остаётся
+// выровненным), принятые дескрипторы закрываются и возвращается ErrFDsTruncated
+func UnixRecvFDs(conn *net.UnixConn) (*core.PacketHeader, []byte, []int, error) {
+	header := make([]byte, core.HeaderSize)
+	oob := make([]byte, syscall.CmsgSpace(UnixMaxFDs*4))
+
+	// Управляющее сообщение приходит вместе с первым байтом пакета
+	n, oobn, flags, _, err := conn.ReadMsgUnix(header, oob)
+	addBytesIn(n)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	fds, err := parseUnixRights(oob[:oobn])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	packet, err := readUnixPacket(conn, header, n)
+	if err == nil && flags&syscall.MSG_CTRUNC != 0 {
+		err = ErrFDsTruncated
+	}
+	if err != nil {
+		closeFDs(fds)
+		return nil, nil, nil, err
+	}
+
+	hdr, payload, err := core.Deserialize(packet)
+	if err == nil {
+		err = checkProto(hdr, core.ProtoTCP)
+	}
+	if err != nil {
+		closeFDs(fds)
+		return nil, nil, nil, err
+	}
+
+	return hdr, payload, fds, nil
+}
+
+// readUnixPacket дочитывает пакет, первые n байт заголовка которого уже прочитаны
+// Маска Config.ObfuscationKey снимается с заголовка
+func readUnixPacket(conn *net.UnixConn, header []byte, n int) ([]byte, error) {
+	if n < core.HeaderSize {
+		if _, err := io.ReadFull(conn, header[n:]); err != nil {
+			return nil, err
+		}
+		addBytesIn(core.HeaderSize - n)
+	}
+	maskHeader(header, currentConfig().ObfuscationKey)
+
+	payloadLen := int(binary.BigEndian.Uint16(header[18:20]))
+	packet := make([]byte, core.HeaderSize+payloadLen+4)
+	copy(packet, header)
+
+	read, err := io.ReadFull(conn, packet[core.HeaderSize:])
+	addBytesIn(read)
+	if err != nil {
+		return nil, err
+	}
+
+	return packet, nil
+}
+
+// parseUnixRights извлекает дескрипторы из управляющих сообщений SCM_RIGHTS
+func parseUnixRights(oob []byte) ([]int, error) {
+	if len(oob) == 0 {
+		return nil, nil
+	}
+
+	msgs, err := syscall.ParseSocketControlMessage(oob)
+	if err != nil {
+		return nil, err
+	}
+
+	var fds []int
+	for i := range msgs {
+		rights, err := syscall.ParseUnixRights(&msgs[i])
+		if err != nil {
+			continue
+		}
+		fds = append(fds, rights...)
+	}
+
+	return fds, nil
+}
+
+// closeFDs закрывает дескрипторы, полученные вместе с некорректным пакетом
+func closeFDs(fds []int) {
+	for _, fd := range fds {
+		_ = syscall.Close(fd)
+	}
+}
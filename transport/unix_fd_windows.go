@@ -0,0 +1,31 @@
+//go:build windows
+
+package transport
+
+import (
+	"errors"
+	"net"
+
+	"github.com/nickolajgrishuk/overproto-go/core"
+)
+
+const (
+	// UnixMaxFDs - максимальное количество дескрипторов в одном пакете
+	UnixMaxFDs = 16
+)
+
+// ErrFDsTruncated - ядро отбросило часть дескрипторов пакета (MSG_CTRUNC)
+var ErrFDsTruncated = errors.New("file descriptors truncated")
+
+// errFDPassingUnsupported - на Windows SCM_RIGHTS недоступен
+var errFDPassingUnsupported = errors.New("file descriptor passing is not supported on Windows")
+
+// UnixSendFDs на Windows не поддерживается
+func UnixSendFDs(conn *net.UnixConn, streamID uint32, payload []byte, fds []int) (int, error) {
+	return 0, errFDPassingUnsupported
+}
+
+// UnixRecvFDs на Windows не поддерживается
+func UnixRecvFDs(conn *net.UnixConn) (*core.PacketHeader, []byte, []int, error) {
+	return nil, nil, nil, errFDPassingUnsupported
+}
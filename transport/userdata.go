@@ -0,0 +1,56 @@
+package transport
+
+import "sync/atomic"
+
+// userDataBox - обёртка, позволяющая хранить в atomic.Pointer значения любого типа
+type userDataBox struct {
+	value interface{}
+}
+
+// userData - пользовательские данные, привязанные к соединению или сессии
+// (идентификатор после аутентификации, объект сессии и т.п.)
+type userData struct {
+	ptr atomic.Pointer[userDataBox]
+}
+
+// set сохраняет значение; nil очищает данные
+func (u *userData) set(v interface{}) {
+	if v == nil {
+		u.ptr.Store(nil)
+		return
+	}
+	u.ptr.Store(&userDataBox{value: v})
+}
+
+// get возвращает сохранённое значение или nil
+func (u *userData) get() interface{} {
+	box := u.ptr.Load()
+	if box == nil {
+		return nil
+	}
+	return box.value
+}
+
+// SetUserData привязывает к соединению произвольные данные пользователя
+// Thread-safe
+func (conn *TCPConnection) SetUserData(v interface{}) {
+	conn.userData.set(v)
+}
+
+// UserData возвращает данные, установленные SetUserData, или nil
+// Thread-safe
+func (conn *TCPConnection) UserData() interface{} {
+	return conn.userData.get()
+}
+
+// SetUserData привязывает к надёжной сессии произвольные данные пользователя
+// Thread-safe
+func (ctx *ReliableContext) SetUserData(v interface{}) {
+	ctx.userData.set(v)
+}
+
+// UserData возвращает данные, установленные SetUserData, или nil
+// Thread-safe
+func (ctx *ReliableContext) UserData() interface{} {
+	return ctx.userData.get()
+}
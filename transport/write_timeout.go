@@ -0,0 +1,44 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ErrWriteTimeout - отправка не завершилась за Config.WriteTimeout
+// (например, буфер сокета заполнен из-за медленного получателя)
+var ErrWriteTimeout = errors.New("write timeout")
+
+// writeDeadliner - соединение с дедлайном записи (net.Conn, net.PacketConn)
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// startWrite устанавливает дедлайн записи, если задан Config.WriteTimeout
+// Возвращает true, если дедлайн установлен и должен быть снят в finishWrite
+func startWrite(c writeDeadliner) (bool, error) {
+	timeout := currentConfig().WriteTimeout
+	if timeout <= 0 {
+		return false, nil
+	}
+	if err := c.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// finishWrite снимает дедлайн, установленный startWrite, чтобы он не
+// повлиял на последующие записи в соединение в обход библиотеки
+// Истечение дедлайна возвращается как ErrWriteTimeout
+func finishWrite(c writeDeadliner, armed bool, err error) error {
+	if !armed {
+		return err
+	}
+	_ = c.SetWriteDeadline(time.Time{})
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("%w: %w", ErrWriteTimeout, err)
+	}
+	return err
+}